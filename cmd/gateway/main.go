@@ -21,6 +21,7 @@ import (
 	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
 	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/queue"
 	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/utils"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/protocol"
 	clowder "github.com/redhatinsights/app-common-go/pkg/api/v1"
 	"github.com/redhatinsights/platform-go-middlewares/request_id"
 
@@ -43,23 +44,37 @@ func closeConnections(cm c.ConnectionLocator, wg *sync.WaitGroup, timeout time.D
 	time.Sleep(timeout)
 }
 
-func configureConnectionRegistrar(cfg *config.Config, localCM c.ConnectionRegistrar) c.ConnectionRegistrar {
+func connectToRedis(cfg *config.Config) *redis.Client {
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     (cfg.RedisHost + ":" + cfg.RedisPort),
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+
+	_, err := redisClient.Ping().Result()
+	if err != nil {
+		logger.Log.Fatal("Unable to connect to redis: ", err)
+	}
+
+	return redisClient
+}
+
+// configureRedis connects to redis when connections are registered with redis.
+// nil is returned otherwise.
+func configureRedis(cfg *config.Config) *redis.Client {
+	if strings.ToLower(cfg.GatewayConnectionRegistrarImpl) != "redis" {
+		return nil
+	}
+
+	return connectToRedis(cfg)
+}
+
+func configureConnectionRegistrar(cfg *config.Config, redisClient *redis.Client, localCM c.ConnectionRegistrar) c.ConnectionRegistrar {
 	switch strings.ToLower(cfg.GatewayConnectionRegistrarImpl) {
 	case "redis":
 		logger.Log.Info("Using GatewayConnectionRegistrar as the ConnectionRegistrar impl." +
 			"  Connections will be registered with Redis.")
 
-		redisClient := redis.NewClient(&redis.Options{
-			Addr:     (cfg.RedisHost + ":" + cfg.RedisPort),
-			Password: cfg.RedisPassword,
-			DB:       cfg.RedisDB,
-		})
-
-		_, err := redisClient.Ping().Result()
-		if err != nil {
-			logger.Log.Fatal("Unable to connect to redis: ", err)
-		}
-
 		ipAddr := utils.GetIPAddress()
 		if ipAddr == nil {
 			logger.Log.Fatal("Unable to determine IP address")
@@ -79,6 +94,37 @@ func configureConnectionRegistrar(cfg *config.Config, localCM c.ConnectionRegist
 	}
 }
 
+// configureJobRegistry tracks jobs in redis when connections are registered
+// with redis so that the job receiver can read the job state
+func configureJobRegistry(cfg *config.Config, redisClient *redis.Client) c.JobRegistry {
+	if redisClient != nil {
+		return c.NewRedisJobRegistry(redisClient, cfg)
+	}
+
+	return c.NewInMemoryJobRegistry(cfg)
+}
+
+// configureJobQueue queues jobs for offline nodes in redis when connections
+// are registered with redis so that the jobs queued by the job receiver are
+// delivered by the gateway
+func configureJobQueue(cfg *config.Config, redisClient *redis.Client) c.JobQueue {
+	if redisClient != nil {
+		return c.NewRedisJobQueue(redisClient, cfg)
+	}
+
+	return c.NewInMemoryJobQueue()
+}
+
+// configureJobDeduplicator stores the idempotency keys in redis when
+// connections are registered with redis
+func configureJobDeduplicator(cfg *config.Config, redisClient *redis.Client) c.JobDeduplicator {
+	if redisClient != nil {
+		return c.NewRedisJobDeduplicator(redisClient, cfg)
+	}
+
+	return c.NewInMemoryJobDeduplicator(cfg)
+}
+
 func main() {
 	logger.InitLogger()
 
@@ -114,26 +160,27 @@ func main() {
 		logger.Log.Fatalf("Unable to start kafka producer: %s\n", err)
 	}
 
-	kc := &queue.ConsumerConfig{
-		Brokers:        cfg.KafkaBrokers,
-		SaslConfig:     buildKafkaSaslConfig(cfg),
-		Topic:          cfg.KafkaJobsTopic,
-		GroupID:        cfg.KafkaGroupID,
-		ConsumerOffset: cfg.KafkaConsumerOffset,
-	}
-	if err != nil {
-		logger.Log.Fatalf("Unable to start kafka consumer: %s\n", err)
-	}
-
 	var gatewayCR c.ConnectionRegistrar
 
 	localCM := c.NewLocalConnectionManager()
-	gatewayCR = configureConnectionRegistrar(cfg, localCM)
+	redisClient := configureRedis(cfg)
+
+	gatewayCR = configureConnectionRegistrar(cfg, redisClient, localCM)
+
+	jobRegistry := configureJobRegistry(cfg, redisClient)
+	jobQueue := configureJobQueue(cfg, redisClient)
+	jobDeduplicator := configureJobDeduplicator(cfg, redisClient)
+
+	directiveSchemas, err := c.LoadDirectiveSchemas(cfg.DirectiveSchemaDir)
+	if err != nil {
+		logger.Log.Fatal("Unable to load the directive schemas: ", err)
+	}
 
 	rd := c.NewResponseReactorFactory()
-	rs := c.NewReceptorServiceFactory(kw, cfg)
-	md := c.NewMessageDispatcherFactory(kc)
-	rc := ws.NewReceptorController(cfg, gatewayCR, wsMux, rd, md, rs)
+	rs := c.NewReceptorServiceFactory(kw, configureResponseAggregator(cfg), jobRegistry, jobQueue, directiveSchemas, cfg)
+	protocol.SetMaxFrameLength(cfg.MaxMessageSize)
+
+	rc := ws.NewReceptorController(cfg, gatewayCR, wsMux, rd, rs)
 	rc.Routes()
 
 	apiMux := mux.NewRouter()
@@ -145,12 +192,19 @@ func main() {
 	mgmtServer := api.NewManagementServer(localCM, apiMux, cfg)
 	mgmtServer.Routes()
 
-	jr := api.NewJobReceiver(localCM, apiMux, cfg)
+	// The rate of job submissions is limited by the job receiver before the
+	// jobs are forwarded to the gateway
+	jr := api.NewJobReceiver(localCM, jobRegistry, jobQueue, jobDeduplicator, nil, directiveSchemas, apiMux, cfg)
 	jr.Routes()
 
 	monitoringServer := api.NewMonitoringServer(apiMux, cfg)
 	monitoringServer.Routes()
 
+	dispatcherCtx, cancelDispatcher := context.WithCancel(context.Background())
+	defer cancelDispatcher()
+
+	startMessageDispatcher(dispatcherCtx, cfg, redisClient, localCM, jobRegistry, jobQueue)
+
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 
@@ -165,6 +219,8 @@ func main() {
 	sig := <-signalChan
 	logger.Log.Info("Received signal to shutdown: ", sig)
 
+	cancelDispatcher()
+
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.HttpShutdownTimeout)
 	defer cancel()
 
@@ -175,6 +231,60 @@ func main() {
 	logger.Log.Info("Receptor-Controller shutting down")
 }
 
+// startMessageDispatcher starts consuming the jobs topic.  The jobs for nodes
+// that are connected to other gateway pods are forwarded to those pods when
+// connections are registered with redis.
+func startMessageDispatcher(ctx context.Context, cfg *config.Config, redisClient *redis.Client, localCM c.ConnectionLocator, jobRegistry c.JobRegistry, jobQueue c.JobQueue) {
+	if cfg.JobDispatcherEnabled == false {
+		return
+	}
+
+	logger.Log.Info("Job dispatcher is enabled.  Jobs will be consumed from ", cfg.KafkaJobsTopic)
+
+	kr, err := queue.StartConsumer(&queue.ConsumerConfig{
+		Brokers:        cfg.KafkaBrokers,
+		SaslConfig:     buildKafkaSaslConfig(cfg),
+		Topic:          cfg.KafkaJobsTopic,
+		GroupID:        cfg.KafkaGroupID,
+		ConsumerOffset: cfg.KafkaConsumerOffset,
+	})
+	if err != nil {
+		logger.Log.Fatalf("Unable to start kafka consumer: %s\n", err)
+	}
+
+	var remoteConnections c.ConnectionLocator
+	if redisClient != nil {
+		remoteConnections = &api.RedisConnectionLocator{Client: redisClient, Cfg: cfg}
+	}
+
+	md := c.NewMessageDispatcher(kr, localCM, remoteConnections, jobRegistry, jobQueue, cfg)
+
+	go md.StartDispatchingMessages(ctx)
+}
+
+func configureResponseAggregator(cfg *config.Config) *c.ResponseAggregator {
+	if cfg.ResponseAggregationEnabled == false {
+		return nil
+	}
+
+	logger.Log.Info("Response aggregation is enabled.  Aggregated responses will be written to ",
+		cfg.KafkaAggregatedResponsesTopic)
+
+	kw, err := queue.StartProducer(&queue.ProducerConfig{
+		Brokers:    cfg.KafkaBrokers,
+		SaslConfig: buildKafkaSaslConfig(cfg),
+		Topic:      cfg.KafkaAggregatedResponsesTopic,
+		BatchSize:  cfg.KafkaResponsesBatchSize,
+		// An aggregated response can be as large as the largest message the broker accepts
+		BatchBytes: cfg.KafkaMaxMessageBytes,
+	})
+	if err != nil {
+		logger.Log.Fatalf("Unable to start kafka producer for aggregated responses: %s\n", err)
+	}
+
+	return c.NewResponseAggregator(kw, cfg)
+}
+
 func buildKafkaSaslConfig(cfg *config.Config) *queue.SaslConfig {
 
 	if cfg.KafkaSaslMechanism == "" {
@@ -88,7 +88,17 @@ func main() {
 	mgmtServer := api.NewManagementServer(connectionLocator, apiMux, cfg)
 	mgmtServer.Routes()
 
-	jr := api.NewJobReceiver(connectionLocator, apiMux, cfg)
+	jobRegistry := controller.NewRedisJobRegistry(redisClient, cfg)
+	jobQueue := controller.NewRedisJobQueue(redisClient, cfg)
+	jobDeduplicator := controller.NewRedisJobDeduplicator(redisClient, cfg)
+	jobRateLimiter := controller.NewRedisJobRateLimiter(redisClient)
+
+	directiveSchemas, err := controller.LoadDirectiveSchemas(cfg.DirectiveSchemaDir)
+	if err != nil {
+		logger.Log.Fatal("Unable to load the directive schemas: ", err)
+	}
+
+	jr := api.NewJobReceiver(connectionLocator, jobRegistry, jobQueue, jobDeduplicator, jobRateLimiter, directiveSchemas, apiMux, cfg)
 	jr.Routes()
 
 	apiSrv := utils.StartHTTPServer(mgmtAddr, "management", apiMux)
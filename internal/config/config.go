@@ -18,6 +18,8 @@ const (
 	PONG_WAIT                                          = "WebSocket_Pong_Wait"
 	PING_PERIOD                                        = "WebSocket_Ping_Period"
 	RECEPTOR_SYNC_PING_TIMEOUT                         = "Receptor_Sync_Ping_Timeout"
+	RECEPTOR_MESH_NODE_TTL                             = "Receptor_Mesh_Node_TTL"
+	RECEPTOR_MESH_TOPOLOGY_CACHE_TTL                   = "Receptor_Mesh_Topology_Cache_TTL"
 	HTTP_SHUTDOWN_TIMEOUT                              = "HTTP_Shutdown_Timeout"
 	MAX_MESSAGE_SIZE                                   = "WebSocket_Max_Message_Size"
 	SOCKET_BUFFER_SIZE                                 = "WebSocket_IO_Buffer_Size"
@@ -31,6 +33,40 @@ const (
 	RESPONSES_TOPIC                                    = "Kafka_Responses_Topic"
 	RESPONSES_BATCH_SIZE                               = "Kafka_Responses_Batch_Size"
 	RESPONSES_BATCH_BYTES                              = "Kafka_Responses_Batch_Bytes"
+	AGGREGATED_RESPONSES_TOPIC                         = "Kafka_Aggregated_Responses_Topic"
+	KAFKA_MAX_MESSAGE_BYTES                            = "Kafka_Max_Message_Bytes"
+	RESPONSE_AGGREGATION_ENABLED                       = "Response_Aggregation_Enabled"
+	RESPONSE_AGGREGATION_MAX_BYTES                     = "Response_Aggregation_Max_Bytes"
+	RESPONSE_AGGREGATION_MAX_BUFFERED_BYTES            = "Response_Aggregation_Max_Buffered_Bytes"
+	RESPONSE_AGGREGATION_TIMEOUT                       = "Response_Aggregation_Timeout"
+	JOB_REGISTRY_TTL                                   = "Job_Registry_TTL"
+	JOB_REGISTRY_JOB_TIMEOUT                           = "Job_Registry_Job_Timeout"
+	JOB_QUEUE_DEFAULT_TTL                              = "Job_Queue_Default_TTL"
+	JOB_QUEUE_MAX_TTL                                  = "Job_Queue_Max_TTL"
+	JOB_DISPATCHER_ENABLED                             = "Job_Dispatcher_Enabled"
+	JOB_DISPATCHER_RETRY_DELAY                         = "Job_Dispatcher_Retry_Delay"
+	JOB_DISPATCHER_MAX_ATTEMPTS                        = "Job_Dispatcher_Max_Attempts"
+	JOB_IDEMPOTENCY_WINDOW                             = "Job_Idempotency_Window"
+	CONTROL_LANE_BUFFER_SIZE                           = "WebSocket_Control_Lane_Buffer_Size"
+	INTERACTIVE_LANE_BUFFER_SIZE                       = "WebSocket_Interactive_Lane_Buffer_Size"
+	BULK_LANE_BUFFER_SIZE                              = "WebSocket_Bulk_Lane_Buffer_Size"
+	CONTROL_LANE_WEIGHT                                = "WebSocket_Control_Lane_Weight"
+	INTERACTIVE_LANE_WEIGHT                            = "WebSocket_Interactive_Lane_Weight"
+	BULK_LANE_WEIGHT                                   = "WebSocket_Bulk_Lane_Weight"
+	JOB_ACCOUNT_RATE_LIMIT                             = "Job_Account_Rate_Limit"
+	JOB_ACCOUNT_RATE_LIMIT_BURST                       = "Job_Account_Rate_Limit_Burst"
+	JOB_NODE_RATE_LIMIT                                = "Job_Node_Rate_Limit"
+	JOB_NODE_RATE_LIMIT_BURST                          = "Job_Node_Rate_Limit_Burst"
+	JOB_CLIENT_RATE_LIMIT                              = "Job_Client_Rate_Limit"
+	JOB_CLIENT_RATE_LIMIT_BURST                        = "Job_Client_Rate_Limit_Burst"
+	JOB_BROADCAST_MAX_CONCURRENCY                      = "Job_Broadcast_Max_Concurrency"
+	RECEPTOR_MAX_SEND_WAIT                             = "Receptor_Max_Send_Wait"
+	JOB_MAX_PAYLOAD_SIZE                               = "Job_Max_Payload_Size"
+	PAYLOAD_CHUNK_SIZE                                 = "Payload_Chunk_Size"
+	PAYLOAD_MAX_TRANSFER_SIZE                          = "Payload_Max_Transfer_Size"
+	PAYLOAD_TRANSFER_TIMEOUT                           = "Payload_Transfer_Timeout"
+	PAYLOAD_COMPRESSION                                = "Payload_Compression"
+	DIRECTIVE_SCHEMA_DIR                               = "Directive_Schema_Dir"
 	DEFAULT_BROKER_ADDRESS                             = "kafka:29092"
 	KAFKA_SASL_USERNAME                                = "Kafka_SASL_Username"
 	KAFKA_SASL_PASSWORD                                = "Kafka_SASL_Password"
@@ -45,6 +81,8 @@ const (
 	JOB_RECEIVER_RECEPTOR_PROXY_SCHEME                 = "Job_Receiver_Receptor_Proxy_Scheme"
 	JOB_RECEIVER_RECEPTOR_PROXY_PORT                   = "Job_Receiver_Receptor_Proxy_Port"
 	JOB_RECEIVER_RECEPTOR_PROXY_TIMEOUT                = "Job_Receiver_Receptor_Proxy_Timeout"
+	JOB_RECEIVER_SYNC_JOB_DEFAULT_TIMEOUT              = "Job_Receiver_Sync_Job_Default_Timeout"
+	JOB_RECEIVER_SYNC_JOB_MAX_TIMEOUT                  = "Job_Receiver_Sync_Job_Max_Timeout"
 	GATEWAY_CONNECTION_REGISTRAR_IMPL                  = "Gateway_Connection_Registrar_Impl"
 	GATEWAY_ACTIVE_CONNECTION_REGISTRAR_POLL_MIN_DELAY = "Gateway_Active_Connection_Registrar_Poll_Min_Delay"
 	GATEWAY_ACTIVE_CONNECTION_REGISTRAR_POLL_MAX_DELAY = "Gateway_Active_Connection_Registrar_Poll_Max_Delay"
@@ -59,6 +97,8 @@ type Config struct {
 	PongWait                                     time.Duration
 	PingPeriod                                   time.Duration
 	ReceptorSyncPingTimeout                      time.Duration
+	ReceptorMeshNodeTTL                          time.Duration
+	ReceptorMeshTopologyCacheTTL                 time.Duration
 	HttpShutdownTimeout                          time.Duration
 	MaxMessageSize                               int64
 	SocketBufferSize                             int
@@ -71,6 +111,40 @@ type Config struct {
 	KafkaResponsesTopic                          string
 	KafkaResponsesBatchSize                      int
 	KafkaResponsesBatchBytes                     int
+	KafkaAggregatedResponsesTopic                string
+	KafkaMaxMessageBytes                         int
+	ResponseAggregationEnabled                   bool
+	ResponseAggregationMaxBytes                  int
+	ResponseAggregationMaxBufferedBytes          int
+	ResponseAggregationTimeout                   time.Duration
+	JobRegistryTTL                               time.Duration
+	JobRegistryJobTimeout                        time.Duration
+	JobQueueDefaultTTL                           time.Duration
+	JobQueueMaxTTL                               time.Duration
+	JobDispatcherEnabled                         bool
+	JobDispatcherRetryDelay                      time.Duration
+	JobDispatcherMaxAttempts                     int
+	JobIdempotencyWindow                         time.Duration
+	ControlLaneBufferSize                        int
+	InteractiveLaneBufferSize                    int
+	BulkLaneBufferSize                           int
+	ControlLaneWeight                            int
+	InteractiveLaneWeight                        int
+	BulkLaneWeight                               int
+	JobAccountRateLimit                          float64
+	JobAccountRateLimitBurst                     int
+	JobNodeRateLimit                             float64
+	JobNodeRateLimitBurst                        int
+	JobClientRateLimit                           float64
+	JobClientRateLimitBurst                      int
+	JobBroadcastMaxConcurrency                   int
+	ReceptorMaxSendWait                          time.Duration
+	JobMaxPayloadSize                            int64
+	PayloadChunkSize                             int
+	PayloadMaxTransferSize                       int
+	PayloadTransferTimeout                       time.Duration
+	PayloadCompression                           string
+	DirectiveSchemaDir                           string
 	KafkaGroupID                                 string
 	KafkaConsumerOffset                          int64
 	KafkaSaslUsername                            string
@@ -86,6 +160,8 @@ type Config struct {
 	JobReceiverReceptorProxyScheme               string
 	JobReceiverReceptorProxyPort                 int
 	JobReceiverReceptorProxyTimeout              time.Duration
+	JobReceiverSyncJobDefaultTimeout             time.Duration
+	JobReceiverSyncJobMaxTimeout                 time.Duration
 	GatewayConnectionRegistrarImpl               string
 	GatewayActiveConnectionRegistrarPollMinDelay int
 	GatewayActiveConnectionRegistrarPollMaxDelay int
@@ -100,6 +176,8 @@ func (c Config) String() string {
 	fmt.Fprintf(&b, "%s: %s\n", PONG_WAIT, c.PongWait)
 	fmt.Fprintf(&b, "%s: %s\n", PING_PERIOD, c.PingPeriod)
 	fmt.Fprintf(&b, "%s: %s\n", RECEPTOR_SYNC_PING_TIMEOUT, c.ReceptorSyncPingTimeout)
+	fmt.Fprintf(&b, "%s: %s\n", RECEPTOR_MESH_NODE_TTL, c.ReceptorMeshNodeTTL)
+	fmt.Fprintf(&b, "%s: %s\n", RECEPTOR_MESH_TOPOLOGY_CACHE_TTL, c.ReceptorMeshTopologyCacheTTL)
 	fmt.Fprintf(&b, "%s: %s\n", HTTP_SHUTDOWN_TIMEOUT, c.HttpShutdownTimeout)
 	fmt.Fprintf(&b, "%s: %d\n", MAX_MESSAGE_SIZE, c.MaxMessageSize)
 	fmt.Fprintf(&b, "%s: %d\n", SOCKET_BUFFER_SIZE, c.SocketBufferSize)
@@ -111,6 +189,40 @@ func (c Config) String() string {
 	fmt.Fprintf(&b, "%s: %s\n", RESPONSES_TOPIC, c.KafkaResponsesTopic)
 	fmt.Fprintf(&b, "%s: %d\n", RESPONSES_BATCH_SIZE, c.KafkaResponsesBatchSize)
 	fmt.Fprintf(&b, "%s: %d\n", RESPONSES_BATCH_BYTES, c.KafkaResponsesBatchBytes)
+	fmt.Fprintf(&b, "%s: %s\n", AGGREGATED_RESPONSES_TOPIC, c.KafkaAggregatedResponsesTopic)
+	fmt.Fprintf(&b, "%s: %d\n", KAFKA_MAX_MESSAGE_BYTES, c.KafkaMaxMessageBytes)
+	fmt.Fprintf(&b, "%s: %t\n", RESPONSE_AGGREGATION_ENABLED, c.ResponseAggregationEnabled)
+	fmt.Fprintf(&b, "%s: %d\n", RESPONSE_AGGREGATION_MAX_BYTES, c.ResponseAggregationMaxBytes)
+	fmt.Fprintf(&b, "%s: %d\n", RESPONSE_AGGREGATION_MAX_BUFFERED_BYTES, c.ResponseAggregationMaxBufferedBytes)
+	fmt.Fprintf(&b, "%s: %s\n", RESPONSE_AGGREGATION_TIMEOUT, c.ResponseAggregationTimeout)
+	fmt.Fprintf(&b, "%s: %s\n", JOB_REGISTRY_TTL, c.JobRegistryTTL)
+	fmt.Fprintf(&b, "%s: %s\n", JOB_REGISTRY_JOB_TIMEOUT, c.JobRegistryJobTimeout)
+	fmt.Fprintf(&b, "%s: %s\n", JOB_QUEUE_DEFAULT_TTL, c.JobQueueDefaultTTL)
+	fmt.Fprintf(&b, "%s: %s\n", JOB_QUEUE_MAX_TTL, c.JobQueueMaxTTL)
+	fmt.Fprintf(&b, "%s: %t\n", JOB_DISPATCHER_ENABLED, c.JobDispatcherEnabled)
+	fmt.Fprintf(&b, "%s: %s\n", JOB_DISPATCHER_RETRY_DELAY, c.JobDispatcherRetryDelay)
+	fmt.Fprintf(&b, "%s: %d\n", JOB_DISPATCHER_MAX_ATTEMPTS, c.JobDispatcherMaxAttempts)
+	fmt.Fprintf(&b, "%s: %s\n", JOB_IDEMPOTENCY_WINDOW, c.JobIdempotencyWindow)
+	fmt.Fprintf(&b, "%s: %d\n", CONTROL_LANE_BUFFER_SIZE, c.ControlLaneBufferSize)
+	fmt.Fprintf(&b, "%s: %d\n", INTERACTIVE_LANE_BUFFER_SIZE, c.InteractiveLaneBufferSize)
+	fmt.Fprintf(&b, "%s: %d\n", BULK_LANE_BUFFER_SIZE, c.BulkLaneBufferSize)
+	fmt.Fprintf(&b, "%s: %d\n", CONTROL_LANE_WEIGHT, c.ControlLaneWeight)
+	fmt.Fprintf(&b, "%s: %d\n", INTERACTIVE_LANE_WEIGHT, c.InteractiveLaneWeight)
+	fmt.Fprintf(&b, "%s: %d\n", BULK_LANE_WEIGHT, c.BulkLaneWeight)
+	fmt.Fprintf(&b, "%s: %f\n", JOB_ACCOUNT_RATE_LIMIT, c.JobAccountRateLimit)
+	fmt.Fprintf(&b, "%s: %d\n", JOB_ACCOUNT_RATE_LIMIT_BURST, c.JobAccountRateLimitBurst)
+	fmt.Fprintf(&b, "%s: %f\n", JOB_NODE_RATE_LIMIT, c.JobNodeRateLimit)
+	fmt.Fprintf(&b, "%s: %d\n", JOB_NODE_RATE_LIMIT_BURST, c.JobNodeRateLimitBurst)
+	fmt.Fprintf(&b, "%s: %f\n", JOB_CLIENT_RATE_LIMIT, c.JobClientRateLimit)
+	fmt.Fprintf(&b, "%s: %d\n", JOB_CLIENT_RATE_LIMIT_BURST, c.JobClientRateLimitBurst)
+	fmt.Fprintf(&b, "%s: %d\n", JOB_BROADCAST_MAX_CONCURRENCY, c.JobBroadcastMaxConcurrency)
+	fmt.Fprintf(&b, "%s: %s\n", RECEPTOR_MAX_SEND_WAIT, c.ReceptorMaxSendWait)
+	fmt.Fprintf(&b, "%s: %d\n", JOB_MAX_PAYLOAD_SIZE, c.JobMaxPayloadSize)
+	fmt.Fprintf(&b, "%s: %d\n", PAYLOAD_CHUNK_SIZE, c.PayloadChunkSize)
+	fmt.Fprintf(&b, "%s: %d\n", PAYLOAD_MAX_TRANSFER_SIZE, c.PayloadMaxTransferSize)
+	fmt.Fprintf(&b, "%s: %s\n", PAYLOAD_TRANSFER_TIMEOUT, c.PayloadTransferTimeout)
+	fmt.Fprintf(&b, "%s: %s\n", PAYLOAD_COMPRESSION, c.PayloadCompression)
+	fmt.Fprintf(&b, "%s: %s\n", DIRECTIVE_SCHEMA_DIR, c.DirectiveSchemaDir)
 	fmt.Fprintf(&b, "%s: %s\n", JOBS_GROUP_ID, c.KafkaGroupID)
 	fmt.Fprintf(&b, "%s: %d\n", JOBS_CONSUMER_OFFSET, c.KafkaConsumerOffset)
 	fmt.Fprintf(&b, "%s: %s\n", KAFKA_SASL_MECHANISM, c.KafkaSaslMechanism)
@@ -122,6 +234,8 @@ func (c Config) String() string {
 	fmt.Fprintf(&b, "%s: %s\n", JOB_RECEIVER_RECEPTOR_PROXY_SCHEME, c.JobReceiverReceptorProxyScheme)
 	fmt.Fprintf(&b, "%s: %d\n", JOB_RECEIVER_RECEPTOR_PROXY_PORT, c.JobReceiverReceptorProxyPort)
 	fmt.Fprintf(&b, "%s: %s\n", JOB_RECEIVER_RECEPTOR_PROXY_TIMEOUT, c.JobReceiverReceptorProxyTimeout)
+	fmt.Fprintf(&b, "%s: %s\n", JOB_RECEIVER_SYNC_JOB_DEFAULT_TIMEOUT, c.JobReceiverSyncJobDefaultTimeout)
+	fmt.Fprintf(&b, "%s: %s\n", JOB_RECEIVER_SYNC_JOB_MAX_TIMEOUT, c.JobReceiverSyncJobMaxTimeout)
 	fmt.Fprintf(&b, "%s: %s\n", GATEWAY_CONNECTION_REGISTRAR_IMPL, c.GatewayConnectionRegistrarImpl)
 	fmt.Fprintf(&b, "%s: %d\n", GATEWAY_ACTIVE_CONNECTION_REGISTRAR_POLL_MIN_DELAY, c.GatewayActiveConnectionRegistrarPollMinDelay)
 	fmt.Fprintf(&b, "%s: %d\n", GATEWAY_ACTIVE_CONNECTION_REGISTRAR_POLL_MAX_DELAY, c.GatewayActiveConnectionRegistrarPollMaxDelay)
@@ -137,6 +251,8 @@ func GetConfig() *Config {
 	options.SetDefault(WRITE_WAIT, 5)
 	options.SetDefault(PONG_WAIT, 25)
 	options.SetDefault(RECEPTOR_SYNC_PING_TIMEOUT, 10)
+	options.SetDefault(RECEPTOR_MESH_NODE_TTL, 120)
+	options.SetDefault(RECEPTOR_MESH_TOPOLOGY_CACHE_TTL, 10)
 	options.SetDefault(HTTP_SHUTDOWN_TIMEOUT, 2)
 	options.SetDefault(MAX_MESSAGE_SIZE, 1*1024*1024)
 	options.SetDefault(SOCKET_BUFFER_SIZE, 1024)
@@ -149,6 +265,40 @@ func GetConfig() *Config {
 	options.SetDefault(RESPONSES_TOPIC, "platform.receptor-controller.responses")
 	options.SetDefault(RESPONSES_BATCH_SIZE, 100)
 	options.SetDefault(RESPONSES_BATCH_BYTES, 1048576)
+	options.SetDefault(AGGREGATED_RESPONSES_TOPIC, "platform.receptor-controller.aggregated-responses")
+	options.SetDefault(KAFKA_MAX_MESSAGE_BYTES, 1048576)
+	options.SetDefault(RESPONSE_AGGREGATION_ENABLED, false)
+	options.SetDefault(RESPONSE_AGGREGATION_MAX_BYTES, 1048576)
+	options.SetDefault(RESPONSE_AGGREGATION_MAX_BUFFERED_BYTES, 67108864)
+	options.SetDefault(RESPONSE_AGGREGATION_TIMEOUT, 300)
+	options.SetDefault(JOB_REGISTRY_TTL, 86400)
+	options.SetDefault(JOB_REGISTRY_JOB_TIMEOUT, 3600)
+	options.SetDefault(JOB_QUEUE_DEFAULT_TTL, 3600)
+	options.SetDefault(JOB_QUEUE_MAX_TTL, 604800)
+	options.SetDefault(JOB_DISPATCHER_ENABLED, false)
+	options.SetDefault(JOB_DISPATCHER_RETRY_DELAY, 5)
+	options.SetDefault(JOB_DISPATCHER_MAX_ATTEMPTS, 12)
+	options.SetDefault(JOB_IDEMPOTENCY_WINDOW, 86400)
+	options.SetDefault(CONTROL_LANE_BUFFER_SIZE, 10)
+	options.SetDefault(INTERACTIVE_LANE_BUFFER_SIZE, 10)
+	options.SetDefault(BULK_LANE_BUFFER_SIZE, 100)
+	options.SetDefault(CONTROL_LANE_WEIGHT, 8)
+	options.SetDefault(INTERACTIVE_LANE_WEIGHT, 4)
+	options.SetDefault(BULK_LANE_WEIGHT, 1)
+	options.SetDefault(JOB_ACCOUNT_RATE_LIMIT, 100)
+	options.SetDefault(JOB_ACCOUNT_RATE_LIMIT_BURST, 200)
+	options.SetDefault(JOB_NODE_RATE_LIMIT, 10)
+	options.SetDefault(JOB_NODE_RATE_LIMIT_BURST, 50)
+	options.SetDefault(JOB_CLIENT_RATE_LIMIT, 500)
+	options.SetDefault(JOB_CLIENT_RATE_LIMIT_BURST, 1000)
+	options.SetDefault(JOB_BROADCAST_MAX_CONCURRENCY, 10)
+	options.SetDefault(RECEPTOR_MAX_SEND_WAIT, 1000)
+	options.SetDefault(JOB_MAX_PAYLOAD_SIZE, 16*1024*1024)
+	options.SetDefault(PAYLOAD_CHUNK_SIZE, 512*1024)
+	options.SetDefault(PAYLOAD_MAX_TRANSFER_SIZE, 16*1024*1024)
+	options.SetDefault(PAYLOAD_TRANSFER_TIMEOUT, 60)
+	options.SetDefault(PAYLOAD_COMPRESSION, "zstd,gzip")
+	options.SetDefault(DIRECTIVE_SCHEMA_DIR, "")
 	options.SetDefault(JOBS_GROUP_ID, "receptor-controller")
 	options.SetDefault(JOBS_CONSUMER_OFFSET, -1)
 	options.SetDefault(REDIS_HOST, "localhost")
@@ -160,6 +310,8 @@ func GetConfig() *Config {
 	options.SetDefault(JOB_RECEIVER_RECEPTOR_PROXY_SCHEME, "http")
 	options.SetDefault(JOB_RECEIVER_RECEPTOR_PROXY_PORT, 9090)
 	options.SetDefault(JOB_RECEIVER_RECEPTOR_PROXY_TIMEOUT, 10)
+	options.SetDefault(JOB_RECEIVER_SYNC_JOB_DEFAULT_TIMEOUT, 30)
+	options.SetDefault(JOB_RECEIVER_SYNC_JOB_MAX_TIMEOUT, 300)
 	options.SetDefault(GATEWAY_CONNECTION_REGISTRAR_IMPL, "local")
 	options.SetDefault(GATEWAY_ACTIVE_CONNECTION_REGISTRAR_POLL_MIN_DELAY, 5*1000)
 	options.SetDefault(GATEWAY_ACTIVE_CONNECTION_REGISTRAR_POLL_MAX_DELAY, 10*1000)
@@ -178,6 +330,8 @@ func GetConfig() *Config {
 		PongWait:                         pongWait,
 		PingPeriod:                       pingPeriod,
 		ReceptorSyncPingTimeout:          options.GetDuration(RECEPTOR_SYNC_PING_TIMEOUT) * time.Second,
+		ReceptorMeshNodeTTL:              options.GetDuration(RECEPTOR_MESH_NODE_TTL) * time.Second,
+		ReceptorMeshTopologyCacheTTL:     options.GetDuration(RECEPTOR_MESH_TOPOLOGY_CACHE_TTL) * time.Second,
 		HttpShutdownTimeout:              options.GetDuration(HTTP_SHUTDOWN_TIMEOUT) * time.Second,
 		MaxMessageSize:                   options.GetInt64(MAX_MESSAGE_SIZE),
 		SocketBufferSize:                 options.GetInt(SOCKET_BUFFER_SIZE),
@@ -205,11 +359,47 @@ func GetConfig() *Config {
 		JobReceiverReceptorProxyScheme:   options.GetString(JOB_RECEIVER_RECEPTOR_PROXY_SCHEME),
 		JobReceiverReceptorProxyPort:     options.GetInt(JOB_RECEIVER_RECEPTOR_PROXY_PORT),
 		JobReceiverReceptorProxyTimeout:  options.GetDuration(JOB_RECEIVER_RECEPTOR_PROXY_TIMEOUT) * time.Second,
+		JobReceiverSyncJobDefaultTimeout: options.GetDuration(JOB_RECEIVER_SYNC_JOB_DEFAULT_TIMEOUT) * time.Second,
+		JobReceiverSyncJobMaxTimeout:     options.GetDuration(JOB_RECEIVER_SYNC_JOB_MAX_TIMEOUT) * time.Second,
 		GatewayConnectionRegistrarImpl:   options.GetString(GATEWAY_CONNECTION_REGISTRAR_IMPL),
 		GatewayActiveConnectionRegistrarPollMinDelay: options.GetInt(GATEWAY_ACTIVE_CONNECTION_REGISTRAR_POLL_MIN_DELAY),
 		GatewayActiveConnectionRegistrarPollMaxDelay: options.GetInt(GATEWAY_ACTIVE_CONNECTION_REGISTRAR_POLL_MAX_DELAY),
 		GatewayClusterServiceName:                    options.GetString(GATEWAY_CLUSTER_SERVICE_NAME),
 		PrometheusPushGateway:                        options.GetString(PROMETHEUS_PUSH_GATEWAY),
+		KafkaAggregatedResponsesTopic:                options.GetString(AGGREGATED_RESPONSES_TOPIC),
+		KafkaMaxMessageBytes:                         options.GetInt(KAFKA_MAX_MESSAGE_BYTES),
+		ResponseAggregationEnabled:                   options.GetBool(RESPONSE_AGGREGATION_ENABLED),
+		ResponseAggregationMaxBytes:                  options.GetInt(RESPONSE_AGGREGATION_MAX_BYTES),
+		ResponseAggregationMaxBufferedBytes:          options.GetInt(RESPONSE_AGGREGATION_MAX_BUFFERED_BYTES),
+		ResponseAggregationTimeout:                   options.GetDuration(RESPONSE_AGGREGATION_TIMEOUT) * time.Second,
+		JobRegistryTTL:                               options.GetDuration(JOB_REGISTRY_TTL) * time.Second,
+		JobRegistryJobTimeout:                        options.GetDuration(JOB_REGISTRY_JOB_TIMEOUT) * time.Second,
+		JobQueueDefaultTTL:                           options.GetDuration(JOB_QUEUE_DEFAULT_TTL) * time.Second,
+		JobQueueMaxTTL:                               options.GetDuration(JOB_QUEUE_MAX_TTL) * time.Second,
+		JobDispatcherEnabled:                         options.GetBool(JOB_DISPATCHER_ENABLED),
+		JobDispatcherRetryDelay:                      options.GetDuration(JOB_DISPATCHER_RETRY_DELAY) * time.Second,
+		JobDispatcherMaxAttempts:                     options.GetInt(JOB_DISPATCHER_MAX_ATTEMPTS),
+		JobIdempotencyWindow:                         options.GetDuration(JOB_IDEMPOTENCY_WINDOW) * time.Second,
+		ControlLaneBufferSize:                        options.GetInt(CONTROL_LANE_BUFFER_SIZE),
+		InteractiveLaneBufferSize:                    options.GetInt(INTERACTIVE_LANE_BUFFER_SIZE),
+		BulkLaneBufferSize:                           options.GetInt(BULK_LANE_BUFFER_SIZE),
+		ControlLaneWeight:                            options.GetInt(CONTROL_LANE_WEIGHT),
+		InteractiveLaneWeight:                        options.GetInt(INTERACTIVE_LANE_WEIGHT),
+		BulkLaneWeight:                               options.GetInt(BULK_LANE_WEIGHT),
+		JobAccountRateLimit:                          options.GetFloat64(JOB_ACCOUNT_RATE_LIMIT),
+		JobAccountRateLimitBurst:                     options.GetInt(JOB_ACCOUNT_RATE_LIMIT_BURST),
+		JobNodeRateLimit:                             options.GetFloat64(JOB_NODE_RATE_LIMIT),
+		JobNodeRateLimitBurst:                        options.GetInt(JOB_NODE_RATE_LIMIT_BURST),
+		JobClientRateLimit:                           options.GetFloat64(JOB_CLIENT_RATE_LIMIT),
+		JobClientRateLimitBurst:                      options.GetInt(JOB_CLIENT_RATE_LIMIT_BURST),
+		JobBroadcastMaxConcurrency:                   options.GetInt(JOB_BROADCAST_MAX_CONCURRENCY),
+		ReceptorMaxSendWait:                          options.GetDuration(RECEPTOR_MAX_SEND_WAIT) * time.Millisecond,
+		JobMaxPayloadSize:                            options.GetInt64(JOB_MAX_PAYLOAD_SIZE),
+		PayloadChunkSize:                             options.GetInt(PAYLOAD_CHUNK_SIZE),
+		PayloadMaxTransferSize:                       options.GetInt(PAYLOAD_MAX_TRANSFER_SIZE),
+		PayloadTransferTimeout:                       options.GetDuration(PAYLOAD_TRANSFER_TIMEOUT) * time.Second,
+		PayloadCompression:                           options.GetString(PAYLOAD_COMPRESSION),
+		DirectiveSchemaDir:                           options.GetString(DIRECTIVE_SCHEMA_DIR),
 	}
 
 	if clowder.IsClowderEnabled() {
@@ -221,6 +411,14 @@ func GetConfig() *Config {
 		config.KafkaBrokers = clowder.KafkaServers
 		config.KafkaResponsesTopic = clowder.KafkaTopics["platform.receptor-controller.responses"].Name
 
+		if topic, exists := clowder.KafkaTopics["platform.receptor-controller.aggregated-responses"]; exists {
+			config.KafkaAggregatedResponsesTopic = topic.Name
+		}
+
+		if topic, exists := clowder.KafkaTopics["platform.receptor-controller.jobs"]; exists {
+			config.KafkaJobsTopic = topic.Name
+		}
+
 		if broker.Authtype != nil {
 
 			config.KafkaSaslUsername = *broker.Sasl.Username
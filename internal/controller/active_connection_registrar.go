@@ -46,15 +46,13 @@ func buildCancelMapKey(account, nodeID string) string {
 }
 
 func NewActiveConnectionRegistrarFactory(cfg *config.Config, rdc *redis.Client, hostname string) ActiveConnectionRegistrarFactory {
-	cancelFuncsMap := cancellationMap{
-		cancelFuncs: make(map[string]context.CancelFunc),
-	}
-
 	factory := RedisActiveConnectionRegistrarFactory{
-		config:          cfg,
-		redisClient:     rdc,
-		hostname:        hostname,
-		cancellationMap: cancelFuncsMap,
+		config:      cfg,
+		redisClient: rdc,
+		hostname:    hostname,
+		cancellationMap: cancellationMap{
+			cancelFuncs: make(map[string]context.CancelFunc),
+		},
 	}
 
 	return &factory
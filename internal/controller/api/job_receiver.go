@@ -1,7 +1,14 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
 	"github.com/RedHatInsights/platform-receptor-controller/internal/controller"
@@ -9,21 +16,39 @@ import (
 	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
 	"github.com/redhatinsights/platform-go-middlewares/request_id"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
+const idempotencyKeyHeader = "Idempotency-Key"
+
 type JobReceiver struct {
-	connectionMgr controller.ConnectionLocator
-	router        *mux.Router
-	config        *config.Config
+	connectionMgr    controller.ConnectionLocator
+	meshLocator      *controller.MeshConnectionLocator
+	jobRegistry      controller.JobRegistry
+	jobQueue         controller.JobQueue
+	jobDeduplicator  controller.JobDeduplicator
+	jobRateLimiter   controller.JobRateLimiter
+	directiveSchemas *controller.DirectiveSchemaRegistry
+	router           *mux.Router
+	config           *config.Config
 }
 
-func NewJobReceiver(cm controller.ConnectionLocator, r *mux.Router, cfg *config.Config) *JobReceiver {
+// NewJobReceiver creates a JobReceiver.  The job rate limiter is optional.
+// The rate of job submissions is not limited if it is nil.  The directive
+// schema registry is optional.  Payloads are not validated if it is nil.
+func NewJobReceiver(cm controller.ConnectionLocator, jobRegistry controller.JobRegistry, jobQueue controller.JobQueue, jobDeduplicator controller.JobDeduplicator, jobRateLimiter controller.JobRateLimiter, directiveSchemas *controller.DirectiveSchemaRegistry, r *mux.Router, cfg *config.Config) *JobReceiver {
 	return &JobReceiver{
-		connectionMgr: cm,
-		router:        r,
-		config:        cfg,
+		connectionMgr:    cm,
+		meshLocator:      controller.NewMeshConnectionLocator(cm, cfg),
+		jobRegistry:      jobRegistry,
+		jobQueue:         jobQueue,
+		jobDeduplicator:  jobDeduplicator,
+		jobRateLimiter:   jobRateLimiter,
+		directiveSchemas: directiveSchemas,
+		router:           r,
+		config:           cfg,
 	}
 }
 
@@ -37,6 +62,11 @@ func (jr *JobReceiver) Routes() {
 		amw.Authenticate)
 
 	securedSubRouter.HandleFunc("/job", jr.handleJob()).Methods(http.MethodPost)
+	securedSubRouter.HandleFunc("/job/sync", jr.handleJobSync()).Methods(http.MethodPost)
+	securedSubRouter.HandleFunc("/job/stream", jr.handleJobStream()).Methods(http.MethodPost)
+	securedSubRouter.HandleFunc("/job/broadcast", jr.handleJobBroadcast()).Methods(http.MethodPost)
+	securedSubRouter.HandleFunc("/job/{id}", jr.handleJobStatus()).Methods(http.MethodGet)
+	securedSubRouter.HandleFunc("/job/{id}/cancel", jr.handleJobCancel()).Methods(http.MethodPost)
 }
 
 type jobRequest struct {
@@ -46,8 +76,81 @@ type jobRequest struct {
 	Directive string      `json:"directive" validate:"required"`
 }
 
+// queueableJobRequest is sent to a fixed recipient or to a node that is
+// selected by its capabilities
+type queueableJobRequest struct {
+	Account        string                       `json:"account" validate:"required"`
+	Recipient      string                       `json:"recipient,omitempty" validate:"required_without=Capability"`
+	Capability     *controller.CapabilityFilter `json:"capability,omitempty" validate:"required_without=Recipient"`
+	Payload        interface{}                  `json:"payload" validate:"required"`
+	Directive      string                       `json:"directive" validate:"required"`
+	ID             string                       `json:"id,omitempty" validate:"omitempty,uuid"`
+	JobKey         string                       `json:"job_key,omitempty" validate:"max=255"`
+	Lane           string                       `json:"lane,omitempty" validate:"omitempty,oneof=interactive bulk"`
+	QueueIfOffline bool                         `json:"queue_if_offline,omitempty"`
+	TTL            int                          `json:"ttl,omitempty" validate:"gte=0"`
+}
+
 type jobResponse struct {
-	JobID string `json:"id"`
+	JobID     string `json:"id"`
+	Recipient string `json:"recipient,omitempty"`
+}
+
+type connectionOverloadedResponse struct {
+	errorResponse
+	Lane          controller.Lane `json:"lane"`
+	QueueDepth    int             `json:"queue_depth"`
+	QueueCapacity int             `json:"queue_capacity"`
+}
+
+// schemaViolationResponse lists the ways in which a payload does not match
+// the schema of its directive
+type schemaViolationResponse struct {
+	errorResponse
+	Violations []string `json:"violations"`
+}
+
+// remoteSchemaViolationError is a schema violation that was reported by the
+// gateway that the job was passed to
+type remoteSchemaViolationError struct {
+	response schemaViolationResponse
+}
+
+func (e *remoteSchemaViolationError) Error() string {
+	return e.response.Detail
+}
+
+type jobSyncRequest struct {
+	jobRequest
+	Timeout int `json:"timeout,omitempty" validate:"gte=0"`
+}
+
+type jobSyncResponse struct {
+	JobID     string                       `json:"id"`
+	Status    string                       `json:"status"`
+	Responses []controller.ResponseMessage `json:"responses"`
+}
+
+type jobStreamEndResponse struct {
+	JobID  string `json:"id"`
+	Status string `json:"status"`
+}
+
+type jobBroadcastRequest struct {
+	Account    string                       `json:"account" validate:"required"`
+	Payload    interface{}                  `json:"payload" validate:"required"`
+	Directive  string                       `json:"directive" validate:"required"`
+	Capability *controller.CapabilityFilter `json:"capability,omitempty"`
+	Lane       string                       `json:"lane,omitempty" validate:"omitempty,oneof=interactive bulk"`
+}
+
+type jobBroadcastResult struct {
+	JobID string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type jobBroadcastResponse struct {
+	Results map[string]jobBroadcastResult `json:"results"`
 }
 
 func (jr *JobReceiver) handleJob() http.HandlerFunc {
@@ -60,9 +163,9 @@ func (jr *JobReceiver) handleJob() http.HandlerFunc {
 			"account":    principal.GetAccount(),
 			"request_id": requestId})
 
-		var jobRequest jobRequest
+		var jobRequest queueableJobRequest
 
-		body := http.MaxBytesReader(w, req.Body, 1048576)
+		body := http.MaxBytesReader(w, req.Body, jr.config.JobMaxPayloadSize)
 
 		if err := decodeJSON(body, &jobRequest); err != nil {
 			errMsg := "Unable to process json input"
@@ -74,19 +177,488 @@ func (jr *JobReceiver) handleJob() http.HandlerFunc {
 			return
 		}
 
+		if jr.validatePayload(logger, w, jobRequest.Directive, jobRequest.Payload) == false {
+			return
+		}
+
+		if jobRequest.Recipient != "" && jobRequest.Capability != nil {
+			errMsg := "Conflicting recipients"
+			logger.Debug(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: "Either the recipient or the capability selector must be provided, not both"}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if jobRequest.Capability != nil && jobRequest.QueueIfOffline {
+			errMsg := "Unable to queue the job"
+			logger.Debug(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: "A job whose recipient is selected by capability cannot be queued"}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		ttl := jr.config.JobQueueDefaultTTL
+		if jobRequest.TTL > 0 {
+			ttl = time.Duration(jobRequest.TTL) * time.Second
+		}
+
+		if jobRequest.QueueIfOffline && ttl > jr.config.JobQueueMaxTTL {
+			errMsg := "Invalid ttl"
+			logger.WithFields(logrus.Fields{"ttl": ttl}).Debug(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: fmt.Sprintf("The ttl must not exceed %d seconds", int(jr.config.JobQueueMaxTTL.Seconds()))}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		// The id is assigned by the submitter when the job was submitted
+		// through the jobs topic.  Only the job dispatcher may pass it on.
+		// Otherwise, any caller could take over the responses of a job by
+		// reusing its id.
+		if jobRequest.ID != "" && jr.isReceptorProxy(principal) == false {
+			errMsg := "Unable to set the job id"
+			logger.Info(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusForbidden,
+				Detail: "The job id can only be set by the job dispatcher"}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		jobID, err := uuid.NewRandom()
+		if jobRequest.ID != "" {
+			jobID, err = uuid.Parse(jobRequest.ID)
+		}
+
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Info("Unable to determine the job id")
+			errorResponse := errorResponse{Title: "Unable to determine the job id",
+				Status: http.StatusInternalServerError,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		idempotencyKey := req.Header.Get(idempotencyKeyHeader)
+		if idempotencyKey != "" && jobRequest.JobKey != "" && idempotencyKey != jobRequest.JobKey {
+			errMsg := "Conflicting idempotency keys"
+			logger.Debug(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: fmt.Sprintf("The %s header and the job_key field must match", idempotencyKeyHeader)}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		} else if idempotencyKey == "" {
+			idempotencyKey = jobRequest.JobKey
+		}
+
+		if idempotencyKey != "" {
+			logger = logger.WithFields(logrus.Fields{"idempotency_key": idempotencyKey})
+
+			existingJobID, reserved, err := jr.jobDeduplicator.Reserve(req.Context(), jobRequest.Account, idempotencyKey, jobID.String())
+			if err != nil {
+				logger.WithFields(logrus.Fields{"error": err}).Info("Unable to reserve the idempotency key")
+				errorResponse := errorResponse{Title: "Unable to reserve the idempotency key",
+					Status: http.StatusInternalServerError,
+					Detail: err.Error()}
+				writeJSONResponse(w, errorResponse.Status, errorResponse)
+				return
+			}
+
+			if reserved == false {
+				logger.WithFields(logrus.Fields{"message_id": existingJobID}).Info("Job was already submitted")
+				writeJSONResponse(w, http.StatusOK, jobResponse{JobID: existingJobID})
+				return
+			}
+		}
+
+		submitted := false
+
+		// Forget the idempotency key if the job was not submitted so that the
+		// submission can be retried
+		defer func() {
+			if idempotencyKey == "" || submitted {
+				return
+			}
+
+			err := jr.jobDeduplicator.Release(context.Background(), jobRequest.Account, idempotencyKey, jobID.String())
+			if err != nil {
+				logger.WithFields(logrus.Fields{"error": err}).Warn("Unable to release the idempotency key")
+			}
+		}()
+
 		var client controller.Receptor
-		client = jr.connectionMgr.GetConnection(req.Context(), jobRequest.Account, jobRequest.Recipient)
+		var route []string
+
+		if jobRequest.Capability != nil {
+			jobRequest.Recipient, client = controller.LocateConnectionByCapability(req.Context(), jr.connectionMgr, jobRequest.Account, jobRequest.Capability)
+			if client == nil {
+				errMsg := "No connected node matches the capability selector"
+				logger.WithFields(logrus.Fields{"worker": jobRequest.Capability.Worker,
+					"min_version": jobRequest.Capability.MinVersion}).Info(errMsg)
+				errorResponse := errorResponse{Title: errMsg,
+					Status: http.StatusNotFound,
+					Detail: errMsg}
+				writeJSONResponse(w, errorResponse.Status, errorResponse)
+				return
+			}
+			route = []string{jobRequest.Recipient}
+		}
+
+		if jr.limitJobRate(req.Context(), logger, w, principal, jobRequest.Account, jobRequest.Recipient) == false {
+			return
+		}
+
+		lane := controller.LaneInteractive
+		if jobRequest.Lane != "" {
+			lane = controller.Lane(jobRequest.Lane)
+		}
+
 		if client == nil {
+			client, route = jr.meshLocator.LocateConnectionToNode(req.Context(), jobRequest.Account, jobRequest.Recipient)
+		}
+
+		if client == nil {
+			if jobRequest.QueueIfOffline {
+				submitted = jr.queueJob(req.Context(), logger, w, jobID, jobRequest, lane, ttl)
+				return
+			}
 			writeConnectionFailureResponse(logger, w)
 			return
 		}
 
 		logger = logger.WithFields(logrus.Fields{"recipient": jobRequest.Recipient,
-			"directive": jobRequest.Directive})
+			"directive":  jobRequest.Directive,
+			"route_list": route,
+			"lane":       lane})
 		logger.Info("Sending a message")
 
-		jobID, err := client.SendMessage(req.Context(), jobRequest.Account, jobRequest.Recipient,
-			[]string{jobRequest.Recipient},
+		err = client.SendMessageWithID(controller.WithLane(req.Context(), lane), jobID, jobRequest.Account, jobRequest.Recipient,
+			route,
+			jobRequest.Payload,
+			jobRequest.Directive)
+
+		if err == errDisconnectedNode {
+			if jobRequest.QueueIfOffline {
+				submitted = jr.queueJob(req.Context(), logger, w, jobID, jobRequest, lane, ttl)
+				return
+			}
+			writeConnectionFailureResponse(logger, w)
+			return
+		}
+
+		if err != nil {
+			writeSendFailureResponse(logger, w, "Error passing message to receptor", err)
+			return
+		}
+
+		submitted = true
+
+		logger.WithFields(logrus.Fields{"message_id": jobID}).Info("Message sent")
+
+		jobResponse := jobResponse{JobID: jobID.String()}
+
+		// Let the caller know which node was selected
+		if jobRequest.Capability != nil {
+			jobResponse.Recipient = jobRequest.Recipient
+		}
+
+		writeJSONResponse(w, http.StatusCreated, jobResponse)
+	}
+}
+
+// isReceptorProxy reports whether the request was sent by a
+// ReceptorHttpProxy, i.e. by the job dispatcher forwarding a job to the
+// gateway that the recipient is connected to
+func (jr *JobReceiver) isReceptorProxy(principal middlewares.Principal) bool {
+	clientPrincipal, ok := principal.(middlewares.ClientPrincipal)
+	return ok && clientPrincipal.GetClientID() == jr.config.JobReceiverReceptorProxyClientID
+}
+
+// queueJob stores the job until the recipient connects.  false is returned if
+// the job could not be queued.
+func (jr *JobReceiver) queueJob(ctx context.Context, logger *logrus.Entry, w http.ResponseWriter, jobID uuid.UUID, jobRequest queueableJobRequest, lane controller.Lane, ttl time.Duration) bool {
+	now := time.Now().UTC()
+
+	queuedJob := controller.QueuedJob{
+		MessageID: jobID.String(),
+		Account:   jobRequest.Account,
+		Recipient: jobRequest.Recipient,
+		Payload:   jobRequest.Payload,
+		Directive: jobRequest.Directive,
+		Lane:      lane,
+		QueuedAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	logger = logger.WithFields(logrus.Fields{"recipient": jobRequest.Recipient,
+		"directive":  jobRequest.Directive,
+		"message_id": queuedJob.MessageID,
+		"ttl":        ttl})
+
+	// Register the job before it is queued so that the record cannot
+	// overwrite the state of a job that is delivered right away
+	err := jr.jobRegistry.Register(ctx, queuedJob.JobRecord())
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Warn("Unable to register the queued job")
+	}
+
+	err = jr.jobQueue.Enqueue(ctx, queuedJob)
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Info("Error queueing the job")
+		errorResponse := errorResponse{Title: "Error queueing the job",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error()}
+		writeJSONResponse(w, errorResponse.Status, errorResponse)
+		return false
+	}
+
+	logger.Info("Recipient is offline.  Queued the job.")
+
+	writeJSONResponse(w, http.StatusAccepted, jobResponse{JobID: queuedJob.MessageID})
+
+	return true
+}
+
+// takeJobRateLimitTokens takes a token from each of the rate limits that
+// apply to the job submission.  If the submission exceeds one of the limits,
+// false is returned along with the scope of the limit and the number of
+// seconds until the job can be submitted again.  Submissions are not limited
+// if the limits cannot be checked.
+func (jr *JobReceiver) takeJobRateLimitTokens(ctx context.Context, logger *logrus.Entry, principal middlewares.Principal, account string, recipient string) (bool, string, int) {
+	if jr.jobRateLimiter == nil {
+		return true, "", 0
+	}
+
+	var clientID string
+	if clientPrincipal, ok := principal.(middlewares.ClientPrincipal); ok {
+		clientID = clientPrincipal.GetClientID()
+	}
+
+	limits := controller.JobRateLimits(jr.config, account, recipient, clientID)
+
+	allowed, scope, wait, err := jr.jobRateLimiter.Take(ctx, limits)
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Warn("Unable to check the job rate limits")
+		return true, "", 0
+	}
+
+	if allowed {
+		return true, "", 0
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	logger.WithFields(logrus.Fields{"recipient": recipient,
+		"rate_limit":  scope,
+		"retry_after": retryAfter}).Info("Job submission was rate limited")
+
+	return false, scope, retryAfter
+}
+
+// limitJobRate writes a 429 and returns false if the job submission exceeds
+// one of the rate limits
+func (jr *JobReceiver) limitJobRate(ctx context.Context, logger *logrus.Entry, w http.ResponseWriter, principal middlewares.Principal, account string, recipient string) bool {
+	allowed, scope, retryAfter := jr.takeJobRateLimitTokens(ctx, logger, principal, account, recipient)
+	if allowed {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	errorResponse := errorResponse{Title: "Too many jobs submitted",
+		Status: http.StatusTooManyRequests,
+		Detail: rateLimitExceededDetail(scope, retryAfter)}
+	writeJSONResponse(w, errorResponse.Status, errorResponse)
+
+	return false
+}
+
+// validatePayload writes a 400 and returns false if the payload does not
+// match the schema of the directive
+func (jr *JobReceiver) validatePayload(logger *logrus.Entry, w http.ResponseWriter, directive string, payload interface{}) bool {
+	err := jr.directiveSchemas.ValidatePayload(directive, payload)
+	if err == nil {
+		return true
+	}
+
+	errMsg := "Payload does not match the schema of the directive"
+	logger.WithFields(logrus.Fields{"directive": directive, "error": err}).Info(errMsg)
+
+	writeSchemaViolationResponse(w, http.StatusBadRequest, errMsg, err)
+
+	return false
+}
+
+func writeSchemaViolationResponse(w http.ResponseWriter, status int, title string, err error) {
+	errorResponse := schemaViolationResponse{errorResponse: errorResponse{Title: title,
+		Status: status,
+		Detail: err.Error()}}
+
+	var violationErr *controller.DirectiveSchemaViolationError
+	if errors.As(err, &violationErr) {
+		errorResponse.Violations = violationErr.Violations
+	}
+
+	writeJSONResponse(w, errorResponse.Status, errorResponse)
+}
+
+func rateLimitExceededDetail(scope string, retryAfter int) string {
+	return fmt.Sprintf("The %s rate limit was exceeded.  Retry after %d seconds", scope, retryAfter)
+}
+
+func (jr *JobReceiver) handleJobSync() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId})
+
+		var jobRequest jobSyncRequest
+
+		body := http.MaxBytesReader(w, req.Body, jr.config.JobMaxPayloadSize)
+
+		if err := decodeJSON(body, &jobRequest); err != nil {
+			errMsg := "Unable to process json input"
+			logger.WithFields(logrus.Fields{"error": err}).Debug(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if jr.validatePayload(logger, w, jobRequest.Directive, jobRequest.Payload) == false {
+			return
+		}
+
+		timeout := jr.config.JobReceiverSyncJobDefaultTimeout
+		if jobRequest.Timeout > 0 {
+			timeout = time.Duration(jobRequest.Timeout) * time.Second
+		}
+
+		if timeout > jr.config.JobReceiverSyncJobMaxTimeout {
+			errMsg := "Invalid timeout"
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: fmt.Sprintf("The timeout must not exceed %d seconds", int(jr.config.JobReceiverSyncJobMaxTimeout.Seconds()))}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if jr.limitJobRate(req.Context(), logger, w, principal, jobRequest.Account, jobRequest.Recipient) == false {
+			return
+		}
+
+		client, route := jr.meshLocator.LocateConnectionToNode(req.Context(), jobRequest.Account, jobRequest.Recipient)
+		if client == nil {
+			writeConnectionFailureResponse(logger, w)
+			return
+		}
+
+		logger = logger.WithFields(logrus.Fields{"recipient": jobRequest.Recipient,
+			"directive":  jobRequest.Directive,
+			"route_list": route,
+			"timeout":    timeout})
+		logger.Info("Sending a message and waiting for the response")
+
+		syncJobResponse, err := client.SendMessageSync(req.Context(), jobRequest.Account, jobRequest.Recipient,
+			route,
+			jobRequest.Payload,
+			jobRequest.Directive,
+			timeout)
+
+		if err == errDisconnectedNode {
+			writeConnectionFailureResponse(logger, w)
+			return
+		}
+
+		if err != nil {
+			writeSendFailureResponse(logger, w, "Error passing message to receptor", err)
+			return
+		}
+
+		logger.WithFields(logrus.Fields{"message_id": syncJobResponse.MessageID,
+			"status":         syncJobResponse.Status,
+			"response_count": len(syncJobResponse.Responses)}).Info("Finished waiting for the response")
+
+		jobResponse := jobSyncResponse{
+			JobID:     syncJobResponse.MessageID.String(),
+			Status:    syncJobResponse.Status,
+			Responses: syncJobResponse.Responses,
+		}
+
+		writeJSONResponse(w, http.StatusOK, jobResponse)
+	}
+}
+
+func (jr *JobReceiver) handleJobStream() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId})
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			errMsg := "Streaming is not supported"
+			logger.Error(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusInternalServerError,
+				Detail: errMsg}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		var jobRequest jobRequest
+
+		body := http.MaxBytesReader(w, req.Body, jr.config.JobMaxPayloadSize)
+
+		if err := decodeJSON(body, &jobRequest); err != nil {
+			errMsg := "Unable to process json input"
+			logger.WithFields(logrus.Fields{"error": err}).Debug(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if jr.validatePayload(logger, w, jobRequest.Directive, jobRequest.Payload) == false {
+			return
+		}
+
+		if jr.limitJobRate(req.Context(), logger, w, principal, jobRequest.Account, jobRequest.Recipient) == false {
+			return
+		}
+
+		client, route := jr.meshLocator.LocateConnectionToNode(req.Context(), jobRequest.Account, jobRequest.Recipient)
+		if client == nil {
+			writeConnectionFailureResponse(logger, w)
+			return
+		}
+
+		logger = logger.WithFields(logrus.Fields{"recipient": jobRequest.Recipient,
+			"directive":  jobRequest.Directive,
+			"route_list": route})
+		logger.Info("Sending a message and streaming the responses")
+
+		stream, err := client.SendMessageStream(req.Context(), jobRequest.Account, jobRequest.Recipient,
+			route,
 			jobRequest.Payload,
 			jobRequest.Directive)
 
@@ -96,20 +668,344 @@ func (jr *JobReceiver) handleJob() http.HandlerFunc {
 		}
 
 		if err != nil {
-			logger.WithFields(logrus.Fields{"error": err}).Info("Error passing message to receptor")
-			errorResponse := errorResponse{Title: "Error passing message to receptor",
+			writeSendFailureResponse(logger, w, "Error passing message to receptor", err)
+			return
+		}
+
+		logger = logger.WithFields(logrus.Fields{"message_id": stream.MessageID})
+
+		writeServerSentEventHeaders(w)
+
+		if err := writeServerSentEvent(w, flusher, jobStreamJobEvent, jobResponse{JobID: stream.MessageID.String()}); err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Info("Unable to write to the stream")
+			return
+		}
+
+		for responseMsg := range stream.Responses() {
+			if err := writeServerSentEvent(w, flusher, jobStreamResponseEvent, responseMsg); err != nil {
+				// The client went away.  The stream is closed once the request context is cancelled.
+				logger.WithFields(logrus.Fields{"error": err}).Info("Unable to write to the stream")
+				return
+			}
+		}
+
+		logger.WithFields(logrus.Fields{"status": stream.Status()}).Info("Finished streaming the responses")
+
+		endResponse := jobStreamEndResponse{JobID: stream.MessageID.String(), Status: stream.Status()}
+		writeServerSentEvent(w, flusher, jobStreamEndEvent, endResponse)
+	}
+}
+
+func (jr *JobReceiver) handleJobStatus() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		jobID := mux.Vars(req)["id"]
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId,
+			"message_id": jobID})
+
+		if _, err := uuid.Parse(jobID); err != nil {
+			errMsg := "Invalid job id"
+			logger.WithFields(logrus.Fields{"error": err}).Debug(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		job, err := jr.jobRegistry.Get(req.Context(), jobID)
+
+		if err == controller.ErrJobNotFound {
+			errMsg := "Job not found"
+			logger.Info(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusNotFound,
+				Detail: errMsg}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Info("Error looking up the job")
+			errorResponse := errorResponse{Title: "Error looking up the job",
 				Status: http.StatusInternalServerError,
 				Detail: err.Error()}
 			writeJSONResponse(w, errorResponse.Status, errorResponse)
 			return
 		}
 
-		logger.WithFields(logrus.Fields{"message_id": jobID}).Info("Message sent")
+		writeJSONResponse(w, http.StatusOK, job)
+	}
+}
 
-		jobResponse := jobResponse{jobID.String()}
+func (jr *JobReceiver) handleJobCancel() http.HandlerFunc {
 
-		writeJSONResponse(w, http.StatusCreated, jobResponse)
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		jobID := mux.Vars(req)["id"]
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId,
+			"message_id": jobID})
+
+		messageID, err := uuid.Parse(jobID)
+		if err != nil {
+			errMsg := "Invalid job id"
+			logger.WithFields(logrus.Fields{"error": err}).Debug(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		job, err := jr.jobRegistry.Get(req.Context(), jobID)
+
+		if err == controller.ErrJobNotFound {
+			errMsg := "Job not found"
+			logger.Info(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusNotFound,
+				Detail: errMsg}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Info("Error looking up the job")
+			errorResponse := errorResponse{Title: "Error looking up the job",
+				Status: http.StatusInternalServerError,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if job.Finished() {
+			errMsg := "Job already finished"
+			logger.WithFields(logrus.Fields{"state": job.State}).Info(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusConflict,
+				Detail: fmt.Sprintf("The job cannot be cancelled.  The job is %s.", job.State)}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		logger = logger.WithFields(logrus.Fields{"recipient": job.Recipient,
+			"node_id":   job.NodeID,
+			"directive": job.Directive})
+
+		// A queued job has not been sent yet.  It is discarded instead of
+		// being delivered when the recipient connects.
+		if job.State != controller.JobStateQueued {
+			client := jr.connectionMgr.GetConnection(req.Context(), job.Account, job.NodeID)
+			if client == nil {
+				writeConnectionFailureResponse(logger, w)
+				return
+			}
+
+			logger.Info("Cancelling a job")
+
+			err = client.CancelMessage(req.Context(), job.Account, job.Recipient, messageID)
+
+			if err == errDisconnectedNode {
+				writeConnectionFailureResponse(logger, w)
+				return
+			}
+
+			if err != nil {
+				writeSendFailureResponse(logger, w, "Error passing cancel message to receptor", err)
+				return
+			}
+		}
+
+		err = jr.jobRegistry.UpdateState(req.Context(), jobID, controller.JobStateCancelled)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Info("Error marking the job cancelled")
+			errorResponse := errorResponse{Title: "Error marking the job cancelled",
+				Status: http.StatusInternalServerError,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		logger.Info("Job cancelled")
+
+		job, err = jr.jobRegistry.Get(req.Context(), jobID)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Info("Error looking up the job")
+			errorResponse := errorResponse{Title: "Error looking up the job",
+				Status: http.StatusInternalServerError,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, job)
+	}
+}
+
+// handleJobBroadcast sends the job to every node of the account that is
+// connected to the cloud directly.  The nodes can be narrowed down by their
+// capabilities.  The jobs are sent in parallel and the result of sending the
+// job to each node is returned.
+func (jr *JobReceiver) handleJobBroadcast() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId})
+
+		var jobRequest jobBroadcastRequest
+
+		body := http.MaxBytesReader(w, req.Body, jr.config.JobMaxPayloadSize)
+
+		if err := decodeJSON(body, &jobRequest); err != nil {
+			errMsg := "Unable to process json input"
+			logger.WithFields(logrus.Fields{"error": err}).Debug(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if jr.validatePayload(logger, w, jobRequest.Directive, jobRequest.Payload) == false {
+			return
+		}
+
+		lane := controller.LaneInteractive
+		if jobRequest.Lane != "" {
+			lane = controller.Lane(jobRequest.Lane)
+		}
+
+		ctx := controller.WithLane(req.Context(), lane)
+
+		connections := jr.connectionMgr.GetConnectionsByAccount(ctx, jobRequest.Account)
+
+		logger = logger.WithFields(logrus.Fields{"directive": jobRequest.Directive,
+			"connection_count": len(connections),
+			"lane":             lane})
+		logger.Info("Broadcasting a message")
+
+		response := jobBroadcastResponse{Results: make(map[string]jobBroadcastResult)}
+		var responseLock sync.Mutex
+
+		var wg sync.WaitGroup
+		maxConcurrency := jr.config.JobBroadcastMaxConcurrency
+		if maxConcurrency < 1 {
+			maxConcurrency = 1
+		}
+		concurrency := make(chan struct{}, maxConcurrency)
+
+		for nodeID, client := range connections {
+			if client == nil {
+				continue
+			}
+
+			wg.Add(1)
+			go func(nodeID string, client controller.Receptor) {
+				defer wg.Done()
+
+				concurrency <- struct{}{}
+				defer func() { <-concurrency }()
+
+				result, matched := jr.broadcastJob(ctx, logger.WithFields(logrus.Fields{"recipient": nodeID}), principal, client, nodeID, jobRequest)
+				if matched == false {
+					return
+				}
+
+				responseLock.Lock()
+				response.Results[nodeID] = result
+				responseLock.Unlock()
+			}(nodeID, client)
+		}
+
+		wg.Wait()
+
+		logger.WithFields(logrus.Fields{"result_count": len(response.Results)}).Info("Finished broadcasting the message")
+
+		writeJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+// broadcastJob sends the job to a node.  false is returned if the node does
+// not match the capability filter.
+func (jr *JobReceiver) broadcastJob(ctx context.Context, logger *logrus.Entry, principal middlewares.Principal, client controller.Receptor, nodeID string, jobRequest jobBroadcastRequest) (jobBroadcastResult, bool) {
+	if jobRequest.Capability != nil {
+		capabilities, err := client.GetCapabilities(ctx)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Info("Unable to retrieve the capabilities of the node")
+			return jobBroadcastResult{Error: err.Error()}, true
+		}
+
+		if jobRequest.Capability.Matches(capabilities) == false {
+			return jobBroadcastResult{}, false
+		}
+	}
+
+	allowed, scope, retryAfter := jr.takeJobRateLimitTokens(ctx, logger, principal, jobRequest.Account, nodeID)
+	if allowed == false {
+		return jobBroadcastResult{Error: rateLimitExceededDetail(scope, retryAfter)}, true
 	}
+
+	jobID, err := client.SendMessage(ctx, jobRequest.Account, nodeID,
+		[]string{nodeID},
+		jobRequest.Payload,
+		jobRequest.Directive)
+
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Info("Error passing message to receptor")
+		return jobBroadcastResult{Error: err.Error()}, true
+	}
+
+	logger.WithFields(logrus.Fields{"message_id": jobID}).Info("Message sent")
+
+	return jobBroadcastResult{JobID: jobID.String()}, true
+}
+
+// writeSendFailureResponse reports an error passing a message to the
+// receptor node.  An overloaded connection is reported as a 503 along with
+// the depth of the queue so that the caller can back off.  A schema
+// violation reported by the gateway is passed on as is.
+func writeSendFailureResponse(logger *logrus.Entry, w http.ResponseWriter, title string, err error) {
+	var overloadedErr *controller.ConnectionOverloadedError
+	if errors.As(err, &overloadedErr) {
+		logger.WithFields(logrus.Fields{"lane": overloadedErr.Lane,
+			"queue_depth": overloadedErr.QueueDepth}).Info("Connection to the receptor node is overloaded")
+		overloadedResponse := connectionOverloadedResponse{
+			errorResponse: errorResponse{Title: "Connection to the receptor node is overloaded",
+				Status: http.StatusServiceUnavailable,
+				Detail: err.Error()},
+			Lane:          overloadedErr.Lane,
+			QueueDepth:    overloadedErr.QueueDepth,
+			QueueCapacity: overloadedErr.QueueCapacity,
+		}
+		writeJSONResponse(w, overloadedResponse.Status, overloadedResponse)
+		return
+	}
+
+	var violationErr *remoteSchemaViolationError
+	if errors.As(err, &violationErr) {
+		logger.WithFields(logrus.Fields{"error": err}).Info(violationErr.response.Title)
+		writeJSONResponse(w, violationErr.response.Status, violationErr.response)
+		return
+	}
+
+	logger.WithFields(logrus.Fields{"error": err}).Info(title)
+	errorResponse := errorResponse{Title: title,
+		Status: http.StatusInternalServerError,
+		Detail: err.Error()}
+	writeJSONResponse(w, errorResponse.Status, errorResponse)
 }
 
 func writeConnectionFailureResponse(logger *logrus.Entry, w http.ResponseWriter) {
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -15,7 +16,9 @@ import (
 	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
 	"github.com/RedHatInsights/platform-receptor-controller/internal/controller"
 	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/mesh_router"
 
+	"github.com/alicebob/miniredis"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
@@ -29,6 +32,15 @@ const (
 
 type MockClient struct {
 	returnAnError bool
+	overloaded    bool
+	capabilities  interface{}
+	inFlightJobs  int
+}
+
+var errMockOverloaded = &controller.ConnectionOverloadedError{
+	Lane:          controller.LaneInteractive,
+	QueueDepth:    10,
+	QueueCapacity: 10,
 }
 
 func (mc MockClient) SendMessage(ctx context.Context, account string, recipient string, route []string, payload interface{}, directive string) (*uuid.UUID, error) {
@@ -39,6 +51,50 @@ func (mc MockClient) SendMessage(ctx context.Context, account string, recipient
 	return &myUUID, nil
 }
 
+func (mc MockClient) SendMessageWithID(ctx context.Context, messageID uuid.UUID, account string, recipient string, route []string, payload interface{}, directive string) error {
+	if mc.overloaded {
+		return errMockOverloaded
+	}
+	if mc.returnAnError {
+		return errors.New("ImaError")
+	}
+	return nil
+}
+
+func (mc MockClient) CancelMessage(ctx context.Context, account string, recipient string, messageID uuid.UUID) error {
+	if mc.returnAnError {
+		return errors.New("ImaError")
+	}
+	return nil
+}
+
+func (mc MockClient) SendMessageSync(ctx context.Context, account string, recipient string, route []string, payload interface{}, directive string, timeout time.Duration) (*controller.SyncJobResponse, error) {
+	if mc.returnAnError {
+		return nil, errors.New("ImaError")
+	}
+	myUUID, _ := uuid.NewRandom()
+	return &controller.SyncJobResponse{
+		MessageID: myUUID,
+		Status:    controller.ResponsesCompleted,
+		Responses: []controller.ResponseMessage{
+			{MessageType: "response", InResponseTo: myUUID.String(), Serial: 1},
+			{MessageType: controller.ResponseMessageTypeEOF, InResponseTo: myUUID.String(), Serial: 2},
+		},
+	}, nil
+}
+
+func (mc MockClient) SendMessageStream(ctx context.Context, account string, recipient string, route []string, payload interface{}, directive string) (*controller.ResponseStream, error) {
+	if mc.returnAnError {
+		return nil, errors.New("ImaError")
+	}
+	myUUID, _ := uuid.NewRandom()
+	stream := controller.NewResponseStream(myUUID, 2)
+	stream.Send(ctx, controller.ResponseMessage{MessageType: "response", InResponseTo: myUUID.String(), Serial: 1})
+	stream.Send(ctx, controller.ResponseMessage{MessageType: controller.ResponseMessageTypeEOF, InResponseTo: myUUID.String(), Serial: 2})
+	stream.Close(controller.ResponsesCompleted)
+	return stream, nil
+}
+
 func (mc MockClient) Ping(context.Context, string, string, []string) (interface{}, error) {
 	if mc.returnAnError {
 		return nil, errors.New("ImaErrorToo")
@@ -51,9 +107,32 @@ func (mc MockClient) Close(context.Context) error {
 }
 
 func (mc MockClient) GetCapabilities(context.Context) (interface{}, error) {
+	if mc.capabilities != nil {
+		return mc.capabilities, nil
+	}
 	return struct{}{}, nil
 }
 
+func (mc MockClient) GetInFlightJobCount(context.Context) (int, error) {
+	return mc.inFlightJobs, nil
+}
+
+func (mc MockClient) GetStatus(ctx context.Context) (*controller.ConnectionStatus, error) {
+	capabilities, _ := mc.GetCapabilities(ctx)
+	return &controller.ConnectionStatus{Capabilities: capabilities, InFlightJobs: mc.inFlightJobs}, nil
+}
+
+func (mc MockClient) GetTopology(context.Context) (*mesh_router.Topology, error) {
+	if mc.returnAnError {
+		return nil, errors.New("ImaErrorThree")
+	}
+	return &mesh_router.Topology{
+		Version: 1,
+		Nodes:   []mesh_router.Node{{ID: "345"}, {ID: "node-b"}},
+		Edges:   []mesh_router.Edge{{Left: "345", Right: "node-b", Cost: 1}},
+	}, nil
+}
+
 func init() {
 	logger.InitLogger()
 }
@@ -62,7 +141,11 @@ var _ = Describe("JobReceiver", func() {
 
 	var (
 		jr                  *JobReceiver
+		jobRegistry         *controller.InMemoryJobRegistry
+		jobQueue            *controller.InMemoryJobQueue
 		validIdentityHeader string
+		knownJobID          string
+		redisServer         *miniredis.Miniredis
 	)
 
 	BeforeEach(func() {
@@ -72,14 +155,48 @@ var _ = Describe("JobReceiver", func() {
 		cm.Register(context.TODO(), "1234", "345", mc)
 		errorMC := MockClient{returnAnError: true}
 		cm.Register(context.TODO(), "1234", "error-client", errorMC)
+		httpWorkerMC := MockClient{capabilities: map[string]interface{}{
+			"worker_versions": map[string]interface{}{"receptor_http": "1.0.0"},
+		}}
+		cm.Register(context.TODO(), "5678", "http-worker", httpWorkerMC)
+		cm.Register(context.TODO(), "5678", "no-workers", MockClient{})
+		busyHttpWorkerMC := MockClient{capabilities: map[string]interface{}{
+			"worker_versions": map[string]interface{}{"receptor_http": "2.0.0"},
+		}, inFlightJobs: 5}
+		cm.Register(context.TODO(), "5678", "busy-http-worker", busyHttpWorkerMC)
+		cm.Register(context.TODO(), "9012", "overloaded-client", MockClient{overloaded: true})
 		cfg := config.GetConfig()
-		jr = NewJobReceiver(cm, apiMux, cfg)
+		jobRegistry = controller.NewInMemoryJobRegistry(cfg)
+		jobQueue = controller.NewInMemoryJobQueue()
+		knownJobID = "6f1a1b7e-8d32-4bd5-9a34-0c2b6cba8f43"
+		jobRegistry.Register(context.TODO(), controller.Job{
+			MessageID: knownJobID,
+			Account:   "1234",
+			Recipient: "345",
+			NodeID:    "345",
+			Directive: "fred:flintstone",
+			State:     controller.JobStateSent,
+			CreatedAt: time.Now().UTC(),
+			UpdatedAt: time.Now().UTC(),
+		})
+		redisServer, _ = miniredis.Run()
+		jobRateLimiter := controller.NewRedisJobRateLimiter(newTestRedisClient(redisServer.Addr()))
+		directiveSchemas := controller.NewDirectiveSchemaRegistry()
+		directiveSchemas.Register(controller.DirectiveSchema{
+			Directive: "fred:validated",
+			Payload:   json.RawMessage(`{"type": "object", "required": ["command"], "properties": {"command": {"type": "string"}}}`),
+		})
+		jr = NewJobReceiver(cm, jobRegistry, jobQueue, controller.NewInMemoryJobDeduplicator(cfg), jobRateLimiter, directiveSchemas, apiMux, cfg)
 		jr.Routes()
 
 		identity := `{ "identity": {"account_number": "540155", "type": "User", "internal": { "org_id": "1979710" } } }`
 		validIdentityHeader = base64.StdEncoding.EncodeToString([]byte(identity))
 	})
 
+	AfterEach(func() {
+		redisServer.Close()
+	})
+
 	Describe("Connecting to the job receiver", func() {
 		Context("With a valid identity header", func() {
 			It("Should be able to send a job to a connected customer", func() {
@@ -102,6 +219,129 @@ var _ = Describe("JobReceiver", func() {
 				Expect(m).Should(HaveKey("id"))
 			})
 
+			It("Should not allow the caller to set the job id", func() {
+
+				jobID := "6e6ea0a3-4c7e-4a9d-9fc1-2c4c9e4f4b4b"
+				postBody := "{\"id\": \"" + jobID + "\", \"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusForbidden))
+			})
+
+			It("Should use the job id provided by the job dispatcher", func() {
+
+				jr.config.ServiceToServiceCredentials[jr.config.JobReceiverReceptorProxyClientID] = "12345"
+
+				jobID := "6e6ea0a3-4c7e-4a9d-9fc1-2c4c9e4f4b4b"
+				postBody := "{\"id\": \"" + jobID + "\", \"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(TOKEN_HEADER_CLIENT_NAME, jr.config.JobReceiverReceptorProxyClientID)
+				req.Header.Add(TOKEN_HEADER_ACCOUNT_NAME, "1234")
+				req.Header.Add(TOKEN_HEADER_PSK_NAME, "12345")
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+
+				var m map[string]string
+				json.Unmarshal(rr.Body.Bytes(), &m)
+				Expect(m["id"]).Should(Equal(jobID))
+			})
+
+			It("Should not allow sending a job with an invalid job id", func() {
+
+				postBody := "{\"id\": \"not-a-uuid\", \"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("Should reject jobs that exceed the node rate limit", func() {
+
+				jr.config.JobNodeRateLimit = 0.1
+				jr.config.JobNodeRateLimitBurst = 1
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				sendJob := func() *httptest.ResponseRecorder {
+					req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+					Expect(err).NotTo(HaveOccurred())
+
+					req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+					rr := httptest.NewRecorder()
+
+					jr.router.ServeHTTP(rr, req)
+
+					return rr
+				}
+
+				Expect(sendJob().Code).To(Equal(http.StatusCreated))
+
+				rr := sendJob()
+				Expect(rr.Code).To(Equal(http.StatusTooManyRequests))
+				Expect(rr.Header().Get("Retry-After")).To(Equal("10"))
+
+				var m map[string]interface{}
+				json.Unmarshal(rr.Body.Bytes(), &m)
+				Expect(m).Should(HaveKey("status"))
+				Expect(m).Should(HaveKey("title"))
+				Expect(m["detail"]).Should(ContainSubstring("node"))
+			})
+
+			It("Should be able to send a job on the bulk lane", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\", \"lane\": \"bulk\"}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+			})
+
+			It("Should not allow sending a job on the control lane", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\", \"lane\": \"control\"}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
 			It("Should be able to send a job to a connected customer but get an error", func() {
 
 				postBody := "{\"account\": \"1234\", \"recipient\": \"error-client\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
@@ -140,6 +380,42 @@ var _ = Describe("JobReceiver", func() {
 				Expect(rr.Code).To(Equal(http.StatusNotFound))
 			})
 
+			It("Should be able to send a job to a node that is reachable through a connected node", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"node-b\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+
+				var m map[string]string
+				json.Unmarshal(rr.Body.Bytes(), &m)
+				Expect(m).Should(HaveKey("id"))
+			})
+
+			It("Should not allow sending a job to a node that is not reachable through any connected node", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"node-z\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			})
+
 			It("Should not allow sending a job with an empty account", func() {
 
 				postBody := "{\"account\": \"\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
@@ -307,4 +583,759 @@ var _ = Describe("JobReceiver", func() {
 		})
 
 	})
+
+	Describe("Queueing a job for an offline node", func() {
+		Context("With a valid identity header", func() {
+			It("Should queue the job when the recipient is offline", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"offline-node\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\", \"queue_if_offline\": true, \"ttl\": 60}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusAccepted))
+
+				var jobResponse jobResponse
+				json.Unmarshal(rr.Body.Bytes(), &jobResponse)
+
+				queuedJob, err := jobQueue.Dequeue(context.TODO(), "1234", "offline-node")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(queuedJob).NotTo(BeNil())
+				Expect(queuedJob.MessageID).To(Equal(jobResponse.JobID))
+				Expect(queuedJob.ExpiresAt.Sub(queuedJob.QueuedAt)).To(Equal(60 * time.Second))
+
+				job, err := jobRegistry.Get(context.TODO(), jobResponse.JobID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(job.State).To(Equal(controller.JobStateQueued))
+			})
+
+			It("Should not queue the job when the recipient is online", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\", \"queue_if_offline\": true}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+
+				queuedJob, err := jobQueue.Dequeue(context.TODO(), "1234", "345")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(queuedJob).To(BeNil())
+			})
+
+			It("Should reject a ttl that exceeds the max ttl", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"offline-node\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\", \"queue_if_offline\": true, \"ttl\": 100000000}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Describe("Submitting a job with an idempotency key", func() {
+
+		submitJob := func(postBody string, idempotencyKey string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+			Expect(err).NotTo(HaveOccurred())
+
+			req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+			if idempotencyKey != "" {
+				req.Header.Add("Idempotency-Key", idempotencyKey)
+			}
+
+			rr := httptest.NewRecorder()
+
+			jr.router.ServeHTTP(rr, req)
+
+			return rr
+		}
+
+		getJobID := func(rr *httptest.ResponseRecorder) string {
+			var jobResponse jobResponse
+			json.Unmarshal(rr.Body.Bytes(), &jobResponse)
+			return jobResponse.JobID
+		}
+
+		Context("With a valid identity header", func() {
+			It("Should return the original job id when the job is submitted again with the same header", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				rr := submitJob(postBody, "retry-me")
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+				originalJobID := getJobID(rr)
+
+				rr = submitJob(postBody, "retry-me")
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(getJobID(rr)).To(Equal(originalJobID))
+
+				rr = submitJob(postBody, "another-key")
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+				Expect(getJobID(rr)).NotTo(Equal(originalJobID))
+			})
+
+			It("Should return the original job id when the job is submitted again with the same job_key", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\", \"job_key\": \"retry-me\"}"
+
+				rr := submitJob(postBody, "")
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+				originalJobID := getJobID(rr)
+
+				rr = submitJob(postBody, "retry-me")
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(getJobID(rr)).To(Equal(originalJobID))
+			})
+
+			It("Should return the original job id of a queued job", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"offline-node\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\", \"queue_if_offline\": true, \"job_key\": \"retry-me\"}"
+
+				rr := submitJob(postBody, "")
+				Expect(rr.Code).To(Equal(http.StatusAccepted))
+				originalJobID := getJobID(rr)
+
+				rr = submitJob(postBody, "")
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(getJobID(rr)).To(Equal(originalJobID))
+
+				queuedJob, _ := jobQueue.Dequeue(context.TODO(), "1234", "offline-node")
+				Expect(queuedJob.MessageID).To(Equal(originalJobID))
+
+				queuedJob, _ = jobQueue.Dequeue(context.TODO(), "1234", "offline-node")
+				Expect(queuedJob).To(BeNil())
+			})
+
+			It("Should allow the job to be submitted again when the first submission failed", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"error-client\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				rr := submitJob(postBody, "retry-me")
+				Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+
+				postBody = "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				rr = submitJob(postBody, "retry-me")
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+			})
+
+			It("Should not allow conflicting idempotency keys", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\", \"job_key\": \"retry-me\"}"
+
+				rr := submitJob(postBody, "another-key")
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Describe("Connecting to the sync job receiver", func() {
+		Context("With a valid identity header", func() {
+			It("Should be able to send a job to a connected customer and receive the responses", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\", \"timeout\": 5}"
+
+				req, err := http.NewRequest("POST", "/job/sync", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var response jobSyncResponse
+				json.Unmarshal(rr.Body.Bytes(), &response)
+				Expect(response.JobID).ShouldNot(BeEmpty())
+				Expect(response.Status).To(Equal(controller.ResponsesCompleted))
+				Expect(response.Responses).To(HaveLen(2))
+				Expect(response.Responses[1].MessageType).To(Equal(controller.ResponseMessageTypeEOF))
+			})
+
+			It("Should be able to send a job to a connected customer but get an error", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"error-client\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job/sync", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			})
+
+			It("Should not allow sending a job to a disconnected customer", func() {
+
+				postBody := "{\"account\": \"1234-not-here\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job/sync", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			})
+
+			It("Should not allow a timeout larger than the configured maximum", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\", \"timeout\": 100000}"
+
+				req, err := http.NewRequest("POST", "/job/sync", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("Should not allow sending a job with missing required fields", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"timeout\": 5}"
+
+				req, err := http.NewRequest("POST", "/job/sync", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Describe("Connecting to the streaming job receiver", func() {
+		Context("With a valid identity header", func() {
+			It("Should be able to send a job to a connected customer and stream the responses", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job/stream", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(rr.Header().Get("Content-Type")).To(Equal("text/event-stream"))
+
+				eventReader := newServerSentEventReader(rr.Body)
+
+				event, err := eventReader.ReadEvent()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(event.Event).To(Equal(jobStreamJobEvent))
+
+				for serial := 1; serial <= 2; serial++ {
+					event, err = eventReader.ReadEvent()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(event.Event).To(Equal(jobStreamResponseEvent))
+
+					var m map[string]interface{}
+					json.Unmarshal(event.Data, &m)
+					Expect(m).Should(HaveKeyWithValue("serial", float64(serial)))
+					Expect(m).Should(HaveKey("code"))
+					Expect(m).Should(HaveKey("message_type"))
+				}
+
+				event, err = eventReader.ReadEvent()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(event.Event).To(Equal(jobStreamEndEvent))
+
+				var endResponse jobStreamEndResponse
+				json.Unmarshal(event.Data, &endResponse)
+				Expect(endResponse.Status).To(Equal(controller.ResponsesCompleted))
+			})
+
+			It("Should be able to send a job to a connected customer but get an error", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"error-client\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job/stream", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			})
+
+			It("Should not allow sending a job to a disconnected customer", func() {
+
+				postBody := "{\"account\": \"1234-not-here\", \"recipient\": \"345\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job/stream", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("Looking up the state of a job", func() {
+		Context("With a valid identity header", func() {
+			It("Should be able to get the state of a known job", func() {
+
+				jobRegistry.UpdateState(context.TODO(), knownJobID, controller.JobStateAcknowledged)
+
+				req, err := http.NewRequest("GET", "/job/"+knownJobID, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var job controller.Job
+				json.Unmarshal(rr.Body.Bytes(), &job)
+				Expect(job.MessageID).To(Equal(knownJobID))
+				Expect(job.State).To(Equal(controller.JobStateAcknowledged))
+			})
+
+			It("Should not find an unknown job", func() {
+
+				req, err := http.NewRequest("GET", "/job/0d4b7c8e-21a6-4a3c-8f5d-6b1b8a2c9e70", nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			})
+
+			It("Should reject an invalid job id", func() {
+
+				req, err := http.NewRequest("GET", "/job/not-a-uuid", nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Describe("Cancelling a job", func() {
+
+		cancelJob := func(jobID string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest("POST", "/job/"+jobID+"/cancel", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+			rr := httptest.NewRecorder()
+
+			jr.router.ServeHTTP(rr, req)
+
+			return rr
+		}
+
+		registerJob := func(nodeID string, state string) string {
+			jobID := uuid.New().String()
+			jobRegistry.Register(context.TODO(), controller.Job{
+				MessageID: jobID,
+				Account:   "1234",
+				Recipient: nodeID,
+				NodeID:    nodeID,
+				Directive: "fred:flintstone",
+				State:     state,
+				CreatedAt: time.Now().UTC(),
+				UpdatedAt: time.Now().UTC(),
+			})
+			return jobID
+		}
+
+		Context("With a valid identity header", func() {
+			It("Should be able to cancel a job that was sent", func() {
+
+				rr := cancelJob(knownJobID)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var job controller.Job
+				json.Unmarshal(rr.Body.Bytes(), &job)
+				Expect(job.MessageID).To(Equal(knownJobID))
+				Expect(job.State).To(Equal(controller.JobStateCancelled))
+			})
+
+			It("Should be able to cancel a queued job", func() {
+
+				jobID := registerJob("offline-node", controller.JobStateQueued)
+
+				rr := cancelJob(jobID)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				job, err := jobRegistry.Get(context.TODO(), jobID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(job.State).To(Equal(controller.JobStateCancelled))
+			})
+
+			It("Should not cancel a job that has finished", func() {
+
+				jobRegistry.UpdateState(context.TODO(), knownJobID, controller.JobStateCompleted)
+
+				rr := cancelJob(knownJobID)
+
+				Expect(rr.Code).To(Equal(http.StatusConflict))
+
+				var errResponse errorResponse
+				json.Unmarshal(rr.Body.Bytes(), &errResponse)
+				Expect(errResponse.Status).To(Equal(http.StatusConflict))
+			})
+
+			It("Should not cancel a job whose connection is gone", func() {
+
+				jobID := registerJob("disconnected-node", controller.JobStateSent)
+
+				rr := cancelJob(jobID)
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			})
+
+			It("Should not mark the job cancelled when the cancel message cannot be sent", func() {
+
+				jobID := registerJob("error-client", controller.JobStateSent)
+
+				rr := cancelJob(jobID)
+
+				Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+
+				job, err := jobRegistry.Get(context.TODO(), jobID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(job.State).To(Equal(controller.JobStateSent))
+			})
+
+			It("Should not find an unknown job", func() {
+
+				rr := cancelJob("0d4b7c8e-21a6-4a3c-8f5d-6b1b8a2c9e70")
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			})
+
+			It("Should reject an invalid job id", func() {
+
+				rr := cancelJob("not-a-uuid")
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Describe("Broadcasting a job", func() {
+
+		broadcastJob := func(postBody string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest("POST", "/job/broadcast", strings.NewReader(postBody))
+			Expect(err).NotTo(HaveOccurred())
+
+			req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+			rr := httptest.NewRecorder()
+
+			jr.router.ServeHTTP(rr, req)
+
+			return rr
+		}
+
+		Context("With a valid identity header", func() {
+			It("Should send the job to every connected node of the account", func() {
+
+				rr := broadcastJob("{\"account\": \"1234\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}")
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var response jobBroadcastResponse
+				json.Unmarshal(rr.Body.Bytes(), &response)
+				Expect(response.Results).To(HaveLen(2))
+				Expect(response.Results["345"].JobID).NotTo(BeEmpty())
+				Expect(response.Results["345"].Error).To(BeEmpty())
+				Expect(response.Results["error-client"].JobID).To(BeEmpty())
+				Expect(response.Results["error-client"].Error).To(Equal("ImaError"))
+			})
+
+			It("Should only send the job to the nodes that match the capability filter", func() {
+
+				rr := broadcastJob("{\"account\": \"5678\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\", \"capability\": {\"worker\": \"receptor_http\"}}")
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var response jobBroadcastResponse
+				json.Unmarshal(rr.Body.Bytes(), &response)
+				Expect(response.Results).To(HaveLen(2))
+				Expect(response.Results["http-worker"].JobID).NotTo(BeEmpty())
+				Expect(response.Results["busy-http-worker"].JobID).NotTo(BeEmpty())
+			})
+
+			It("Should return an empty result for an account without connections", func() {
+
+				rr := broadcastJob("{\"account\": \"0000\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}")
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var response jobBroadcastResponse
+				json.Unmarshal(rr.Body.Bytes(), &response)
+				Expect(response.Results).To(BeEmpty())
+			})
+
+			It("Should not allow a broadcast without a directive", func() {
+
+				rr := broadcastJob("{\"account\": \"1234\", \"payload\": [\"678\"]}")
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Describe("Selecting the recipient of a job by capability", func() {
+
+		sendJob := func(postBody string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+			Expect(err).NotTo(HaveOccurred())
+
+			req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+			rr := httptest.NewRecorder()
+
+			jr.router.ServeHTTP(rr, req)
+
+			return rr
+		}
+
+		Context("With a valid identity header", func() {
+			It("Should send the job to the least loaded matching node", func() {
+
+				rr := sendJob("{\"account\": \"5678\", \"capability\": {\"worker\": \"receptor_http\"}, \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}")
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+
+				var response jobResponse
+				json.Unmarshal(rr.Body.Bytes(), &response)
+				Expect(response.JobID).NotTo(BeEmpty())
+				Expect(response.Recipient).To(Equal("http-worker"))
+			})
+
+			It("Should only send the job to a node with a new enough worker", func() {
+
+				rr := sendJob("{\"account\": \"5678\", \"capability\": {\"worker\": \"receptor_http\", \"min_version\": \"1.5\"}, \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}")
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+
+				var response jobResponse
+				json.Unmarshal(rr.Body.Bytes(), &response)
+				Expect(response.Recipient).To(Equal("busy-http-worker"))
+			})
+
+			It("Should return a 404 if no node matches", func() {
+
+				rr := sendJob("{\"account\": \"5678\", \"capability\": {\"worker\": \"receptor_satellite\"}, \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}")
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			})
+
+			It("Should not allow both a recipient and a capability selector", func() {
+
+				rr := sendJob("{\"account\": \"5678\", \"recipient\": \"http-worker\", \"capability\": {\"worker\": \"receptor_http\"}, \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}")
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("Should not allow a job without a recipient or a capability selector", func() {
+
+				rr := sendJob("{\"account\": \"5678\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}")
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("Should not queue a job whose recipient is selected by capability", func() {
+
+				rr := sendJob("{\"account\": \"5678\", \"capability\": {\"worker\": \"receptor_http\"}, \"queue_if_offline\": true, \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}")
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Describe("Sending a job to an overloaded connection", func() {
+
+		Context("With a valid identity header", func() {
+			It("Should return a 503 along with the queue depth", func() {
+
+				postBody := "{\"account\": \"9012\", \"recipient\": \"overloaded-client\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+
+				var response connectionOverloadedResponse
+				json.Unmarshal(rr.Body.Bytes(), &response)
+				Expect(response.Status).To(Equal(http.StatusServiceUnavailable))
+				Expect(response.Lane).To(Equal(controller.LaneInteractive))
+				Expect(response.QueueDepth).To(Equal(10))
+				Expect(response.QueueCapacity).To(Equal(10))
+			})
+		})
+	})
+
+	Describe("Submitting a job with a large payload", func() {
+
+		Context("With a valid identity header", func() {
+			It("Should not allow a payload larger than the configured maximum", func() {
+
+				jr.config.JobMaxPayloadSize = 64
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"" + strings.Repeat("x", 64) + "\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("Should allow a payload larger than the websocket message size", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": [\"" + strings.Repeat("x", int(jr.config.MaxMessageSize)) + "\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+			})
+		})
+	})
+
+	Describe("Submitting a job whose directive has a schema", func() {
+
+		Context("With a valid identity header", func() {
+			It("Should send a job whose payload matches the schema", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": {\"command\": \"ls\"}, \"directive\": \"fred:validated\"}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+			})
+
+			It("Should not send a job whose payload does not match the schema", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"345\", \"payload\": {\"command\": 42}, \"directive\": \"fred:validated\"}"
+
+				req, err := http.NewRequest("POST", "/job", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+
+				var response schemaViolationResponse
+				json.Unmarshal(rr.Body.Bytes(), &response)
+				Expect(response.Status).To(Equal(http.StatusBadRequest))
+				Expect(response.Violations).To(HaveLen(1))
+				Expect(response.Violations[0]).To(HavePrefix("/command:"))
+			})
+
+			It("Should not broadcast a job whose payload does not match the schema", func() {
+
+				postBody := "{\"account\": \"5678\", \"payload\": [\"678\"], \"directive\": \"fred:validated\"}"
+
+				req, err := http.NewRequest("POST", "/job/broadcast", strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
 })
@@ -8,6 +8,7 @@ import (
 	"github.com/RedHatInsights/platform-receptor-controller/internal/controller"
 	"github.com/RedHatInsights/platform-receptor-controller/internal/middlewares"
 	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/mesh_router"
 	"github.com/redhatinsights/platform-go-middlewares/request_id"
 
 	"github.com/gorilla/mux"
@@ -47,6 +48,7 @@ func (s *ManagementServer) Routes() {
 	securedSubRouter.HandleFunc("/disconnect", s.handleDisconnect()).Methods(http.MethodPost)
 	securedSubRouter.HandleFunc("/status", s.handleConnectionStatus()).Methods(http.MethodPost)
 	securedSubRouter.HandleFunc("/ping", s.handleConnectionPing()).Methods(http.MethodPost)
+	securedSubRouter.HandleFunc("/{account:[0-9]+}/{node_id}/topology", s.handleConnectionTopology()).Methods(http.MethodGet)
 }
 
 type connectionID struct {
@@ -57,6 +59,7 @@ type connectionID struct {
 type connectionStatusResponse struct {
 	Status       string      `json:"status"`
 	Capabilities interface{} `json:"capabilities,omitempty"`
+	InFlightJobs int         `json:"in_flight_jobs,omitempty"`
 }
 
 type connectionPingResponse struct {
@@ -64,6 +67,12 @@ type connectionPingResponse struct {
 	Payload interface{} `json:"payload"`
 }
 
+type connectionTopologyResponse struct {
+	Account string `json:"account"`
+	NodeID  string `json:"node_id"`
+	mesh_router.Topology
+}
+
 func (s *ManagementServer) handleDisconnect() http.HandlerFunc {
 
 	return func(w http.ResponseWriter, req *http.Request) {
@@ -135,16 +144,17 @@ func (s *ManagementServer) handleConnectionStatus() http.HandlerFunc {
 
 		client := s.connectionMgr.GetConnection(req.Context(), connID.Account, connID.NodeID)
 		if client != nil {
-			capabilities, err := client.GetCapabilities(req.Context())
+			status, err := client.GetStatus(req.Context())
 			if err == nil {
 				// Only report the node as connected if we can get a connection
-				// from the connection registrar and if we can get the capabilities
+				// from the connection registrar and if we can get its status
 				connectionStatus.Status = CONNECTED_STATUS
-				connectionStatus.Capabilities = capabilities
+				connectionStatus.Capabilities = status.Capabilities
+				connectionStatus.InFlightJobs = status.InFlightJobs
 			} else {
 				logger.WithFields(
 					logrus.Fields{"error": err},
-				).Errorf("Unable to retrieve the capabilities of node %s", connID.NodeID)
+				).Errorf("Unable to retrieve the status of node %s", connID.NodeID)
 			}
 		}
 
@@ -209,6 +219,52 @@ func (s *ManagementServer) handleConnectionPing() http.HandlerFunc {
 	}
 }
 
+func (s *ManagementServer) handleConnectionTopology() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		account := mux.Vars(req)["account"]
+		nodeID := mux.Vars(req)["node_id"]
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId})
+
+		logger.Infof("Getting mesh topology for account:%s - node id:%s", account, nodeID)
+
+		client := s.connectionMgr.GetConnection(req.Context(), account, nodeID)
+		if client == nil {
+			writeConnectionFailureResponse(logger, w)
+			return
+		}
+
+		topology, err := client.GetTopology(req.Context())
+
+		if err == errDisconnectedNode {
+			writeConnectionFailureResponse(logger, w)
+			return
+		}
+
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Errorf("Unable to retrieve the mesh topology of node %s", nodeID)
+			errorResponse := errorResponse{Title: "Unable to retrieve the mesh topology",
+				Status: http.StatusInternalServerError,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		topologyResponse := connectionTopologyResponse{
+			Account:  account,
+			NodeID:   nodeID,
+			Topology: *topology,
+		}
+
+		writeJSONResponse(w, http.StatusOK, topologyResponse)
+	}
+}
+
 func (s *ManagementServer) handleConnectionListing() http.HandlerFunc {
 
 	type ConnectionsPerAccount struct {
@@ -391,4 +391,63 @@ var _ = Describe("Management", func() {
 
 	})
 
+	Describe("Connecting to the connection topology endpoint", func() {
+		Context("With a valid identity header", func() {
+			It("Should be able to get the mesh topology of a connected customer", func() {
+
+				url := CONNECTION_LIST_ENDPOINT + "/" + CONNECTED_ACCOUNT_NUMBER + "/" + CONNECTED_NODE_ID + "/topology"
+				req, err := http.NewRequest("GET", url, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				ms.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var topologyResponse connectionTopologyResponse
+				json.Unmarshal(rr.Body.Bytes(), &topologyResponse)
+				Expect(topologyResponse.Account).Should(Equal(CONNECTED_ACCOUNT_NUMBER))
+				Expect(topologyResponse.NodeID).Should(Equal(CONNECTED_NODE_ID))
+				Expect(topologyResponse.Nodes).Should(HaveLen(2))
+				Expect(topologyResponse.Edges).Should(HaveLen(1))
+			})
+
+			It("Should not be able to get the mesh topology of a disconnected customer", func() {
+
+				url := CONNECTION_LIST_ENDPOINT + "/" + CONNECTED_ACCOUNT_NUMBER + "/not-here/topology"
+				req, err := http.NewRequest("GET", url, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				ms.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			})
+
+		})
+
+		Context("Without an identity header", func() {
+			It("Should fail to get the mesh topology", func() {
+
+				url := CONNECTION_LIST_ENDPOINT + "/" + CONNECTED_ACCOUNT_NUMBER + "/" + CONNECTED_NODE_ID + "/topology"
+				req, err := http.NewRequest("GET", url, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				rr := httptest.NewRecorder()
+
+				ms.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			})
+
+		})
+
+	})
+
 })
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/controller"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/mesh_router"
 	"github.com/redhatinsights/platform-go-middlewares/request_id"
 
 	"github.com/google/uuid"
@@ -75,6 +77,187 @@ func (rhp *ReceptorHttpProxy) SendMessage(ctx context.Context, accountNumber str
 	return &messageID, nil
 }
 
+func (rhp *ReceptorHttpProxy) SendMessageWithID(ctx context.Context, messageID uuid.UUID, accountNumber string, recipient string, route []string, payload interface{}, directive string) error {
+
+	probe := createProbe(ctx, "send_message_with_id")
+
+	probe.sendingMessage(accountNumber, recipient)
+
+	jsonBytes, err := marshalJobRequestWithID(messageID, accountNumber, recipient, payload, directive, controller.LaneFromContext(ctx), probe)
+	if err != nil {
+		return err
+	}
+
+	resp, err := makeHttpRequest(
+		ctx,
+		probe,
+		http.MethodPost,
+		rhp.generateUrl("job"),
+		rhp.AccountNumber,
+		rhp.Config,
+		bytes.NewBuffer(jsonBytes),
+	)
+
+	if err != nil {
+		probe.failedToMakeHttpRequest(err)
+		return errUnableToSendMessage
+	}
+
+	defer resp.Body.Close()
+
+	probe.recordHttpStatusCode(resp.StatusCode)
+
+	_, err = unmarshalJobResponse(resp, probe)
+	if err != nil {
+		return err
+	}
+
+	probe.messageSent(messageID)
+
+	return nil
+}
+
+func (rhp *ReceptorHttpProxy) SendMessageSync(ctx context.Context, accountNumber string, recipient string, route []string, payload interface{}, directive string, timeout time.Duration) (*controller.SyncJobResponse, error) {
+
+	probe := createProbe(ctx, "send_message_sync")
+
+	probe.sendingSyncMessage(accountNumber, recipient)
+
+	jsonBytes, err := marshalJobSyncRequest(accountNumber, recipient, payload, directive, timeout, probe)
+	if err != nil {
+		return nil, err
+	}
+
+	// The gateway holds the request open until the job completes, so allow
+	// the http request to run for the full timeout
+	resp, err := makeHttpRequestWithTimeout(
+		ctx,
+		probe,
+		http.MethodPost,
+		rhp.generateUrl("job/sync"),
+		rhp.AccountNumber,
+		rhp.Config,
+		timeout+rhp.Config.JobReceiverReceptorProxyTimeout,
+		bytes.NewBuffer(jsonBytes),
+	)
+
+	if err != nil {
+		probe.failedToMakeHttpRequest(err)
+		return nil, errUnableToSendMessage
+	}
+
+	defer resp.Body.Close()
+
+	probe.recordHttpStatusCode(resp.StatusCode)
+
+	jobSyncResponse, err := unmarshalJobSyncResponse(resp, probe)
+	if err != nil {
+		return nil, err
+	}
+
+	messageID, err := uuid.Parse(jobSyncResponse.JobID)
+	if err != nil {
+		probe.failedToUnmarshalResponse(err)
+		return nil, errUnableToProcessResponse
+	}
+
+	probe.syncMessageCompleted(messageID, jobSyncResponse.Status)
+
+	return &controller.SyncJobResponse{
+		MessageID: messageID,
+		Status:    jobSyncResponse.Status,
+		Responses: jobSyncResponse.Responses,
+	}, nil
+}
+
+func (rhp *ReceptorHttpProxy) SendMessageStream(ctx context.Context, accountNumber string, recipient string, route []string, payload interface{}, directive string) (*controller.ResponseStream, error) {
+
+	probe := createProbe(ctx, "send_message_stream")
+
+	probe.sendingStreamMessage(accountNumber, recipient)
+
+	jsonBytes, err := marshalJobRequest(accountNumber, recipient, payload, directive, probe)
+	if err != nil {
+		return nil, err
+	}
+
+	// The gateway holds the request open until the stream ends, so the
+	// lifetime of the http request is bound by the caller's context
+	resp, err := makeStreamingHttpRequest(
+		ctx,
+		probe,
+		http.MethodPost,
+		rhp.generateUrl("job/stream"),
+		rhp.AccountNumber,
+		rhp.Config,
+		bytes.NewBuffer(jsonBytes),
+	)
+
+	if err != nil {
+		probe.failedToMakeHttpRequest(err)
+		return nil, errUnableToSendMessage
+	}
+
+	probe.recordHttpStatusCode(resp.StatusCode)
+
+	eventReader, messageID, err := unmarshalJobStreamResponse(resp, probe)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	probe.streamStarted(messageID)
+
+	stream := controller.NewResponseStream(messageID, rhp.Config.BufferedChannelSize)
+
+	go func() {
+		defer resp.Body.Close()
+
+		status := readJobStreamEvents(ctx, eventReader, stream, probe)
+
+		probe.streamEnded(messageID, status)
+
+		stream.Close(status)
+	}()
+
+	return stream, nil
+}
+
+func (rhp *ReceptorHttpProxy) CancelMessage(ctx context.Context, accountNumber string, recipient string, messageID uuid.UUID) error {
+
+	probe := createProbe(ctx, "cancel_message")
+
+	probe.cancellingMessage(accountNumber, recipient, messageID)
+
+	resp, err := makeHttpRequest(
+		ctx,
+		probe,
+		http.MethodPost,
+		rhp.generateUrl(fmt.Sprintf("job/%s/cancel", messageID)),
+		rhp.AccountNumber,
+		rhp.Config,
+		nil,
+	)
+
+	if err != nil {
+		probe.failedToMakeHttpRequest(err)
+		return errUnableToSendMessage
+	}
+
+	defer resp.Body.Close()
+
+	probe.recordHttpStatusCode(resp.StatusCode)
+
+	if resp.StatusCode != http.StatusOK {
+		probe.invalidHttpStatusCode(resp.StatusCode)
+		return errorFromStatusCode(resp, probe)
+	}
+
+	probe.messageCancelled(messageID)
+
+	return nil
+}
+
 func (rhp *ReceptorHttpProxy) Ping(ctx context.Context, accountNumber string, recipient string, route []string) (interface{}, error) {
 	probe := createProbe(ctx, "ping")
 
@@ -165,6 +348,50 @@ func (rhp *ReceptorHttpProxy) GetCapabilities(ctx context.Context) (interface{},
 
 	probe.gettingCapabilities(rhp.AccountNumber, rhp.NodeID)
 
+	statusResponse, err := rhp.getConnectionStatus(ctx, probe)
+	if err != nil {
+		return nil, err
+	}
+
+	probe.retrievedCapabilities(rhp.AccountNumber, rhp.NodeID)
+
+	return statusResponse.Capabilities, nil
+}
+
+func (rhp *ReceptorHttpProxy) GetInFlightJobCount(ctx context.Context) (int, error) {
+	probe := createProbe(ctx, "get_in_flight_job_count")
+
+	probe.gettingInFlightJobCount(rhp.AccountNumber, rhp.NodeID)
+
+	statusResponse, err := rhp.getConnectionStatus(ctx, probe)
+	if err != nil {
+		return 0, err
+	}
+
+	probe.retrievedInFlightJobCount(rhp.AccountNumber, rhp.NodeID)
+
+	return statusResponse.InFlightJobs, nil
+}
+
+func (rhp *ReceptorHttpProxy) GetStatus(ctx context.Context) (*controller.ConnectionStatus, error) {
+	probe := createProbe(ctx, "get_status")
+
+	probe.gettingStatus(rhp.AccountNumber, rhp.NodeID)
+
+	statusResponse, err := rhp.getConnectionStatus(ctx, probe)
+	if err != nil {
+		return nil, err
+	}
+
+	probe.retrievedStatus(rhp.AccountNumber, rhp.NodeID)
+
+	return &controller.ConnectionStatus{
+		Capabilities: statusResponse.Capabilities,
+		InFlightJobs: statusResponse.InFlightJobs,
+	}, nil
+}
+
+func (rhp *ReceptorHttpProxy) getConnectionStatus(ctx context.Context, probe *receptorHttpProxyProbe) (*connectionStatusResponse, error) {
 	jsonBytes, err := marshalConnectionKey(rhp.AccountNumber, rhp.NodeID, probe)
 	if err != nil {
 		probe.failedToMarshalPayload(err)
@@ -195,13 +422,45 @@ func (rhp *ReceptorHttpProxy) GetCapabilities(ctx context.Context) (interface{},
 		return nil, err
 	}
 
-	probe.retrievedCapabilities(rhp.AccountNumber, rhp.NodeID)
-
 	if statusResponse.Status == DISCONNECTED_STATUS {
 		return nil, errDisconnectedNode
 	}
 
-	return statusResponse.Capabilities, nil
+	return statusResponse, nil
+}
+
+func (rhp *ReceptorHttpProxy) GetTopology(ctx context.Context) (*mesh_router.Topology, error) {
+	probe := createProbe(ctx, "get_topology")
+
+	probe.gettingTopology(rhp.AccountNumber, rhp.NodeID)
+
+	resp, err := makeHttpRequest(
+		ctx,
+		probe,
+		http.MethodGet,
+		rhp.generateUrl(fmt.Sprintf("connection/%s/%s/topology", rhp.AccountNumber, rhp.NodeID)),
+		rhp.AccountNumber,
+		rhp.Config,
+		nil,
+	)
+
+	if err != nil {
+		probe.failedToMakeHttpRequest(err)
+		return nil, errUnableToSendMessage
+	}
+
+	defer resp.Body.Close()
+
+	probe.recordHttpStatusCode(resp.StatusCode)
+
+	topologyResponse, err := unmarshalConnectionTopologyResponse(resp, probe)
+	if err != nil {
+		return nil, err
+	}
+
+	probe.retrievedTopology(rhp.AccountNumber, rhp.NodeID)
+
+	return &topologyResponse.Topology, nil
 }
 
 func (rhp *ReceptorHttpProxy) generateUrl(path string) string {
@@ -223,15 +482,30 @@ func marshalJobRequest(accountNumber, recipient string, payload interface{}, dir
 	return jsonBytes, nil
 }
 
+func marshalJobRequestWithID(messageID uuid.UUID, accountNumber, recipient string, payload interface{}, directive string, lane controller.Lane, probe *receptorHttpProxyProbe) ([]byte, error) {
+	postPayload := queueableJobRequest{
+		Account:   accountNumber,
+		Recipient: recipient,
+		Payload:   payload,
+		Directive: directive,
+		ID:        messageID.String(),
+		Lane:      string(lane),
+	}
+	jsonBytes, err := json.Marshal(postPayload)
+	if err != nil {
+		probe.failedToMarshalPayload(err)
+		return nil, errUnableToSendMessage
+	}
+
+	return jsonBytes, nil
+}
+
 func unmarshalJobResponse(resp *http.Response, probe *receptorHttpProxyProbe) (*jobResponse, error) {
 
 	jobResponse := jobResponse{}
 	if resp.StatusCode != http.StatusCreated {
 		probe.invalidHttpStatusCode(resp.StatusCode)
-		if resp.StatusCode == http.StatusNotFound {
-			return nil, errDisconnectedNode
-		}
-		return nil, errUnableToProcessResponse
+		return nil, errorFromStatusCode(resp, probe)
 	}
 
 	dec := json.NewDecoder(resp.Body)
@@ -243,6 +517,154 @@ func unmarshalJobResponse(resp *http.Response, probe *receptorHttpProxyProbe) (*
 	return &jobResponse, nil
 }
 
+// errorFromStatusCode maps the status code of a failed request to the
+// gateway onto the error that the gateway's receptor returned
+func errorFromStatusCode(resp *http.Response, probe *receptorHttpProxyProbe) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return errDisconnectedNode
+	case http.StatusServiceUnavailable:
+		overloadedResponse := connectionOverloadedResponse{}
+
+		dec := json.NewDecoder(resp.Body)
+		if err := dec.Decode(&overloadedResponse); err != nil {
+			probe.failedToUnmarshalResponse(err)
+			return errUnableToProcessResponse
+		}
+
+		// The 503 did not come from the gateway's receptor
+		if overloadedResponse.Lane == "" {
+			return errUnableToProcessResponse
+		}
+
+		return &controller.ConnectionOverloadedError{
+			Lane:          overloadedResponse.Lane,
+			QueueDepth:    overloadedResponse.QueueDepth,
+			QueueCapacity: overloadedResponse.QueueCapacity,
+		}
+	case http.StatusBadRequest:
+		violationResponse := schemaViolationResponse{}
+
+		dec := json.NewDecoder(resp.Body)
+		if err := dec.Decode(&violationResponse); err != nil {
+			probe.failedToUnmarshalResponse(err)
+			return errUnableToProcessResponse
+		}
+
+		// The gateway rejected the request for some other reason
+		if len(violationResponse.Violations) == 0 {
+			return errUnableToProcessResponse
+		}
+
+		return &remoteSchemaViolationError{response: violationResponse}
+	}
+
+	return errUnableToProcessResponse
+}
+
+func marshalJobSyncRequest(accountNumber, recipient string, payload interface{}, directive string, timeout time.Duration, probe *receptorHttpProxyProbe) ([]byte, error) {
+	postPayload := jobSyncRequest{
+		jobRequest: jobRequest{accountNumber, recipient, payload, directive},
+		Timeout:    int(timeout.Seconds()),
+	}
+	jsonBytes, err := json.Marshal(postPayload)
+	if err != nil {
+		probe.failedToMarshalPayload(err)
+		return nil, errUnableToSendMessage
+	}
+
+	return jsonBytes, nil
+}
+
+func unmarshalJobSyncResponse(resp *http.Response, probe *receptorHttpProxyProbe) (*jobSyncResponse, error) {
+
+	jobSyncResponse := jobSyncResponse{}
+	if resp.StatusCode != http.StatusOK {
+		probe.invalidHttpStatusCode(resp.StatusCode)
+		return nil, errorFromStatusCode(resp, probe)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&jobSyncResponse); err != nil {
+		probe.failedToUnmarshalResponse(err)
+		return nil, errUnableToProcessResponse
+	}
+
+	return &jobSyncResponse, nil
+}
+
+func unmarshalJobStreamResponse(resp *http.Response, probe *receptorHttpProxyProbe) (*serverSentEventReader, uuid.UUID, error) {
+	if resp.StatusCode != http.StatusOK {
+		probe.invalidHttpStatusCode(resp.StatusCode)
+		return nil, uuid.Nil, errorFromStatusCode(resp, probe)
+	}
+
+	eventReader := newServerSentEventReader(resp.Body)
+
+	// The first event on the stream identifies the job
+	event, err := eventReader.ReadEvent()
+	if err != nil {
+		probe.failedToUnmarshalResponse(err)
+		return nil, uuid.Nil, errUnableToProcessResponse
+	}
+
+	if event.Event != jobStreamJobEvent {
+		probe.failedToUnmarshalResponse(fmt.Errorf("unexpected event: %s", event.Event))
+		return nil, uuid.Nil, errUnableToProcessResponse
+	}
+
+	jobResponse := jobResponse{}
+	if err := json.Unmarshal(event.Data, &jobResponse); err != nil {
+		probe.failedToUnmarshalResponse(err)
+		return nil, uuid.Nil, errUnableToProcessResponse
+	}
+
+	messageID, err := uuid.Parse(jobResponse.JobID)
+	if err != nil {
+		probe.failedToUnmarshalResponse(err)
+		return nil, uuid.Nil, errUnableToProcessResponse
+	}
+
+	return eventReader, messageID, nil
+}
+
+// readJobStreamEvents passes the responses read from the gateway to the
+// stream and returns the status with which the stream ended
+func readJobStreamEvents(ctx context.Context, eventReader *serverSentEventReader, stream *controller.ResponseStream, probe *receptorHttpProxyProbe) string {
+	for {
+		event, err := eventReader.ReadEvent()
+		if err != nil {
+			if ctx.Err() != nil {
+				return controller.ResponsesCancelled
+			}
+			probe.failedToUnmarshalResponse(err)
+			return controller.ResponsesDisconnected
+		}
+
+		switch event.Event {
+		case jobStreamResponseEvent:
+			var responseMsg controller.ResponseMessage
+			if err := json.Unmarshal(event.Data, &responseMsg); err != nil {
+				probe.failedToUnmarshalResponse(err)
+				continue
+			}
+
+			if stream.Send(ctx, responseMsg) == false {
+				return controller.ResponsesCancelled
+			}
+
+		case jobStreamEndEvent:
+			var endResponse jobStreamEndResponse
+			if err := json.Unmarshal(event.Data, &endResponse); err != nil {
+				probe.failedToUnmarshalResponse(err)
+				return controller.ResponsesDisconnected
+			}
+
+			return endResponse.Status
+		}
+	}
+}
+
 func unmarshalConnectionPingResponse(resp *http.Response, probe *receptorHttpProxyProbe) (*connectionPingResponse, error) {
 	if resp.StatusCode != http.StatusOK {
 		probe.invalidHttpStatusCode(resp.StatusCode)
@@ -277,6 +699,26 @@ func unmarshalConnectionStatusResponse(resp *http.Response, probe *receptorHttpP
 	return &statusResponse, nil
 }
 
+func unmarshalConnectionTopologyResponse(resp *http.Response, probe *receptorHttpProxyProbe) (*connectionTopologyResponse, error) {
+	if resp.StatusCode != http.StatusOK {
+		probe.invalidHttpStatusCode(resp.StatusCode)
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, errDisconnectedNode
+		}
+		return nil, errUnableToProcessResponse
+	}
+
+	topologyResponse := connectionTopologyResponse{}
+
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&topologyResponse); err != nil {
+		probe.failedToUnmarshalResponse(err)
+		return nil, errUnableToProcessResponse
+	}
+
+	return &topologyResponse, nil
+}
+
 func marshalConnectionKey(accountNumber, recipient string, probe *receptorHttpProxyProbe) ([]byte, error) {
 	postPayload := connectionID{accountNumber, recipient}
 	jsonBytes, err := json.Marshal(postPayload)
@@ -287,8 +729,12 @@ func marshalConnectionKey(accountNumber, recipient string, probe *receptorHttpPr
 }
 
 func makeHttpRequest(ctx context.Context, probe *receptorHttpProxyProbe, method, url, accountNumber string, config *config.Config, body io.Reader) (*http.Response, error) {
+	return makeHttpRequestWithTimeout(ctx, probe, method, url, accountNumber, config, config.JobReceiverReceptorProxyTimeout, body)
+}
 
-	ctx, cancel := context.WithTimeout(ctx, config.JobReceiverReceptorProxyTimeout)
+func makeHttpRequestWithTimeout(ctx context.Context, probe *receptorHttpProxyProbe, method, url, accountNumber string, config *config.Config, timeout time.Duration, body io.Reader) (*http.Response, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	req, err := http.NewRequest(method, url, body)
@@ -310,6 +756,28 @@ func makeHttpRequest(ctx context.Context, probe *receptorHttpProxyProbe, method,
 	return resp, err
 }
 
+func makeStreamingHttpRequest(ctx context.Context, probe *receptorHttpProxyProbe, method, url, accountNumber string, config *config.Config, body io.Reader) (*http.Response, error) {
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	addPreSharedKeyHeaders(req.Header, config, accountNumber)
+
+	addRequestIdHeader(req.Header, ctx)
+
+	startTime := time.Now()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	elapsedTime := time.Since(startTime)
+	probe.recordRemoteCallDuration(elapsedTime)
+
+	return resp, err
+}
+
 func addPreSharedKeyHeaders(headers http.Header, config *config.Config, accountNumber string) {
 	clientID := config.JobReceiverReceptorProxyClientID
 	psk := config.JobReceiverReceptorProxyPSK
@@ -77,6 +77,40 @@ func (rhpp *receptorHttpProxyProbe) messageSent(messageID uuid.UUID) {
 	rhpp.logger.WithFields(logrus.Fields{"message_id": messageID}).Info("Message sent to receptor-gateway")
 }
 
+func (rhpp *receptorHttpProxyProbe) sendingSyncMessage(accountNumber, recipient string) {
+	rhpp.logger.Infof("Sending sync message to receptor-gateway - %s:%s\n", accountNumber, recipient)
+}
+
+func (rhpp *receptorHttpProxyProbe) syncMessageCompleted(messageID uuid.UUID, status string) {
+	metrics.receptorProxyRemoteCallCounter.With(
+		prometheus.Labels{"operation": "sync_message"}).Inc()
+	rhpp.logger.WithFields(logrus.Fields{"message_id": messageID, "status": status}).Info("Sync message completed by receptor-gateway")
+}
+
+func (rhpp *receptorHttpProxyProbe) sendingStreamMessage(accountNumber, recipient string) {
+	rhpp.logger.Infof("Sending streaming message to receptor-gateway - %s:%s\n", accountNumber, recipient)
+}
+
+func (rhpp *receptorHttpProxyProbe) streamStarted(messageID uuid.UUID) {
+	metrics.receptorProxyRemoteCallCounter.With(
+		prometheus.Labels{"operation": "stream_message"}).Inc()
+	rhpp.logger.WithFields(logrus.Fields{"message_id": messageID}).Info("Streaming responses from receptor-gateway")
+}
+
+func (rhpp *receptorHttpProxyProbe) streamEnded(messageID uuid.UUID, status string) {
+	rhpp.logger.WithFields(logrus.Fields{"message_id": messageID, "status": status}).Info("Finished streaming responses from receptor-gateway")
+}
+
+func (rhpp *receptorHttpProxyProbe) cancellingMessage(accountNumber, recipient string, messageID uuid.UUID) {
+	rhpp.logger.WithFields(logrus.Fields{"message_id": messageID}).Infof("Sending cancel message to receptor-gateway - %s:%s\n", accountNumber, recipient)
+}
+
+func (rhpp *receptorHttpProxyProbe) messageCancelled(messageID uuid.UUID) {
+	metrics.receptorProxyRemoteCallCounter.With(
+		prometheus.Labels{"operation": "cancel_message"}).Inc()
+	rhpp.logger.WithFields(logrus.Fields{"message_id": messageID}).Info("Cancel message sent to receptor-gateway")
+}
+
 func (rhpp *receptorHttpProxyProbe) sendingPing(accountNumber, recipient string) {
 	rhpp.logger.Infof("Sending ping message to receptor-gateway - %s:%s\n", accountNumber, recipient)
 }
@@ -107,6 +141,36 @@ func (rhpp *receptorHttpProxyProbe) retrievedCapabilities(accountNumber, recipie
 	rhpp.logger.WithFields(logrus.Fields{"recipient": recipient}).Info("Got node capabilities from receptor-gateway")
 }
 
+func (rhpp *receptorHttpProxyProbe) gettingInFlightJobCount(accountNumber, recipient string) {
+	rhpp.logger.WithFields(logrus.Fields{"recipient": recipient}).Info("Getting in flight job count from receptor-gateway")
+}
+
+func (rhpp *receptorHttpProxyProbe) retrievedInFlightJobCount(accountNumber, recipient string) {
+	metrics.receptorProxyRemoteCallCounter.With(
+		prometheus.Labels{"operation": "get_in_flight_job_count"}).Inc()
+	rhpp.logger.WithFields(logrus.Fields{"recipient": recipient}).Info("Got in flight job count from receptor-gateway")
+}
+
+func (rhpp *receptorHttpProxyProbe) gettingStatus(accountNumber, recipient string) {
+	rhpp.logger.WithFields(logrus.Fields{"recipient": recipient}).Info("Getting node status from receptor-gateway")
+}
+
+func (rhpp *receptorHttpProxyProbe) retrievedStatus(accountNumber, recipient string) {
+	metrics.receptorProxyRemoteCallCounter.With(
+		prometheus.Labels{"operation": "get_status"}).Inc()
+	rhpp.logger.WithFields(logrus.Fields{"recipient": recipient}).Info("Got node status from receptor-gateway")
+}
+
+func (rhpp *receptorHttpProxyProbe) gettingTopology(accountNumber, recipient string) {
+	rhpp.logger.WithFields(logrus.Fields{"recipient": recipient}).Info("Getting mesh topology from receptor-gateway")
+}
+
+func (rhpp *receptorHttpProxyProbe) retrievedTopology(accountNumber, recipient string) {
+	metrics.receptorProxyRemoteCallCounter.With(
+		prometheus.Labels{"operation": "get_topology"}).Inc()
+	rhpp.logger.WithFields(logrus.Fields{"recipient": recipient}).Info("Got mesh topology from receptor-gateway")
+}
+
 func (rhpp *receptorHttpProxyProbe) recordRemoteCallDuration(callDuration time.Duration) {
 	metrics.receptorProxyRemoteCallDuration.With(
 		prometheus.Labels{"operation": rhpp.operationName}).Observe(callDuration.Seconds())
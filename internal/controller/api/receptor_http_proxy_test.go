@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/controller"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestReceptorHttpProxy(t *testing.T) (*ReceptorHttpProxy, func()) {
+	cfg := config.GetConfig()
+	cfg.JobReceiverReceptorProxyPSK = "12345"
+	cfg.ServiceToServiceCredentials = map[string]interface{}{cfg.JobReceiverReceptorProxyClientID: "12345"}
+
+	cm := controller.NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "345", MockClient{})
+	cm.Register(context.TODO(), "1234", "overloaded", MockClient{overloaded: true})
+
+	directiveSchemas := controller.NewDirectiveSchemaRegistry()
+	directiveSchemas.Register(controller.DirectiveSchema{
+		Directive: "worker:validated",
+		Payload:   json.RawMessage(`{"type": "array"}`),
+		Response:  json.RawMessage(`{"type": "object", "required": ["status"]}`),
+	})
+
+	apiMux := mux.NewRouter()
+	jr := NewJobReceiver(cm, controller.NewInMemoryJobRegistry(cfg), controller.NewInMemoryJobQueue(), controller.NewInMemoryJobDeduplicator(cfg), nil, directiveSchemas, apiMux, cfg)
+	jr.Routes()
+
+	server := httptest.NewServer(apiMux)
+
+	serverURL, _ := url.Parse(server.URL)
+	cfg.JobReceiverReceptorProxyPort, _ = strconv.Atoi(serverURL.Port())
+
+	proxy := &ReceptorHttpProxy{
+		Hostname:      serverURL.Hostname(),
+		AccountNumber: "1234",
+		NodeID:        "345",
+		Config:        cfg,
+	}
+
+	return proxy, server.Close
+}
+
+func TestReceptorHttpProxySendMessageSync(t *testing.T) {
+	proxy, closeServer := newTestReceptorHttpProxy(t)
+	defer closeServer()
+
+	response, err := proxy.SendMessageSync(context.TODO(), "1234", "345", []string{"345"}, "payload", "worker:action", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if response.Status != controller.ResponsesCompleted {
+		t.Fatalf("Status was incorrect, got: %s, want: %s", response.Status, controller.ResponsesCompleted)
+	}
+
+	if len(response.Responses) != 2 {
+		t.Fatalf("Expected 2 responses, got: %v", response.Responses)
+	}
+}
+
+func TestReceptorHttpProxySendMessageStream(t *testing.T) {
+	proxy, closeServer := newTestReceptorHttpProxy(t)
+	defer closeServer()
+
+	stream, err := proxy.SendMessageStream(context.TODO(), "1234", "345", []string{"345"}, "payload", "worker:action")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	responses := []controller.ResponseMessage{}
+	for responseMsg := range stream.Responses() {
+		responses = append(responses, responseMsg)
+	}
+
+	if stream.Status() != controller.ResponsesCompleted {
+		t.Fatalf("Status was incorrect, got: %s, want: %s", stream.Status(), controller.ResponsesCompleted)
+	}
+
+	if len(responses) != 2 || responses[1].MessageType != controller.ResponseMessageTypeEOF {
+		t.Fatalf("Responses were incorrect, got: %v", responses)
+	}
+
+	for _, responseMsg := range responses {
+		if responseMsg.InResponseTo != stream.MessageID.String() {
+			t.Fatalf("Response was not for message %s, got: %v", stream.MessageID, responseMsg)
+		}
+	}
+}
+
+func TestReceptorHttpProxySendMessageStreamToDisconnectedNode(t *testing.T) {
+	proxy, closeServer := newTestReceptorHttpProxy(t)
+	defer closeServer()
+
+	proxy.NodeID = "not-connected"
+
+	_, err := proxy.SendMessageStream(context.TODO(), "1234", "not-connected", []string{"not-connected"}, "payload", "worker:action")
+	if err != errDisconnectedNode {
+		t.Fatalf("Expected errDisconnectedNode, got: %v", err)
+	}
+}
+
+func TestReceptorHttpProxySendMessageToOverloadedNode(t *testing.T) {
+	proxy, closeServer := newTestReceptorHttpProxy(t)
+	defer closeServer()
+
+	proxy.NodeID = "overloaded"
+
+	_, err := proxy.SendMessage(context.TODO(), "1234", "overloaded", []string{"overloaded"}, "payload", "worker:action")
+
+	overloadedErr, ok := err.(*controller.ConnectionOverloadedError)
+	if !ok {
+		t.Fatalf("Expected a ConnectionOverloadedError, got: %v", err)
+	}
+
+	if *overloadedErr != *errMockOverloaded {
+		t.Fatalf("Overloaded error was incorrect, got: %+v, want: %+v", overloadedErr, errMockOverloaded)
+	}
+}
+
+func TestReceptorHttpProxySchemaViolations(t *testing.T) {
+	proxy, closeServer := newTestReceptorHttpProxy(t)
+	defer closeServer()
+
+	_, err := proxy.SendMessage(context.TODO(), "1234", "345", []string{"345"}, "payload", "worker:validated")
+
+	violationErr, ok := err.(*remoteSchemaViolationError)
+	if !ok {
+		t.Fatalf("Expected a remoteSchemaViolationError, got: %v", err)
+	}
+
+	if violationErr.response.Status != http.StatusBadRequest || len(violationErr.response.Violations) != 1 {
+		t.Fatalf("Schema violation was incorrect, got: %+v", violationErr.response)
+	}
+
+	// The responses that do not match the schema are passed on with their
+	// violations attached
+	_, err = proxy.SendMessageSync(context.TODO(), "1234", "345", []string{"345"}, []string{"payload"}, "worker:validated", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+}
+
+func TestReceptorHttpProxyGetStatus(t *testing.T) {
+	var statusRequests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/connection/status" {
+			http.NotFound(w, req)
+			return
+		}
+
+		atomic.AddInt32(&statusRequests, 1)
+		writeJSONResponse(w, http.StatusOK, connectionStatusResponse{
+			Status:       CONNECTED_STATUS,
+			Capabilities: map[string]interface{}{"max_work_threads": 12.0},
+			InFlightJobs: 3,
+		})
+	}))
+	defer server.Close()
+
+	cfg := config.GetConfig()
+	serverURL, _ := url.Parse(server.URL)
+	cfg.JobReceiverReceptorProxyPort, _ = strconv.Atoi(serverURL.Port())
+
+	proxy := &ReceptorHttpProxy{
+		Hostname:      serverURL.Hostname(),
+		AccountNumber: "1234",
+		NodeID:        "345",
+		Config:        cfg,
+	}
+
+	status, err := proxy.GetStatus(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if status.InFlightJobs != 3 || status.Capabilities.(map[string]interface{})["max_work_threads"] != 12.0 {
+		t.Fatalf("Status was incorrect, got: %+v", status)
+	}
+
+	if requests := atomic.LoadInt32(&statusRequests); requests != 1 {
+		t.Fatalf("Expected the status to be retrieved with 1 request, got: %d", requests)
+	}
+}
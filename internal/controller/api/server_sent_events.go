@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	jobStreamJobEvent      = "job"
+	jobStreamResponseEvent = "response"
+	jobStreamEndEvent      = "end"
+)
+
+type serverSentEvent struct {
+	Event string
+	Data  []byte
+}
+
+func writeServerSentEventHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeServerSentEvent(w http.ResponseWriter, flusher http.Flusher, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+
+	flusher.Flush()
+
+	return nil
+}
+
+type serverSentEventReader struct {
+	reader *bufio.Reader
+}
+
+func newServerSentEventReader(r io.Reader) *serverSentEventReader {
+	return &serverSentEventReader{reader: bufio.NewReader(r)}
+}
+
+// ReadEvent reads the next event from the stream.  Comments and fields other
+// than event and data are ignored.
+func (r *serverSentEventReader) ReadEvent() (*serverSentEvent, error) {
+	event := &serverSentEvent{}
+	var data bytes.Buffer
+	hasData := false
+
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if event.Event == "" && hasData == false {
+				continue
+			}
+			event.Data = data.Bytes()
+			return event, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field = line[:i]
+			value = strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		}
+	}
+}
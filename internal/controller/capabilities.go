@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CapabilityFilter selects the nodes whose capabilities include a worker
+// plugin.  The capabilities are reported by the node during the handshake.
+//
+//	{
+//	  "max_work_threads": 12,
+//	  "worker_versions": {
+//	    "receptor_http": "1.0.0"
+//	  }
+//	}
+//
+// If a minimum version is given, the version of the worker plugin must be
+// greater than or equal to it.
+type CapabilityFilter struct {
+	Worker     string `json:"worker" validate:"required"`
+	MinVersion string `json:"min_version,omitempty"`
+}
+
+// Matches returns true if the node has the worker plugin installed
+func (f *CapabilityFilter) Matches(capabilities interface{}) bool {
+	version, exists := getWorkerVersions(capabilities)[f.Worker]
+	if exists == false {
+		return false
+	}
+
+	if f.MinVersion == "" {
+		return true
+	}
+
+	return compareVersions(version, f.MinVersion) >= 0
+}
+
+// getWorkerVersions returns the versions of the worker plugins keyed by the
+// name of the plugin
+func getWorkerVersions(capabilities interface{}) map[string]string {
+	workerVersions := make(map[string]string)
+
+	capabilitiesMap, ok := capabilities.(map[string]interface{})
+	if ok == false {
+		return workerVersions
+	}
+
+	versions, ok := capabilitiesMap["worker_versions"].(map[string]interface{})
+	if ok == false {
+		return workerVersions
+	}
+
+	for worker, version := range versions {
+		versionString, _ := version.(string)
+		workerVersions[worker] = versionString
+	}
+
+	return workerVersions
+}
+
+// compareVersions compares dotted version numbers (for example, "1.10.2")
+// part by part.  Missing parts are treated as zero.  Parts that are not
+// numbers are compared as strings.
+func compareVersions(a string, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aPart, bPart := "0", "0"
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+
+		aNumber, aErr := strconv.Atoi(aPart)
+		bNumber, bErr := strconv.Atoi(bPart)
+
+		switch {
+		case aErr == nil && bErr == nil && aNumber != bNumber:
+			if aNumber < bNumber {
+				return -1
+			}
+			return 1
+		case (aErr != nil || bErr != nil) && aPart != bPart:
+			return strings.Compare(aPart, bPart)
+		}
+	}
+
+	return 0
+}
+
+// LocateConnectionByCapability picks a node of the account that is connected
+// to the cloud directly and matches the capability filter.  The node with the
+// fewest jobs in flight is preferred.  Ties are broken by node id.  An empty
+// node id is returned if none of the nodes match.
+func LocateConnectionByCapability(ctx context.Context, cl ConnectionLocator, account string, filter *CapabilityFilter) (string, Receptor) {
+	log := logger.Log.WithFields(logrus.Fields{"account": account, "worker": filter.Worker, "min_version": filter.MinVersion})
+
+	connections := cl.GetConnectionsByAccount(ctx, account)
+
+	nodeIDs := make([]string, 0, len(connections))
+	for nodeID := range connections {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Strings(nodeIDs)
+
+	var selectedNodeID string
+	var selectedClient Receptor
+	var selectedInFlightJobs int
+
+	for _, nodeID := range nodeIDs {
+		client := connections[nodeID]
+		if client == nil {
+			continue
+		}
+
+		// The capabilities and the in flight job count are retrieved
+		// together so that a node on another gateway pod costs one request
+		status, err := client.GetStatus(ctx)
+		if err != nil {
+			log.WithFields(logrus.Fields{"error": err, "node_id": nodeID}).Warn("Unable to retrieve the status of the node")
+			continue
+		}
+
+		if filter.Matches(status.Capabilities) == false {
+			continue
+		}
+
+		if selectedClient == nil || status.InFlightJobs < selectedInFlightJobs {
+			selectedNodeID = nodeID
+			selectedClient = client
+			selectedInFlightJobs = status.InFlightJobs
+		}
+	}
+
+	if selectedClient != nil {
+		log.WithFields(logrus.Fields{"node_id": selectedNodeID, "in_flight_jobs": selectedInFlightJobs}).Debug("Selected a node by capability")
+	}
+
+	return selectedNodeID, selectedClient
+}
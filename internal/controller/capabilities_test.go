@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCapabilityFilterMatches(t *testing.T) {
+	capabilities := map[string]interface{}{
+		"max_work_threads": 12,
+		"worker_versions": map[string]interface{}{
+			"receptor_http": "1.0.0",
+		},
+	}
+
+	tests := []struct {
+		worker       string
+		capabilities interface{}
+		expected     bool
+	}{
+		{"receptor_http", capabilities, true},
+		{"receptor_satellite", capabilities, false},
+		{"receptor_http", struct{}{}, false},
+		{"receptor_http", map[string]interface{}{"worker_versions": "invalid"}, false},
+	}
+
+	for _, test := range tests {
+		filter := CapabilityFilter{Worker: test.worker}
+		if actual := filter.Matches(test.capabilities); actual != test.expected {
+			t.Fatalf("Matches(%s, %v) was incorrect, got: %t, want: %t", test.worker, test.capabilities, actual, test.expected)
+		}
+	}
+}
+
+func TestCapabilityFilterMinVersion(t *testing.T) {
+	capabilities := map[string]interface{}{
+		"worker_versions": map[string]interface{}{
+			"receptor_http": "1.10.2",
+		},
+	}
+
+	tests := []struct {
+		minVersion string
+		expected   bool
+	}{
+		{"1.10.2", true},
+		{"1.9", true},
+		{"1.10.3", false},
+		{"2", false},
+	}
+
+	for _, test := range tests {
+		filter := CapabilityFilter{Worker: "receptor_http", MinVersion: test.minVersion}
+		if actual := filter.Matches(capabilities); actual != test.expected {
+			t.Fatalf("Matches(%s) was incorrect, got: %t, want: %t", test.minVersion, actual, test.expected)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0", "1.0.0", 0},
+		{"v1.2.0", "1.2", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"1.9.0", "1.10.0", -1},
+		{"1.0.0-beta", "1.0.0-alpha", 1},
+	}
+
+	for _, test := range tests {
+		if actual := compareVersions(test.a, test.b); actual != test.expected {
+			t.Fatalf("compareVersions(%s, %s) was incorrect, got: %d, want: %d", test.a, test.b, actual, test.expected)
+		}
+	}
+}
+
+// loadedReceptor reports fixed capabilities and in flight job count
+type loadedReceptor struct {
+	MockReceptor
+	capabilities interface{}
+	inFlightJobs int
+}
+
+func (lr *loadedReceptor) GetCapabilities(context.Context) (interface{}, error) {
+	return lr.capabilities, nil
+}
+
+func (lr *loadedReceptor) GetInFlightJobCount(context.Context) (int, error) {
+	return lr.inFlightJobs, nil
+}
+
+func (lr *loadedReceptor) GetStatus(context.Context) (*ConnectionStatus, error) {
+	return &ConnectionStatus{Capabilities: lr.capabilities, InFlightJobs: lr.inFlightJobs}, nil
+}
+
+func newLoadedReceptor(version string, inFlightJobs int) *loadedReceptor {
+	return &loadedReceptor{
+		capabilities: map[string]interface{}{
+			"worker_versions": map[string]interface{}{"receptor_http": version},
+		},
+		inFlightJobs: inFlightJobs,
+	}
+}
+
+func TestLocateConnectionByCapability(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "0000001", "node-a", newLoadedReceptor("1.0.0", 5))
+	cm.Register(context.TODO(), "0000001", "node-b", newLoadedReceptor("1.0.0", 1))
+	cm.Register(context.TODO(), "0000001", "node-c", newLoadedReceptor("2.0.0", 3))
+	cm.Register(context.TODO(), "0000001", "node-d", &MockReceptor{})
+
+	tests := []struct {
+		filter   CapabilityFilter
+		expected string
+	}{
+		{CapabilityFilter{Worker: "receptor_http"}, "node-b"},
+		{CapabilityFilter{Worker: "receptor_http", MinVersion: "2.0"}, "node-c"},
+		{CapabilityFilter{Worker: "receptor_http", MinVersion: "3.0"}, ""},
+		{CapabilityFilter{Worker: "receptor_satellite"}, ""},
+	}
+
+	for _, test := range tests {
+		nodeID, client := LocateConnectionByCapability(context.TODO(), cm, "0000001", &test.filter)
+		if nodeID != test.expected || (client == nil) != (test.expected == "") {
+			t.Fatalf("Selected node was incorrect for %v, got: %s, want: %s", test.filter, nodeID, test.expected)
+		}
+	}
+}
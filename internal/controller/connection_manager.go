@@ -3,8 +3,10 @@ package controller
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/mesh_router"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -12,9 +14,23 @@ import (
 
 type Receptor interface {
 	SendMessage(context.Context, string, string, []string, interface{}, string) (*uuid.UUID, error)
+	SendMessageWithID(context.Context, uuid.UUID, string, string, []string, interface{}, string) error
+	SendMessageSync(context.Context, string, string, []string, interface{}, string, time.Duration) (*SyncJobResponse, error)
+	SendMessageStream(context.Context, string, string, []string, interface{}, string) (*ResponseStream, error)
+	CancelMessage(context.Context, string, string, uuid.UUID) error
 	Ping(context.Context, string, string, []string) (interface{}, error)
 	Close(context.Context) error
 	GetCapabilities(context.Context) (interface{}, error)
+	GetInFlightJobCount(context.Context) (int, error)
+	GetStatus(context.Context) (*ConnectionStatus, error)
+	GetTopology(context.Context) (*mesh_router.Topology, error)
+}
+
+// ConnectionStatus holds the capabilities of a connected node along with the
+// number of jobs in flight on its connection
+type ConnectionStatus struct {
+	Capabilities interface{}
+	InFlightJobs int
 }
 
 type DuplicateConnectionError struct {
@@ -3,8 +3,10 @@ package controller
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/mesh_router"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
@@ -23,6 +25,22 @@ func (mr *MockReceptor) SendMessage(context.Context, string, string, []string, i
 	return nil, nil
 }
 
+func (mr *MockReceptor) SendMessageWithID(context.Context, uuid.UUID, string, string, []string, interface{}, string) error {
+	return nil
+}
+
+func (mr *MockReceptor) CancelMessage(context.Context, string, string, uuid.UUID) error {
+	return nil
+}
+
+func (mr *MockReceptor) SendMessageSync(context.Context, string, string, []string, interface{}, string, time.Duration) (*SyncJobResponse, error) {
+	return nil, nil
+}
+
+func (mr *MockReceptor) SendMessageStream(context.Context, string, string, []string, interface{}, string) (*ResponseStream, error) {
+	return nil, nil
+}
+
 func (mr *MockReceptor) Ping(context.Context, string, string, []string) (interface{}, error) {
 	return nil, nil
 }
@@ -35,6 +53,18 @@ func (mr *MockReceptor) GetCapabilities(context.Context) (interface{}, error) {
 	return nil, nil
 }
 
+func (mr *MockReceptor) GetInFlightJobCount(context.Context) (int, error) {
+	return 0, nil
+}
+
+func (mr *MockReceptor) GetStatus(context.Context) (*ConnectionStatus, error) {
+	return &ConnectionStatus{}, nil
+}
+
+func (mr *MockReceptor) GetTopology(context.Context) (*mesh_router.Topology, error) {
+	return nil, nil
+}
+
 func TestCheckForLocalConnectionThatDoesNotExist(t *testing.T) {
 	var cl ConnectionLocator
 	cl = NewLocalConnectionManager()
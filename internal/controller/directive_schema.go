@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// DirectiveSchemaViolationError lists the ways in which a payload does not
+// match the JSON Schema of its directive
+type DirectiveSchemaViolationError struct {
+	Directive  string
+	Violations []string
+}
+
+func (e *DirectiveSchemaViolationError) Error() string {
+	return fmt.Sprintf("payload does not match the schema of the %s directive: %s",
+		e.Directive, strings.Join(e.Violations, "; "))
+}
+
+// DirectiveSchema is the definition of the schemas of a directive.  The
+// schemas are loaded from json files that look like this:
+//
+//	{
+//	  "directive": "receptor_satellite:execute",
+//	  "payload": { "type": "object", "required": ["playbook_run_id"] },
+//	  "response": { "type": "object" }
+//	}
+//
+// The payload schema applies to the payloads of the jobs that are sent with
+// the directive.  The response schema applies to the payloads of the
+// responses to those jobs.  Either schema can be left out.
+type DirectiveSchema struct {
+	Directive string          `json:"directive"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Response  json.RawMessage `json:"response,omitempty"`
+}
+
+type compiledDirectiveSchema struct {
+	payload  *jsonschema.Schema
+	response *jsonschema.Schema
+}
+
+// DirectiveSchemaRegistry maps directive names to the JSON Schemas of their
+// payloads.  The payloads of directives without a schema are not validated.
+type DirectiveSchemaRegistry struct {
+	schemas map[string]compiledDirectiveSchema
+}
+
+func NewDirectiveSchemaRegistry() *DirectiveSchemaRegistry {
+	return &DirectiveSchemaRegistry{schemas: make(map[string]compiledDirectiveSchema)}
+}
+
+// LoadDirectiveSchemas registers the schemas in each of the json files in the
+// directory.  An empty registry is returned if the directory is not set.
+func LoadDirectiveSchemas(dir string) (*DirectiveSchemaRegistry, error) {
+	registry := NewDirectiveSchemaRegistry()
+	if dir == "" {
+		return registry, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var directiveSchema DirectiveSchema
+		if err := json.Unmarshal(b, &directiveSchema); err != nil {
+			return nil, fmt.Errorf("invalid directive schema file (%s): %w", file, err)
+		}
+
+		if err := registry.Register(directiveSchema); err != nil {
+			return nil, fmt.Errorf("invalid directive schema file (%s): %w", file, err)
+		}
+	}
+
+	return registry, nil
+}
+
+// Register compiles the schemas of a directive and adds them to the registry
+func (r *DirectiveSchemaRegistry) Register(directiveSchema DirectiveSchema) error {
+	if directiveSchema.Directive == "" {
+		return errors.New("the directive is missing")
+	}
+
+	if _, exists := r.schemas[directiveSchema.Directive]; exists {
+		return fmt.Errorf("directive (%s) already has a schema", directiveSchema.Directive)
+	}
+
+	payloadSchema, err := compileSchema(directiveSchema.Directive, "payload", directiveSchema.Payload)
+	if err != nil {
+		return err
+	}
+
+	responseSchema, err := compileSchema(directiveSchema.Directive, "response", directiveSchema.Response)
+	if err != nil {
+		return err
+	}
+
+	r.schemas[directiveSchema.Directive] = compiledDirectiveSchema{payload: payloadSchema, response: responseSchema}
+
+	return nil
+}
+
+func compileSchema(directive string, kind string, schema json.RawMessage) (*jsonschema.Schema, error) {
+	if len(schema) == 0 {
+		return nil, nil
+	}
+
+	// The url only identifies the schema.  The schema is never fetched.
+	schemaURL := fmt.Sprintf("directive:///%s/%s.json", url.PathEscape(directive), kind)
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(schemaURL, bytes.NewReader(schema)); err != nil {
+		return nil, err
+	}
+
+	return compiler.Compile(schemaURL)
+}
+
+// ValidatePayload validates the payload of a job against the payload schema
+// of its directive.  A DirectiveSchemaViolationError is returned if the
+// payload does not match the schema.
+func (r *DirectiveSchemaRegistry) ValidatePayload(directive string, payload interface{}) error {
+	if r == nil {
+		return nil
+	}
+
+	return validate(directive, "payload", r.schemas[directive].payload, payload)
+}
+
+// ValidateResponse validates the payload of a response against the response
+// schema of the directive of the job
+func (r *DirectiveSchemaRegistry) ValidateResponse(directive string, payload interface{}) error {
+	if r == nil {
+		return nil
+	}
+
+	return validate(directive, "response", r.schemas[directive].response, payload)
+}
+
+func validate(directive string, kind string, schema *jsonschema.Schema, payload interface{}) error {
+	if schema == nil {
+		return nil
+	}
+
+	// The schema is validated against the payload as it appears on the wire
+	instance, err := toJSONValue(payload)
+	if err != nil {
+		return err
+	}
+
+	err = schema.Validate(instance)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) == false {
+		return err
+	}
+
+	metrics.directiveSchemaViolationCounter.With(prometheus.Labels{"directive": directive, "kind": kind}).Inc()
+
+	return &DirectiveSchemaViolationError{Directive: directive, Violations: violations(validationErr)}
+}
+
+func toJSONValue(payload interface{}) (interface{}, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// violations lists the leaves of the validation error tree.  The inner nodes
+// only say that one of their children failed.
+func violations(validationErr *jsonschema.ValidationError) []string {
+	if len(validationErr.Causes) == 0 {
+		location := validationErr.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return []string{fmt.Sprintf("%s: %s", location, validationErr.Message)}
+	}
+
+	var leaves []string
+	for _, cause := range validationErr.Causes {
+		leaves = append(leaves, violations(cause)...)
+	}
+	return leaves
+}
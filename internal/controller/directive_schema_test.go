@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testPayloadSchema = `{
+	"type": "object",
+	"required": ["command"],
+	"properties": {
+		"command": {"type": "string"},
+		"timeout": {"type": "integer", "minimum": 1}
+	}
+}`
+
+func newTestDirectiveSchemaRegistry(t *testing.T) *DirectiveSchemaRegistry {
+	registry := NewDirectiveSchemaRegistry()
+
+	err := registry.Register(DirectiveSchema{
+		Directive: "receptor_satellite:execute",
+		Payload:   json.RawMessage(testPayloadSchema),
+		Response:  json.RawMessage(`{"type": "object", "required": ["status"]}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return registry
+}
+
+func TestDirectiveSchemaRegistryValidatePayload(t *testing.T) {
+	registry := newTestDirectiveSchemaRegistry(t)
+
+	subTests := map[string]struct {
+		directive          string
+		payload            interface{}
+		expectedViolations int
+	}{
+		"valid payload":            {"receptor_satellite:execute", map[string]interface{}{"command": "ls", "timeout": 5}, 0},
+		"missing required field":   {"receptor_satellite:execute", map[string]interface{}{"timeout": 5}, 1},
+		"two invalid fields":       {"receptor_satellite:execute", map[string]interface{}{"command": 1, "timeout": 0}, 2},
+		"wrong type":               {"receptor_satellite:execute", []string{"ls"}, 1},
+		"directive without schema": {"receptor:ping", "anything goes", 0},
+	}
+
+	for name, test := range subTests {
+		t.Run(name, func(t *testing.T) {
+			err := registry.ValidatePayload(test.directive, test.payload)
+
+			if test.expectedViolations == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			violationErr, ok := err.(*DirectiveSchemaViolationError)
+			if !ok {
+				t.Fatalf("expected a DirectiveSchemaViolationError, got: %v", err)
+			}
+
+			if len(violationErr.Violations) != test.expectedViolations {
+				t.Fatalf("expected %d violations, got: %v", test.expectedViolations, violationErr.Violations)
+			}
+		})
+	}
+}
+
+func TestDirectiveSchemaRegistryValidateResponse(t *testing.T) {
+	registry := newTestDirectiveSchemaRegistry(t)
+
+	if err := registry.ValidateResponse("receptor_satellite:execute", map[string]interface{}{"status": "ok"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := registry.ValidateResponse("receptor_satellite:execute", "ok"); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestDirectiveSchemaRegistryNil(t *testing.T) {
+	var registry *DirectiveSchemaRegistry
+
+	if err := registry.ValidatePayload("receptor_satellite:execute", 42); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDirectiveSchemaRegistryRegisterErrors(t *testing.T) {
+	registry := newTestDirectiveSchemaRegistry(t)
+
+	subTests := map[string]DirectiveSchema{
+		"missing directive":   {Payload: json.RawMessage(`{"type": "object"}`)},
+		"duplicate directive": {Directive: "receptor_satellite:execute"},
+		"invalid schema":      {Directive: "receptor:other", Payload: json.RawMessage(`{"type": "fred"}`)},
+	}
+
+	for name, directiveSchema := range subTests {
+		t.Run(name, func(t *testing.T) {
+			if err := registry.Register(directiveSchema); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadDirectiveSchemas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "directive-schemas")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	schemaFile := `{"directive": "receptor_satellite:execute", "payload": ` + testPayloadSchema + `}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "satellite.json"), []byte(schemaFile), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	registry, err := LoadDirectiveSchemas(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := registry.ValidatePayload("receptor_satellite:execute", map[string]interface{}{}); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := LoadDirectiveSchemas(dir); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
@@ -12,6 +12,8 @@ type DisconnectHandler struct {
 	AccountNumber string
 	NodeID        string
 	ConnectionMgr ConnectionRegistrar
+	Receptor      *ReceptorService
+	JobRegistry   JobRegistry
 	Logger        *logrus.Entry
 }
 
@@ -20,5 +22,13 @@ func (dh DisconnectHandler) HandleMessage(ctx context.Context, m protocol.Messag
 	dh.Logger.Debugf("DisconnectHandler - account (%s) / node id (%s) unregistered from connection manager",
 		dh.AccountNumber,
 		dh.NodeID)
+
+	dh.Receptor.FailInFlightJobs()
+
+	// The transport's context has been cancelled at this point
+	err := dh.JobRegistry.MarkConnectionLost(context.Background(), dh.AccountNumber, dh.NodeID, dh.Receptor.ConnectionID)
+	if err != nil {
+		dh.Logger.WithFields(logrus.Fields{"error": err}).Warn("Unable to mark in-flight jobs as lost")
+	}
 	return
 }
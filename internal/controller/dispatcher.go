@@ -3,84 +3,287 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"strings"
+	"time"
 
-	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/queue"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
 
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
 )
 
-type MessageDispatcherFactory struct {
-	readerConfig *queue.ConsumerConfig
-}
+// The outcomes of dispatching a message from the jobs topic
+const (
+	jobDispatchDelivered = "delivered"
+	jobDispatchForwarded = "forwarded"
+	jobDispatchQueued    = "queued"
+	jobDispatchInvalid   = "invalid"
+	jobDispatchFailed    = "failed"
+)
 
-func NewMessageDispatcherFactory(cfg *queue.ConsumerConfig) *MessageDispatcherFactory {
-	return &MessageDispatcherFactory{
-		readerConfig: cfg,
+func parseJobMessage(m kafka.Message) (*JobMessage, error) {
+	key := strings.SplitN(string(m.Key), ":", 2)
+	if len(key) != 2 || key[0] == "" || key[1] == "" {
+		return nil, fmt.Errorf("invalid message key (%s).  The key must be account:node_id", m.Key)
 	}
-}
 
-func (fact *MessageDispatcherFactory) NewDispatcher(account, nodeID string) (*MessageDispatcher, error) {
-	log.Println("Creating a new work dispatcher")
-	r, err := queue.StartConsumer(fact.readerConfig)
-	if err != nil {
+	var job JobMessage
+	if err := json.Unmarshal(m.Value, &job); err != nil {
 		return nil, err
 	}
 
-	return &MessageDispatcher{
-		account: account,
-		nodeID:  nodeID,
-		reader:  r,
-	}, nil
+	if _, err := uuid.Parse(job.MessageID); err != nil {
+		return nil, fmt.Errorf("invalid message_id: %w", err)
+	}
+
+	if job.Directive == "" {
+		return nil, errors.New("directive missing")
+	}
+
+	// Nobody is waiting on the jobs from the topic so they are sent on the
+	// bulk lane unless the submitter chose a lane
+	if job.Lane == "" {
+		job.Lane = LaneBulk
+	} else if _, err := ParseLane(string(job.Lane)); err != nil {
+		return nil, err
+	} else if job.Lane == LaneControl {
+		return nil, errors.New("jobs cannot be sent on the control lane")
+	}
+
+	job.Account = key[0]
+	job.Recipient = key[1]
+
+	return &job, nil
+}
+
+type kafkaMessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
 }
 
+// MessageDispatcher consumes the jobs topic.  A single dispatcher runs on
+// each gateway pod.  Each job is delivered to the local connection that can
+// reach the recipient.  A job for a recipient that is not reachable from
+// this pod is forwarded to the gateway pod that can reach it.  If no pod can
+// reach the recipient, the job is queued until the recipient connects.
+//
+// The offset of a message is only committed once the job has been passed to
+// a websocket, forwarded, queued or marked as failed.  A job that cannot be
+// dispatched is retried up to the configured number of attempts.  Jobs are
+// only queued for recipients that are not connected, unless the job could not
+// be sent through an existing connection (e.g. the connection is overloaded)
+// in any of the attempts.  A job that cannot be queued either is marked as
+// failed.
 type MessageDispatcher struct {
-	account string
-	nodeID  string
-	reader  *kafka.Reader
+	reader            kafkaMessageReader
+	localConnections  *MeshConnectionLocator
+	remoteConnections *MeshConnectionLocator
+	jobRegistry       JobRegistry
+	jobQueue          JobQueue
+	config            *config.Config
 }
 
-func (md *MessageDispatcher) GetKey() string {
-	return fmt.Sprintf("%s:%s", md.account, md.nodeID)
+// NewMessageDispatcher creates a MessageDispatcher.  The remote connection
+// locator is optional.  Jobs are not forwarded to other gateway pods if it
+// is nil.
+func NewMessageDispatcher(r kafkaMessageReader, local ConnectionLocator, remote ConnectionLocator, jr JobRegistry, jq JobQueue, cfg *config.Config) *MessageDispatcher {
+	var remoteConnections *MeshConnectionLocator
+	if remote != nil {
+		remoteConnections = NewMeshConnectionLocator(remote, cfg)
+	}
+
+	return &MessageDispatcher{
+		reader:            r,
+		localConnections:  NewMeshConnectionLocator(local, cfg),
+		remoteConnections: remoteConnections,
+		jobRegistry:       jr,
+		jobQueue:          jq,
+		config:            cfg,
+	}
 }
 
-func (md *MessageDispatcher) StartDispatchingMessages(ctx context.Context, c chan<- Message) {
+func (md *MessageDispatcher) StartDispatchingMessages(ctx context.Context) {
 	defer func() {
 		err := md.reader.Close()
 		if err != nil {
-			log.Println("Kafka job reader - error closing consumer: ", err)
+			logger.Log.WithFields(logrus.Fields{"error": err}).Warn("Kafka job reader - error closing consumer")
 			return
 		}
-		log.Println("Kafka job reader leaving...")
+		logger.Log.Info("Kafka job reader leaving...")
 	}()
 
 	for {
-		log.Printf("Kafka job reader - waiting on a message from kafka...")
-		m, err := md.reader.ReadMessage(ctx)
+		m, err := md.reader.FetchMessage(ctx)
 		if err != nil {
-			// FIXME:  do we need to call cancel here??
-			log.Println("Kafka job reader - error reading message: ", err)
-			break
+			logger.Log.WithFields(logrus.Fields{"error": err}).Info("Kafka job reader - error reading message")
+			return
+		}
+
+		log := logger.Log.WithFields(logrus.Fields{"topic": m.Topic,
+			"partition": m.Partition,
+			"offset":    m.Offset,
+			"key":       string(m.Key)})
+
+		log.Debug("Kafka job reader - received message")
+
+		if md.dispatchMessage(ctx, log, m) == false {
+			return
+		}
+
+		if err = md.reader.CommitMessages(ctx, m); err != nil {
+			log.WithFields(logrus.Fields{"error": err}).Warn("Kafka job reader - error committing message")
+		}
+	}
+}
+
+// dispatchMessage retries the job until it has been dispatched or the
+// attempts run out.  false is returned if the context was cancelled before
+// the job was dispatched.
+func (md *MessageDispatcher) dispatchMessage(ctx context.Context, log *logrus.Entry, m kafka.Message) bool {
+	job, err := parseJobMessage(m)
+	if err != nil {
+		// There is no point in retrying a message that cannot be parsed
+		log.WithFields(logrus.Fields{"error": err}).Error("Kafka job reader - discarding invalid message")
+		metrics.jobDispatchCounter.With(prometheus.Labels{"result": jobDispatchInvalid}).Inc()
+		return true
+	}
+
+	log = log.WithFields(logrus.Fields{"account": job.Account,
+		"recipient":  job.Recipient,
+		"message_id": job.MessageID,
+		"directive":  job.Directive})
+
+	for attempt := 1; ; attempt++ {
+		result, err := md.dispatchJob(ctx, log, job)
+		if err != nil && attempt >= md.config.JobDispatcherMaxAttempts {
+			log.WithFields(logrus.Fields{"error": err, "attempts": attempt}).Warn("Kafka job reader - unable to dispatch job.  Giving up.")
+			result = md.abandonJob(ctx, log, job)
+			err = nil
+		}
+
+		if err == nil {
+			log.WithFields(logrus.Fields{"result": result}).Info("Kafka job reader - dispatched job")
+			metrics.jobDispatchCounter.With(prometheus.Labels{"result": result}).Inc()
+			return true
+		}
+
+		log.WithFields(logrus.Fields{"error": err}).Warn("Kafka job reader - unable to dispatch job.  Retrying.")
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(md.config.JobDispatcherRetryDelay):
 		}
+	}
+}
+
+func (md *MessageDispatcher) dispatchJob(ctx context.Context, log *logrus.Entry, job *JobMessage) (string, error) {
+	sent, err := md.sendJob(ctx, log, md.localConnections, job)
+	if err != nil {
+		return "", err
+	} else if sent {
+		return jobDispatchDelivered, nil
+	}
 
-		log.Printf("Kafka job reader - received message from %s-%d [%d]: %s: %s\n",
-			m.Topic,
-			m.Partition,
-			m.Offset,
-			string(m.Key),
-			string(m.Value))
-
-		if string(m.Key) == md.GetKey() {
-			// FIXME:
-			var w Message
-			if err := json.Unmarshal(m.Value, &w); err != nil {
-				log.Println("Unable to unmarshal message from kafka queue")
-				continue
-			}
-			c <- w
-		} else {
-			log.Println("Kafka job reader - received message but did not send. Account number not found.")
+	if md.remoteConnections != nil {
+		sent, err = md.sendJob(ctx, log, md.remoteConnections, job)
+		if err != nil {
+			return "", err
+		} else if sent {
+			return jobDispatchForwarded, nil
 		}
 	}
+
+	if err = md.queueJob(ctx, log, job); err != nil {
+		return "", err
+	}
+
+	return jobDispatchQueued, nil
+}
+
+// abandonJob is called once the attempts to dispatch the job have run out.
+// The job is queued so that it is delivered once the recipient reconnects.
+// If the job cannot be queued either, it is marked as failed.
+func (md *MessageDispatcher) abandonJob(ctx context.Context, log *logrus.Entry, job *JobMessage) string {
+	err := md.queueJob(ctx, log, job)
+	if err == nil {
+		return jobDispatchQueued
+	}
+
+	log.WithFields(logrus.Fields{"error": err}).Error("Unable to queue the job.  Marking the job as failed.")
+
+	now := time.Now().UTC()
+
+	err = md.jobRegistry.Register(ctx, Job{
+		MessageID: job.MessageID,
+		Account:   job.Account,
+		Recipient: job.Recipient,
+		NodeID:    job.Recipient,
+		Directive: job.Directive,
+		State:     JobStateFailed,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err}).Warn("Unable to register the failed job")
+	}
+
+	return jobDispatchFailed
+}
+
+// queueJob queues the job until the recipient connects
+func (md *MessageDispatcher) queueJob(ctx context.Context, log *logrus.Entry, job *JobMessage) error {
+	ttl := md.config.JobQueueDefaultTTL
+	if job.TTL > 0 {
+		ttl = time.Duration(job.TTL) * time.Second
+	}
+
+	now := time.Now().UTC()
+
+	queuedJob := QueuedJob{
+		MessageID: job.MessageID,
+		Account:   job.Account,
+		Recipient: job.Recipient,
+		Payload:   job.Payload,
+		Directive: job.Directive,
+		Lane:      job.Lane,
+		QueuedAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	err := md.jobRegistry.Register(ctx, queuedJob.JobRecord())
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err}).Warn("Unable to register the queued job")
+	}
+
+	return md.jobQueue.Enqueue(ctx, queuedJob)
+}
+
+// sendJob sends the job through a connection that can reach the recipient.
+// false is returned if there is no such connection.  An error is returned if
+// the job could not be sent through the connection.
+func (md *MessageDispatcher) sendJob(ctx context.Context, log *logrus.Entry, ml *MeshConnectionLocator, job *JobMessage) (bool, error) {
+	client, route := ml.LocateConnectionToNode(ctx, job.Account, job.Recipient)
+	if client == nil {
+		return false, nil
+	}
+
+	messageID, err := uuid.Parse(job.MessageID)
+	if err != nil {
+		return false, fmt.Errorf("invalid message_id: %w", err)
+	}
+
+	err = client.SendMessageWithID(WithLane(ctx, job.Lane), messageID, job.Account, job.Recipient, route, job.Payload, job.Directive)
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err, "route_list": route}).Info("Unable to send the job")
+		return false, err
+	}
+
+	return true, nil
 }
@@ -0,0 +1,347 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+
+	"github.com/google/uuid"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// channelKafkaReader hands out the messages from a channel and records the
+// messages that are committed
+type channelKafkaReader struct {
+	messages  chan kafka.Message
+	committed chan kafka.Message
+}
+
+func newChannelKafkaReader() *channelKafkaReader {
+	return &channelKafkaReader{
+		messages:  make(chan kafka.Message, 10),
+		committed: make(chan kafka.Message, 10),
+	}
+}
+
+func (r *channelKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case m := <-r.messages:
+		return m, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *channelKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	for _, m := range msgs {
+		r.committed <- m
+	}
+	return nil
+}
+
+func (r *channelKafkaReader) Close() error {
+	return nil
+}
+
+// recordingReceptor records the ids of the jobs that were sent through it.
+// The first sends fail with sendErr until failures runs out.
+type recordingReceptor struct {
+	MockReceptor
+	sendErr  error
+	failures int
+	sent     []uuid.UUID
+	lanes    []Lane
+	sync.Mutex
+}
+
+func (rr *recordingReceptor) SendMessageWithID(ctx context.Context, messageID uuid.UUID, account string, recipient string, route []string, payload interface{}, directive string) error {
+	rr.Lock()
+	defer rr.Unlock()
+
+	if rr.failures > 0 {
+		rr.failures--
+		return rr.sendErr
+	}
+
+	rr.sent = append(rr.sent, messageID)
+	rr.lanes = append(rr.lanes, LaneFromContext(ctx))
+	return nil
+}
+
+func (rr *recordingReceptor) sentJobs() []uuid.UUID {
+	rr.Lock()
+	defer rr.Unlock()
+	return append([]uuid.UUID{}, rr.sent...)
+}
+
+func (rr *recordingReceptor) sentLanes() []Lane {
+	rr.Lock()
+	defer rr.Unlock()
+	return append([]Lane{}, rr.lanes...)
+}
+
+func newTestJobMessage(key string, messageID string) kafka.Message {
+	return kafka.Message{
+		Key:   []byte(key),
+		Value: []byte(`{"message_id": "` + messageID + `", "payload": "hello", "directive": "worker:action"}`),
+	}
+}
+
+func startTestDispatcher(t *testing.T, local ConnectionLocator, remote ConnectionLocator, jq JobQueue) (*channelKafkaReader, JobRegistry) {
+	cfg := config.GetConfig()
+	cfg.JobDispatcherRetryDelay = 10 * time.Millisecond
+
+	return startTestDispatcherWithConfig(t, cfg, local, remote, jq)
+}
+
+func startTestDispatcherWithConfig(t *testing.T, cfg *config.Config, local ConnectionLocator, remote ConnectionLocator, jq JobQueue) (*channelKafkaReader, JobRegistry) {
+	reader := newChannelKafkaReader()
+	jobRegistry := NewInMemoryJobRegistry(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	md := NewMessageDispatcher(reader, local, remote, jobRegistry, jq, cfg)
+	go md.StartDispatchingMessages(ctx)
+
+	return reader, jobRegistry
+}
+
+func waitForCommit(t *testing.T, reader *channelKafkaReader, expected kafka.Message) {
+	select {
+	case m := <-reader.committed:
+		if string(m.Key) != string(expected.Key) || string(m.Value) != string(expected.Value) {
+			t.Fatalf("expected message %s to be committed, got %s", expected.Value, m.Value)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("message %s was not committed", expected.Value)
+	}
+}
+
+func TestDispatchJobToLocalConnection(t *testing.T) {
+	receptor := &recordingReceptor{}
+	local := NewLocalConnectionManager()
+	local.Register(context.TODO(), "0000001", "node-a", receptor)
+
+	reader, _ := startTestDispatcher(t, local, nil, NewInMemoryJobQueue())
+
+	messageID := uuid.New()
+	m := newTestJobMessage("0000001:node-a", messageID.String())
+	reader.messages <- m
+
+	waitForCommit(t, reader, m)
+
+	sent := receptor.sentJobs()
+	if len(sent) != 1 || sent[0] != messageID {
+		t.Fatalf("expected job %s to be sent, sent jobs %v", messageID, sent)
+	}
+}
+
+func TestDispatchJobLanes(t *testing.T) {
+	receptor := &recordingReceptor{}
+	local := NewLocalConnectionManager()
+	local.Register(context.TODO(), "0000001", "node-a", receptor)
+
+	reader, _ := startTestDispatcher(t, local, nil, NewInMemoryJobQueue())
+
+	bulkJob := newTestJobMessage("0000001:node-a", uuid.New().String())
+	interactiveJob := kafka.Message{
+		Key:   []byte("0000001:node-a"),
+		Value: []byte(`{"message_id": "` + uuid.New().String() + `", "payload": "hello", "directive": "worker:action", "lane": "interactive"}`),
+	}
+
+	for _, m := range []kafka.Message{bulkJob, interactiveJob} {
+		reader.messages <- m
+		waitForCommit(t, reader, m)
+	}
+
+	lanes := receptor.sentLanes()
+	if len(lanes) != 2 || lanes[0] != LaneBulk || lanes[1] != LaneInteractive {
+		t.Fatalf("expected the jobs to be sent on the bulk and interactive lanes, got %v", lanes)
+	}
+}
+
+func TestDispatchJobToRemoteConnection(t *testing.T) {
+	receptor := &recordingReceptor{}
+	remote := NewLocalConnectionManager()
+	remote.Register(context.TODO(), "0000001", "node-a", receptor)
+
+	reader, _ := startTestDispatcher(t, NewLocalConnectionManager(), remote, NewInMemoryJobQueue())
+
+	messageID := uuid.New()
+	m := newTestJobMessage("0000001:node-a", messageID.String())
+	reader.messages <- m
+
+	waitForCommit(t, reader, m)
+
+	sent := receptor.sentJobs()
+	if len(sent) != 1 || sent[0] != messageID {
+		t.Fatalf("expected job %s to be forwarded, forwarded jobs %v", messageID, sent)
+	}
+}
+
+func TestDispatchJobForOfflineNodeIsQueued(t *testing.T) {
+	jobQueue := NewInMemoryJobQueue()
+
+	reader, jobRegistry := startTestDispatcher(t, NewLocalConnectionManager(), nil, jobQueue)
+
+	messageID := uuid.New().String()
+	m := newTestJobMessage("0000001:node-a", messageID)
+	reader.messages <- m
+
+	waitForCommit(t, reader, m)
+
+	queuedJob, _ := jobQueue.Dequeue(context.TODO(), "0000001", "node-a")
+	if queuedJob == nil || queuedJob.MessageID != messageID {
+		t.Fatalf("expected job %s to be queued, got %v", messageID, queuedJob)
+	}
+
+	verifyJobState(t, jobRegistry, messageID, JobStateQueued)
+}
+
+func TestDispatchJobFailedSendIsRetried(t *testing.T) {
+	receptor := &recordingReceptor{sendErr: &ConnectionOverloadedError{Lane: LaneBulk}, failures: 2}
+	local := NewLocalConnectionManager()
+	local.Register(context.TODO(), "0000001", "node-a", receptor)
+
+	jobQueue := NewInMemoryJobQueue()
+
+	reader, _ := startTestDispatcher(t, local, nil, jobQueue)
+
+	messageID := uuid.New()
+	m := newTestJobMessage("0000001:node-a", messageID.String())
+	reader.messages <- m
+
+	waitForCommit(t, reader, m)
+
+	sent := receptor.sentJobs()
+	if len(sent) != 1 || sent[0] != messageID {
+		t.Fatalf("expected job %s to be sent once the connection recovered, sent jobs %v", messageID, sent)
+	}
+
+	if queuedJob, _ := jobQueue.Dequeue(context.TODO(), "0000001", "node-a"); queuedJob != nil {
+		t.Fatalf("expected the job not to be queued for a connected node, got %v", queuedJob)
+	}
+}
+
+func TestDispatchJobIsQueuedOnceAttemptsRunOut(t *testing.T) {
+	receptor := &recordingReceptor{sendErr: &ConnectionOverloadedError{Lane: LaneBulk}, failures: 100}
+	local := NewLocalConnectionManager()
+	local.Register(context.TODO(), "0000001", "node-a", receptor)
+
+	jobQueue := NewInMemoryJobQueue()
+
+	cfg := config.GetConfig()
+	cfg.JobDispatcherRetryDelay = time.Millisecond
+	cfg.JobDispatcherMaxAttempts = 3
+
+	reader, jobRegistry := startTestDispatcherWithConfig(t, cfg, local, nil, jobQueue)
+
+	messageID := uuid.New().String()
+	m := newTestJobMessage("0000001:node-a", messageID)
+	reader.messages <- m
+
+	waitForCommit(t, reader, m)
+
+	receptor.Lock()
+	failures := receptor.failures
+	receptor.Unlock()
+
+	if failures != 97 {
+		t.Fatalf("expected 3 attempts to send the job, got %d", 100-failures)
+	}
+
+	queuedJob, _ := jobQueue.Dequeue(context.TODO(), "0000001", "node-a")
+	if queuedJob == nil || queuedJob.MessageID != messageID {
+		t.Fatalf("expected job %s to be queued, got %v", messageID, queuedJob)
+	}
+
+	verifyJobState(t, jobRegistry, messageID, JobStateQueued)
+}
+
+func TestDispatchJobFailsOnceAttemptsRunOut(t *testing.T) {
+	jobQueue := &failingJobQueue{
+		InMemoryJobQueue: NewInMemoryJobQueue(),
+		accept:           make(chan struct{}),
+	}
+
+	cfg := config.GetConfig()
+	cfg.JobDispatcherRetryDelay = time.Millisecond
+	cfg.JobDispatcherMaxAttempts = 3
+
+	reader, jobRegistry := startTestDispatcherWithConfig(t, cfg, NewLocalConnectionManager(), nil, jobQueue)
+
+	messageID := uuid.New().String()
+	m := newTestJobMessage("0000001:node-a", messageID)
+	reader.messages <- m
+
+	waitForCommit(t, reader, m)
+
+	verifyJobState(t, jobRegistry, messageID, JobStateFailed)
+}
+
+func TestDispatchInvalidMessagesAreSkipped(t *testing.T) {
+	receptor := &recordingReceptor{}
+	local := NewLocalConnectionManager()
+	local.Register(context.TODO(), "0000001", "node-a", receptor)
+
+	reader, _ := startTestDispatcher(t, local, nil, NewInMemoryJobQueue())
+
+	invalidMessages := []kafka.Message{
+		newTestJobMessage("0000001", uuid.New().String()),
+		newTestJobMessage("0000001:node-a", "not-a-uuid"),
+		{Key: []byte("0000001:node-a"), Value: []byte("{bad json")},
+		{Key: []byte("0000001:node-a"), Value: []byte(`{"message_id": "` + uuid.New().String() + `"}`)},
+		{Key: []byte("0000001:node-a"), Value: []byte(`{"message_id": "` + uuid.New().String() + `", "directive": "worker:action", "lane": "control"}`)},
+	}
+
+	for _, m := range invalidMessages {
+		reader.messages <- m
+		waitForCommit(t, reader, m)
+	}
+
+	if sent := receptor.sentJobs(); len(sent) != 0 {
+		t.Fatalf("expected no jobs to be sent, sent jobs %v", sent)
+	}
+}
+
+// failingJobQueue fails until it is told to accept jobs
+type failingJobQueue struct {
+	*InMemoryJobQueue
+	accept chan struct{}
+}
+
+func (q *failingJobQueue) Enqueue(ctx context.Context, job QueuedJob) error {
+	select {
+	case <-q.accept:
+		return q.InMemoryJobQueue.Enqueue(ctx, job)
+	default:
+		return errors.New("redis unavailable")
+	}
+}
+
+func TestDispatchCommitsOnlyAfterJobIsDispatched(t *testing.T) {
+	jobQueue := &failingJobQueue{
+		InMemoryJobQueue: NewInMemoryJobQueue(),
+		accept:           make(chan struct{}),
+	}
+
+	reader, _ := startTestDispatcher(t, NewLocalConnectionManager(), nil, jobQueue)
+
+	m := newTestJobMessage("0000001:node-a", uuid.New().String())
+	reader.messages <- m
+
+	select {
+	case <-reader.committed:
+		t.Fatal("message was committed before the job was dispatched")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(jobQueue.accept)
+
+	waitForCommit(t, reader, m)
+}
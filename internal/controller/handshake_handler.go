@@ -3,6 +3,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/protocol"
@@ -10,15 +11,67 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// compressionMetadataKey is the key in the metadata of the handshake under
+// which the peer lists the compressions that it supports and under which the
+// controller returns the compression that it picked
+const compressionMetadataKey = "compression"
+
+// negotiateCompression picks the first of the preferred compressions (a comma
+// separated list) that the peer listed in the metadata of its handshake.
+// Payloads are not compressed for peers that do not list any compressions.
+func negotiateCompression(metadata interface{}, preferred string) protocol.Compression {
+	metadataMap, ok := metadata.(map[string]interface{})
+	if !ok {
+		return protocol.CompressionNone
+	}
+
+	supported, ok := metadataMap[compressionMetadataKey].([]interface{})
+	if !ok {
+		return protocol.CompressionNone
+	}
+
+	for _, p := range strings.Split(preferred, ",") {
+		compression, err := protocol.ParseCompression(strings.TrimSpace(p))
+		if err != nil || compression == protocol.CompressionNone {
+			continue
+		}
+
+		for _, s := range supported {
+			if s == string(compression) {
+				return compression
+			}
+		}
+	}
+
+	return protocol.CompressionNone
+}
+
+// chunkingMetadataKey is the key in the metadata of the handshake under which
+// the peer reports that it can reassemble chunked payloads.  The controller
+// returns it to confirm that payloads will be chunked.
+const chunkingMetadataKey = "chunking"
+
+// negotiateChunking reports whether the peer said in the metadata of its
+// handshake that it can reassemble chunked payloads.  Payloads are not
+// chunked for peers that do not say so.
+func negotiateChunking(metadata interface{}) bool {
+	metadataMap, ok := metadata.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	chunking, ok := metadataMap[chunkingMetadataKey].(bool)
+	return ok && chunking
+}
+
 type HandshakeHandler struct {
-	AccountNumber            string
-	NodeID                   string
-	Transport                *Transport
-	ReceptorServiceFactory   *ReceptorServiceFactory
-	ResponseReactor          ResponseReactor
-	ConnectionMgr            ConnectionRegistrar
-	MessageDispatcherFactory *MessageDispatcherFactory
-	Logger                   *logrus.Entry
+	AccountNumber          string
+	NodeID                 string
+	Transport              *Transport
+	ReceptorServiceFactory *ReceptorServiceFactory
+	ResponseReactor        ResponseReactor
+	ConnectionMgr          ConnectionRegistrar
+	Logger                 *logrus.Entry
 }
 
 func (hh HandshakeHandler) HandleMessage(ctx context.Context, m protocol.Message) {
@@ -44,6 +97,26 @@ func (hh HandshakeHandler) HandleMessage(ctx context.Context, m protocol.Message
 
 	responseHiMessage := protocol.HiMessage{Command: "HI", ID: hh.NodeID}
 
+	responseMetadata := make(map[string]interface{})
+
+	compression := negotiateCompression(hiMessage.Metadata, hh.ReceptorServiceFactory.config.PayloadCompression)
+	if compression != protocol.CompressionNone {
+		hh.Logger = hh.Logger.WithFields(logrus.Fields{"compression": compression})
+		responseMetadata[compressionMetadataKey] = compression
+	}
+
+	chunking := negotiateChunking(hiMessage.Metadata)
+	if chunking {
+		hh.Logger = hh.Logger.WithFields(logrus.Fields{"chunking": chunking})
+		responseMetadata[chunkingMetadataKey] = true
+	}
+
+	if len(responseMetadata) > 0 {
+		responseHiMessage.Metadata = responseMetadata
+	}
+
+	hh.Transport.SetCompression(compression)
+
 	ctx, cancel := context.WithTimeout(ctx, time.Second*10) // FIXME:  add a configurable timeout
 	defer cancel()
 
@@ -51,7 +124,7 @@ func (hh HandshakeHandler) HandleMessage(ctx context.Context, m protocol.Message
 	case <-ctx.Done():
 		hh.Logger.Info("Request cancelled during handshake. Error: ", ctx.Err())
 		return
-	case hh.Transport.ControlChannel <- ReceptorMessage{
+	case hh.Transport.Lanes[LaneControl] <- ReceptorMessage{
 		AccountNumber: hh.AccountNumber,
 		Message:       &responseHiMessage}:
 		break
@@ -65,6 +138,8 @@ func (hh HandshakeHandler) HandleMessage(ctx context.Context, m protocol.Message
 		hh.NodeID)
 
 	receptor.RegisterConnection(hiMessage.ID, hiMessage.Metadata, hh.Transport)
+	receptor.Compression = compression
+	receptor.Chunking = chunking
 
 	err := hh.ConnectionMgr.Register(hh.Transport.Ctx, hh.AccountNumber, hiMessage.ID, receptor)
 	if err != nil {
@@ -83,6 +158,8 @@ func (hh HandshakeHandler) HandleMessage(ctx context.Context, m protocol.Message
 		AccountNumber: hh.AccountNumber,
 		NodeID:        hiMessage.ID,
 		ConnectionMgr: hh.ConnectionMgr,
+		Receptor:      receptor,
+		JobRegistry:   hh.ReceptorServiceFactory.jobRegistry,
 		Logger:        hh.Logger,
 	}
 	hh.ResponseReactor.RegisterDisconnectHandler(disconnectHandler)
@@ -101,12 +178,9 @@ func (hh HandshakeHandler) HandleMessage(ctx context.Context, m protocol.Message
 	}
 	hh.ResponseReactor.RegisterHandler(protocol.PayloadMessageType, payloadHandler)
 
-	/**** FIXME: The MessageDispatcher needs to be disabled until we split the service apart.
-
-	// Start the message dispatcher
-	messageDispatcher := hh.MessageDispatcherFactory.NewDispatcher(hh.AccountNumber, hiMessage.ID)
-	messageDispatcher.StartDispatchingMessages(ctx, hh.Send)
-	*/
+	// Deliver the jobs that were queued while the node was offline.  This
+	// must not block the response reactor.
+	go receptor.DeliverQueuedJobs(hh.Transport.Ctx)
 
 	return
 }
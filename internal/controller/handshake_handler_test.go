@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/protocol"
+)
+
+func TestNegotiateCompression(t *testing.T) {
+	subTests := map[string]struct {
+		metadata  interface{}
+		preferred string
+		expected  protocol.Compression
+	}{
+		"no_metadata":          {nil, "zstd,gzip", protocol.CompressionNone},
+		"no_compression":       {map[string]interface{}{"version": "1.0"}, "zstd,gzip", protocol.CompressionNone},
+		"preferred":            {map[string]interface{}{"compression": []interface{}{"gzip", "zstd"}}, "zstd,gzip", protocol.CompressionZstd},
+		"only_gzip":            {map[string]interface{}{"compression": []interface{}{"gzip"}}, "zstd, gzip", protocol.CompressionGzip},
+		"unsupported":          {map[string]interface{}{"compression": []interface{}{"lz4"}}, "zstd,gzip", protocol.CompressionNone},
+		"compression_disabled": {map[string]interface{}{"compression": []interface{}{"zstd"}}, "", protocol.CompressionNone},
+	}
+
+	for name, test := range subTests {
+		t.Run(name, func(t *testing.T) {
+			compression := negotiateCompression(test.metadata, test.preferred)
+			if compression != test.expected {
+				t.Fatalf("Compression was incorrect, got: %s, want: %s", compression, test.expected)
+			}
+		})
+	}
+}
+
+func TestNegotiateChunking(t *testing.T) {
+	subTests := map[string]struct {
+		metadata interface{}
+		expected bool
+	}{
+		"no_metadata":  {nil, false},
+		"no_chunking":  {map[string]interface{}{"compression": []interface{}{"gzip"}}, false},
+		"chunking":     {map[string]interface{}{"chunking": true}, true},
+		"not_chunking": {map[string]interface{}{"chunking": false}, false},
+		"not_a_bool":   {map[string]interface{}{"chunking": "yes"}, false},
+	}
+
+	for name, test := range subTests {
+		t.Run(name, func(t *testing.T) {
+			chunking := negotiateChunking(test.metadata)
+			if chunking != test.expected {
+				t.Fatalf("Chunking was incorrect, got: %t, want: %t", chunking, test.expected)
+			}
+		})
+	}
+}
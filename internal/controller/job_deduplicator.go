@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+)
+
+// JobDeduplicator remembers the job that each idempotency key was assigned
+// to so that a retried submission does not run the job twice.  Keys are
+// scoped to an account and are remembered for the idempotency window.
+//
+// Reserve assigns the key to the job unless the key is already assigned.
+// The id of the job that the key is assigned to is returned along with true
+// if the key was assigned to the given job.  Release forgets the key if it is
+// still assigned to the given job so that a failed submission can be retried.
+type JobDeduplicator interface {
+	Reserve(ctx context.Context, account string, key string, messageID string) (string, bool, error)
+	Release(ctx context.Context, account string, key string, messageID string) error
+}
+
+func getIdempotencyKey(account, key string) string {
+	return "idempotency-key:" + account + ":" + key
+}
+
+type reservedKey struct {
+	messageID string
+}
+
+// InMemoryJobDeduplicator deduplicates jobs for a gateway running without
+// redis
+type InMemoryJobDeduplicator struct {
+	keys   map[string]*reservedKey
+	window time.Duration
+	sync.Mutex
+}
+
+func NewInMemoryJobDeduplicator(cfg *config.Config) *InMemoryJobDeduplicator {
+	return &InMemoryJobDeduplicator{
+		keys:   make(map[string]*reservedKey),
+		window: cfg.JobIdempotencyWindow,
+	}
+}
+
+func (d *InMemoryJobDeduplicator) Reserve(ctx context.Context, account string, key string, messageID string) (string, bool, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	idempotencyKey := getIdempotencyKey(account, key)
+
+	if existingKey, exists := d.keys[idempotencyKey]; exists {
+		return existingKey.messageID, false, nil
+	}
+
+	reservation := &reservedKey{messageID: messageID}
+	d.keys[idempotencyKey] = reservation
+
+	time.AfterFunc(d.window, func() { d.remove(idempotencyKey, reservation) })
+
+	return messageID, true, nil
+}
+
+func (d *InMemoryJobDeduplicator) Release(ctx context.Context, account string, key string, messageID string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	idempotencyKey := getIdempotencyKey(account, key)
+
+	if existingKey, exists := d.keys[idempotencyKey]; exists && existingKey.messageID == messageID {
+		delete(d.keys, idempotencyKey)
+	}
+
+	return nil
+}
+
+// remove forgets the key unless it has been reserved again since
+func (d *InMemoryJobDeduplicator) remove(idempotencyKey string, reservation *reservedKey) {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.keys[idempotencyKey] == reservation {
+		delete(d.keys, idempotencyKey)
+	}
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+
+	"github.com/alicebob/miniredis"
+)
+
+func testJobDeduplicators(t *testing.T, testFunc func(t *testing.T, deduplicator JobDeduplicator)) {
+	cfg := config.GetConfig()
+
+	t.Run("memory", func(t *testing.T) {
+		testFunc(t, NewInMemoryJobDeduplicator(cfg))
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		s, _ := miniredis.Run()
+		defer s.Close()
+
+		testFunc(t, NewRedisJobDeduplicator(newTestRedisClient(s.Addr()), cfg))
+	})
+}
+
+func verifyReservation(t *testing.T, deduplicator JobDeduplicator, account string, key string, messageID string, expectedMessageID string, expectedReserved bool) {
+	actualMessageID, reserved, err := deduplicator.Reserve(context.TODO(), account, key, messageID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if actualMessageID != expectedMessageID || reserved != expectedReserved {
+		t.Fatalf("expected (%s, %t), got (%s, %t)", expectedMessageID, expectedReserved, actualMessageID, reserved)
+	}
+}
+
+func TestJobDeduplicatorReturnsOriginalJob(t *testing.T) {
+	testJobDeduplicators(t, func(t *testing.T, deduplicator JobDeduplicator) {
+		verifyReservation(t, deduplicator, "0000001", "key-a", "job-1", "job-1", true)
+		verifyReservation(t, deduplicator, "0000001", "key-a", "job-2", "job-1", false)
+
+		// Keys are scoped to the account
+		verifyReservation(t, deduplicator, "0000002", "key-a", "job-3", "job-3", true)
+		verifyReservation(t, deduplicator, "0000001", "key-b", "job-4", "job-4", true)
+	})
+}
+
+func TestJobDeduplicatorRelease(t *testing.T) {
+	testJobDeduplicators(t, func(t *testing.T, deduplicator JobDeduplicator) {
+		verifyReservation(t, deduplicator, "0000001", "key-a", "job-1", "job-1", true)
+
+		// A key is only released by the job that it is assigned to
+		deduplicator.Release(context.TODO(), "0000001", "key-a", "job-2")
+		verifyReservation(t, deduplicator, "0000001", "key-a", "job-2", "job-1", false)
+
+		deduplicator.Release(context.TODO(), "0000001", "key-a", "job-1")
+		verifyReservation(t, deduplicator, "0000001", "key-a", "job-2", "job-2", true)
+	})
+}
+
+func TestInMemoryJobDeduplicatorWindow(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.JobIdempotencyWindow = 10 * time.Millisecond
+
+	deduplicator := NewInMemoryJobDeduplicator(cfg)
+
+	verifyReservation(t, deduplicator, "0000001", "key-a", "job-1", "job-1", true)
+
+	time.Sleep(50 * time.Millisecond)
+
+	verifyReservation(t, deduplicator, "0000001", "key-a", "job-2", "job-2", true)
+}
+
+func TestRedisJobDeduplicatorWindow(t *testing.T) {
+	s, _ := miniredis.Run()
+	defer s.Close()
+
+	cfg := config.GetConfig()
+	cfg.JobIdempotencyWindow = 60 * time.Second
+
+	deduplicator := NewRedisJobDeduplicator(newTestRedisClient(s.Addr()), cfg)
+
+	verifyReservation(t, deduplicator, "0000001", "key-a", "job-1", "job-1", true)
+
+	s.FastForward(61 * time.Second)
+
+	verifyReservation(t, deduplicator, "0000001", "key-a", "job-2", "job-2", true)
+}
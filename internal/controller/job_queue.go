@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// QueuedJob is a job that was submitted while its recipient was offline.  It
+// is delivered when the recipient connects, unless it has expired.
+type QueuedJob struct {
+	MessageID string      `json:"id"`
+	Account   string      `json:"account"`
+	Recipient string      `json:"recipient"`
+	Payload   interface{} `json:"payload"`
+	Directive string      `json:"directive"`
+	Lane      Lane        `json:"lane,omitempty"`
+	QueuedAt  time.Time   `json:"queued_at"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
+
+func (j *QueuedJob) Expired(now time.Time) bool {
+	return now.After(j.ExpiresAt)
+}
+
+// JobRecord returns the job registry record of the queued job
+func (j *QueuedJob) JobRecord() Job {
+	expiresAt := j.ExpiresAt
+
+	return Job{
+		MessageID: j.MessageID,
+		Account:   j.Account,
+		Recipient: j.Recipient,
+		NodeID:    j.Recipient,
+		Directive: j.Directive,
+		State:     JobStateQueued,
+		CreatedAt: j.QueuedAt,
+		UpdatedAt: j.QueuedAt,
+		ExpiresAt: &expiresAt,
+	}
+}
+
+// JobQueue holds the jobs for offline nodes in the order that they were
+// submitted.  Dequeue returns nil when there are no queued jobs for the node.
+// Requeue puts a job back at the front of the node's queue.
+type JobQueue interface {
+	Enqueue(ctx context.Context, job QueuedJob) error
+	Dequeue(ctx context.Context, account string, nodeID string) (*QueuedJob, error)
+	Requeue(ctx context.Context, job QueuedJob) error
+}
+
+// InMemoryJobQueue queues jobs for a gateway running without redis
+type InMemoryJobQueue struct {
+	queues map[string][]QueuedJob
+	sync.Mutex
+}
+
+func NewInMemoryJobQueue() *InMemoryJobQueue {
+	return &InMemoryJobQueue{
+		queues: make(map[string][]QueuedJob),
+	}
+}
+
+func (q *InMemoryJobQueue) Enqueue(ctx context.Context, job QueuedJob) error {
+	q.Lock()
+	defer q.Unlock()
+
+	queueKey := getConnectionKey(job.Account, job.Recipient)
+	q.queues[queueKey] = append(q.queues[queueKey], job)
+
+	return nil
+}
+
+func (q *InMemoryJobQueue) Dequeue(ctx context.Context, account string, nodeID string) (*QueuedJob, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	queueKey := getConnectionKey(account, nodeID)
+	queue := q.queues[queueKey]
+	if len(queue) == 0 {
+		return nil, nil
+	}
+
+	job := queue[0]
+
+	if len(queue) == 1 {
+		delete(q.queues, queueKey)
+	} else {
+		q.queues[queueKey] = queue[1:]
+	}
+
+	return &job, nil
+}
+
+func (q *InMemoryJobQueue) Requeue(ctx context.Context, job QueuedJob) error {
+	q.Lock()
+	defer q.Unlock()
+
+	queueKey := getConnectionKey(job.Account, job.Recipient)
+	q.queues[queueKey] = append([]QueuedJob{job}, q.queues[queueKey]...)
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+
+	"github.com/alicebob/miniredis"
+)
+
+func newTestQueuedJob(messageID string, ttl time.Duration) QueuedJob {
+	now := time.Now().UTC()
+	return QueuedJob{
+		MessageID: messageID,
+		Account:   "0000001",
+		Recipient: "node-a",
+		Payload:   "payload",
+		Directive: "worker:action",
+		QueuedAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+}
+
+func testJobQueues(t *testing.T, testFunc func(t *testing.T, queue JobQueue)) {
+	t.Run("memory", func(t *testing.T) {
+		testFunc(t, NewInMemoryJobQueue())
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		s, _ := miniredis.Run()
+		defer s.Close()
+
+		testFunc(t, NewRedisJobQueue(newTestRedisClient(s.Addr()), config.GetConfig()))
+	})
+}
+
+func verifyDequeuedJobs(t *testing.T, queue JobQueue, expectedMessageIDs []string) {
+	for _, expectedMessageID := range expectedMessageIDs {
+		job, err := queue.Dequeue(context.TODO(), "0000001", "node-a")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if job == nil || job.MessageID != expectedMessageID {
+			t.Fatalf("Dequeued job was incorrect, got: %v, want: %s", job, expectedMessageID)
+		}
+	}
+
+	job, err := queue.Dequeue(context.TODO(), "0000001", "node-a")
+	if err != nil || job != nil {
+		t.Fatalf("Expected the queue to be empty, got: %v, %v", job, err)
+	}
+}
+
+func TestJobQueueOrder(t *testing.T) {
+	testJobQueues(t, func(t *testing.T, queue JobQueue) {
+		queue.Enqueue(context.TODO(), newTestQueuedJob("job-1", time.Minute))
+		queue.Enqueue(context.TODO(), newTestQueuedJob("job-2", time.Minute))
+		queue.Enqueue(context.TODO(), newTestQueuedJob("job-3", time.Minute))
+
+		verifyDequeuedJobs(t, queue, []string{"job-1", "job-2", "job-3"})
+	})
+}
+
+func TestJobQueueRequeue(t *testing.T) {
+	testJobQueues(t, func(t *testing.T, queue JobQueue) {
+		queue.Enqueue(context.TODO(), newTestQueuedJob("job-1", time.Minute))
+		queue.Enqueue(context.TODO(), newTestQueuedJob("job-2", time.Minute))
+
+		job, _ := queue.Dequeue(context.TODO(), "0000001", "node-a")
+		queue.Requeue(context.TODO(), *job)
+
+		verifyDequeuedJobs(t, queue, []string{"job-1", "job-2"})
+	})
+}
+
+func TestQueuedJobExpires(t *testing.T) {
+	testJobRegistries(t, func(t *testing.T, registry JobRegistry) {
+		queuedJob := newTestQueuedJob("queued-job", time.Minute)
+		registry.Register(context.TODO(), queuedJob.JobRecord())
+
+		verifyJobState(t, registry, "queued-job", JobStateQueued)
+
+		expiredJob := newTestQueuedJob("expired-job", -time.Minute)
+		registry.Register(context.TODO(), expiredJob.JobRecord())
+
+		verifyJobState(t, registry, "expired-job", JobStateTimedOut)
+	})
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+)
+
+// The scopes of the job submission rate limits
+const (
+	RateLimitAccount = "account"
+	RateLimitNode    = "node"
+	RateLimitClient  = "client"
+)
+
+// RateLimit is a token bucket that holds up to Burst tokens and is refilled
+// at Rate tokens per second.  Each job submission takes a token.
+type RateLimit struct {
+	Scope string
+	Key   string
+	Rate  float64
+	Burst int
+}
+
+// JobRateLimiter limits the rate at which jobs are submitted.  Take removes a
+// token from each of the buckets if all of them have a token.  Otherwise, no
+// tokens are removed and false is returned along with the scope of an empty
+// bucket and the time until it has a token again.
+type JobRateLimiter interface {
+	Take(ctx context.Context, limits []RateLimit) (bool, string, time.Duration, error)
+}
+
+// JobRateLimits returns the buckets that a job submission takes a token
+// from.  A limit with a rate of zero is disabled.  The client limit is only
+// applied to the service to service requests.
+func JobRateLimits(cfg *config.Config, account string, recipient string, clientID string) []RateLimit {
+	var limits []RateLimit
+
+	add := func(scope string, key string, rate float64, burst int) {
+		if rate <= 0 {
+			return
+		}
+
+		if burst < 1 {
+			burst = 1
+		}
+
+		limits = append(limits, RateLimit{Scope: scope, Key: "rate-limit:" + scope + ":" + key, Rate: rate, Burst: burst})
+	}
+
+	add(RateLimitAccount, account, cfg.JobAccountRateLimit, cfg.JobAccountRateLimitBurst)
+	add(RateLimitNode, account+":"+recipient, cfg.JobNodeRateLimit, cfg.JobNodeRateLimitBurst)
+	if clientID != "" {
+		add(RateLimitClient, clientID, cfg.JobClientRateLimit, cfg.JobClientRateLimitBurst)
+	}
+
+	return limits
+}
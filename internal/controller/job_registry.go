@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+)
+
+const (
+	JobStateQueued       = "queued"
+	JobStateSent         = "sent"
+	JobStateAcknowledged = "acknowledged"
+	JobStateCompleted    = "completed"
+	JobStateFailed       = "failed"
+	JobStateTimedOut     = "timed_out"
+	JobStateLost         = "lost_on_disconnect"
+	JobStateCancelled    = "cancelled"
+)
+
+var ErrJobNotFound = errors.New("Job not found")
+
+// ErrJobFinished is returned when a job that has reached a terminal state is
+// registered again
+var ErrJobFinished = errors.New("Job already finished")
+
+// Job records the state of a message that was sent to a receptor node.
+// NodeID is the directly connected node that the job was sent through and
+// ConnectionID identifies the connection to that node.  ExpiresAt is only set
+// while the job is queued for an offline node.
+type Job struct {
+	MessageID string     `json:"id"`
+	Account   string     `json:"account"`
+	Recipient string     `json:"recipient"`
+	NodeID    string     `json:"node_id"`
+	Directive string     `json:"directive"`
+	State     string     `json:"state"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	ConnectionID string `json:"-"`
+}
+
+func isTerminalJobState(state string) bool {
+	switch state {
+	case JobStateCompleted, JobStateFailed, JobStateTimedOut, JobStateLost, JobStateCancelled:
+		return true
+	}
+	return false
+}
+
+// Finished returns true if the job has reached a terminal state
+func (j *Job) Finished() bool {
+	return isTerminalJobState(j.State)
+}
+
+// applyTransition moves the job into the new state.  Jobs in a terminal state
+// are never moved.  false is returned if the job was not modified.
+func (j *Job) applyTransition(state string, now time.Time) bool {
+	if isTerminalJobState(j.State) || j.State == state {
+		return false
+	}
+
+	j.State = state
+	j.UpdatedAt = now
+	return true
+}
+
+// applyTimeout moves a job that has not reached a terminal state within the
+// job timeout into the timed out state.  A queued job is not subject to the
+// job timeout.  It times out if it has not been delivered before it expires,
+// including when the job queue dropped it.
+func (j *Job) applyTimeout(timeout time.Duration, now time.Time) {
+	if j.State == JobStateQueued {
+		if j.ExpiresAt != nil && now.After(*j.ExpiresAt) {
+			j.applyTransition(JobStateTimedOut, *j.ExpiresAt)
+		}
+		return
+	}
+
+	if now.Sub(j.CreatedAt) > timeout {
+		j.applyTransition(JobStateTimedOut, j.CreatedAt.Add(timeout))
+	}
+}
+
+// sentOnConnection returns true if the job is waiting for its responses on
+// a connection.  A queued job has not been sent through a connection yet.
+func (j *Job) sentOnConnection() bool {
+	return j.State != JobStateQueued && isTerminalJobState(j.State) == false
+}
+
+// retention returns how long the registry keeps the job.  A queued job is
+// kept for the ttl after it expires so that it can be reported as timed out.
+func (j *Job) retention(ttl time.Duration, now time.Time) time.Duration {
+	if j.State == JobStateQueued && j.ExpiresAt != nil && j.ExpiresAt.After(now) {
+		return j.ExpiresAt.Sub(now) + ttl
+	}
+	return ttl
+}
+
+// JobStateForResponse returns the state that a job moves into when the
+// response is received
+func JobStateForResponse(response ResponseMessage) string {
+	switch {
+	case response.Code != 0:
+		return JobStateFailed
+	case response.MessageType == ResponseMessageTypeEOF:
+		return JobStateCompleted
+	default:
+		return JobStateAcknowledged
+	}
+}
+
+// JobRegistry records the state of the jobs.  Register returns ErrJobFinished
+// instead of replacing a job that has reached a terminal state.
+// MarkConnectionLost moves the jobs that are waiting for their responses on
+// the connection into the lost state.
+type JobRegistry interface {
+	Register(ctx context.Context, job Job) error
+	UpdateState(ctx context.Context, messageID string, state string) error
+	Get(ctx context.Context, messageID string) (*Job, error)
+	MarkConnectionLost(ctx context.Context, account string, nodeID string, connectionID string) error
+}
+
+// getJobConnectionKey identifies the connection that a job was sent through
+func getJobConnectionKey(account, nodeID, connectionID string) string {
+	return account + ":" + nodeID + ":" + connectionID
+}
+
+// InMemoryJobRegistry tracks jobs for a gateway running without redis.  Jobs
+// are forgotten once the registry's entry ttl has passed.
+type InMemoryJobRegistry struct {
+	jobs        map[string]*Job
+	connections map[string]map[string]struct{}
+	ttl         time.Duration
+	jobTimeout  time.Duration
+	sync.Mutex
+}
+
+func NewInMemoryJobRegistry(cfg *config.Config) *InMemoryJobRegistry {
+	return &InMemoryJobRegistry{
+		jobs:        make(map[string]*Job),
+		connections: make(map[string]map[string]struct{}),
+		ttl:         cfg.JobRegistryTTL,
+		jobTimeout:  cfg.JobRegistryJobTimeout,
+	}
+}
+
+func (r *InMemoryJobRegistry) Register(ctx context.Context, job Job) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if existingJob, exists := r.jobs[job.MessageID]; exists {
+		if existingJob.Finished() {
+			return ErrJobFinished
+		}
+		r.removeFromConnection(existingJob)
+	}
+
+	registeredJob := &job
+	r.jobs[job.MessageID] = registeredJob
+
+	if job.sentOnConnection() {
+		connectionKey := getJobConnectionKey(job.Account, job.NodeID, job.ConnectionID)
+		if _, exists := r.connections[connectionKey]; !exists {
+			r.connections[connectionKey] = make(map[string]struct{})
+		}
+		r.connections[connectionKey][job.MessageID] = struct{}{}
+	}
+
+	time.AfterFunc(job.retention(r.ttl, time.Now().UTC()), func() { r.remove(registeredJob) })
+
+	return nil
+}
+
+// remove forgets the job unless it has been registered again since
+func (r *InMemoryJobRegistry) remove(job *Job) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.jobs[job.MessageID] != job {
+		return
+	}
+
+	delete(r.jobs, job.MessageID)
+	r.removeFromConnection(job)
+}
+
+func (r *InMemoryJobRegistry) removeFromConnection(job *Job) {
+	connectionKey := getJobConnectionKey(job.Account, job.NodeID, job.ConnectionID)
+	delete(r.connections[connectionKey], job.MessageID)
+	if len(r.connections[connectionKey]) == 0 {
+		delete(r.connections, connectionKey)
+	}
+}
+
+func (r *InMemoryJobRegistry) UpdateState(ctx context.Context, messageID string, state string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	job, exists := r.jobs[messageID]
+	if !exists {
+		return ErrJobNotFound
+	}
+
+	r.transition(job, state)
+
+	return nil
+}
+
+func (r *InMemoryJobRegistry) transition(job *Job, state string) {
+	job.applyTransition(state, time.Now().UTC())
+	if isTerminalJobState(job.State) {
+		r.removeFromConnection(job)
+	}
+}
+
+func (r *InMemoryJobRegistry) Get(ctx context.Context, messageID string) (*Job, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	job, exists := r.jobs[messageID]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+
+	jobCopy := *job
+	jobCopy.applyTimeout(r.jobTimeout, time.Now().UTC())
+
+	return &jobCopy, nil
+}
+
+func (r *InMemoryJobRegistry) MarkConnectionLost(ctx context.Context, account string, nodeID string, connectionID string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	for messageID := range r.connections[getJobConnectionKey(account, nodeID, connectionID)] {
+		r.transition(r.jobs[messageID], JobStateLost)
+	}
+
+	return nil
+}
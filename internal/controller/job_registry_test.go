@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+
+	"github.com/alicebob/miniredis"
+)
+
+func newTestJob(messageID string, createdAt time.Time) Job {
+	return Job{
+		MessageID: messageID,
+		Account:   "0000001",
+		Recipient: "node-b",
+		NodeID:    "node-a",
+		Directive: "worker:action",
+		State:     JobStateSent,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+
+		ConnectionID: "connection-a",
+	}
+}
+
+func testJobRegistries(t *testing.T, testFunc func(t *testing.T, registry JobRegistry)) {
+	cfg := config.GetConfig()
+
+	t.Run("memory", func(t *testing.T) {
+		testFunc(t, NewInMemoryJobRegistry(cfg))
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		s, _ := miniredis.Run()
+		defer s.Close()
+
+		testFunc(t, NewRedisJobRegistry(newTestRedisClient(s.Addr()), cfg))
+	})
+}
+
+func verifyJobState(t *testing.T, registry JobRegistry, messageID string, expectedState string) {
+	job, err := registry.Get(context.TODO(), messageID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if job.State != expectedState {
+		t.Fatalf("Job state was incorrect, got: %s, want: %s", job.State, expectedState)
+	}
+}
+
+func TestJobStateTransitions(t *testing.T) {
+	tests := []struct {
+		name          string
+		states        []string
+		expectedState string
+	}{
+		{"sent", []string{}, JobStateSent},
+		{"acknowledged", []string{JobStateAcknowledged, JobStateAcknowledged}, JobStateAcknowledged},
+		{"completed", []string{JobStateAcknowledged, JobStateCompleted}, JobStateCompleted},
+		{"failed", []string{JobStateAcknowledged, JobStateFailed}, JobStateFailed},
+		{"terminal state is kept", []string{JobStateCompleted, JobStateAcknowledged, JobStateFailed}, JobStateCompleted},
+	}
+
+	testJobRegistries(t, func(t *testing.T, registry JobRegistry) {
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				messageID := "job-" + tc.name
+				registry.Register(context.TODO(), newTestJob(messageID, time.Now().UTC()))
+
+				for _, state := range tc.states {
+					if err := registry.UpdateState(context.TODO(), messageID, state); err != nil {
+						t.Fatalf("Unexpected error: %s", err)
+					}
+				}
+
+				verifyJobState(t, registry, messageID, tc.expectedState)
+			})
+		}
+	})
+}
+
+func TestJobTimesOut(t *testing.T) {
+	testJobRegistries(t, func(t *testing.T, registry JobRegistry) {
+		createdAt := time.Now().UTC().Add(-2 * config.GetConfig().JobRegistryJobTimeout)
+		registry.Register(context.TODO(), newTestJob("old-job", createdAt))
+
+		verifyJobState(t, registry, "old-job", JobStateTimedOut)
+	})
+}
+
+func TestJobLostOnDisconnect(t *testing.T) {
+	testJobRegistries(t, func(t *testing.T, registry JobRegistry) {
+		registry.Register(context.TODO(), newTestJob("in-flight-job", time.Now().UTC()))
+		registry.Register(context.TODO(), newTestJob("completed-job", time.Now().UTC()))
+		registry.UpdateState(context.TODO(), "completed-job", JobStateCompleted)
+
+		if err := registry.MarkConnectionLost(context.TODO(), "0000001", "node-a", "connection-a"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		verifyJobState(t, registry, "in-flight-job", JobStateLost)
+		verifyJobState(t, registry, "completed-job", JobStateCompleted)
+	})
+}
+
+func TestJobOnNewConnectionNotLostOnDisconnect(t *testing.T) {
+	testJobRegistries(t, func(t *testing.T, registry JobRegistry) {
+		newConnectionJob := newTestJob("new-connection-job", time.Now().UTC())
+		newConnectionJob.ConnectionID = "connection-b"
+		registry.Register(context.TODO(), newTestJob("old-connection-job", time.Now().UTC()))
+		registry.Register(context.TODO(), newConnectionJob)
+
+		// The node reconnected before the old connection's disconnect was handled
+		if err := registry.MarkConnectionLost(context.TODO(), "0000001", "node-a", "connection-a"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		verifyJobState(t, registry, "old-connection-job", JobStateLost)
+		verifyJobState(t, registry, "new-connection-job", JobStateSent)
+	})
+}
+
+func TestRegisterKeepsFinishedJob(t *testing.T) {
+	testJobRegistries(t, func(t *testing.T, registry JobRegistry) {
+		registry.Register(context.TODO(), newTestJob("finished-job", time.Now().UTC()))
+		registry.UpdateState(context.TODO(), "finished-job", JobStateCompleted)
+
+		if err := registry.Register(context.TODO(), newTestJob("finished-job", time.Now().UTC())); err != ErrJobFinished {
+			t.Fatalf("Expected ErrJobFinished, got: %v", err)
+		}
+
+		verifyJobState(t, registry, "finished-job", JobStateCompleted)
+	})
+}
+
+func TestUnknownJob(t *testing.T) {
+	testJobRegistries(t, func(t *testing.T, registry JobRegistry) {
+		if _, err := registry.Get(context.TODO(), "unknown-job"); err != ErrJobNotFound {
+			t.Fatalf("Expected ErrJobNotFound, got: %v", err)
+		}
+
+		if err := registry.UpdateState(context.TODO(), "unknown-job", JobStateCompleted); err != ErrJobNotFound {
+			t.Fatalf("Expected ErrJobNotFound, got: %v", err)
+		}
+	})
+}
+
+func TestJobStateForResponse(t *testing.T) {
+	tests := []struct {
+		response      ResponseMessage
+		expectedState string
+	}{
+		{ResponseMessage{MessageType: "response"}, JobStateAcknowledged},
+		{ResponseMessage{MessageType: ResponseMessageTypeEOF}, JobStateCompleted},
+		{ResponseMessage{MessageType: "response", Code: 1}, JobStateFailed},
+		{ResponseMessage{MessageType: ResponseMessageTypeEOF, Code: 1}, JobStateFailed},
+	}
+
+	for _, tc := range tests {
+		if state := JobStateForResponse(tc.response); state != tc.expectedState {
+			t.Fatalf("Job state was incorrect for %v, got: %s, want: %s", tc.response, state, tc.expectedState)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/mesh_router"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MeshConnectionLocator locates a connection that can be used to reach a node
+// of an account's receptor mesh.  The topology of each connection is cached
+// for the topology cache ttl so that locating a node that is not directly
+// connected does not retrieve the topology of every connection to the account
+// each time.  A router is built once for each version of a topology.  A ttl of
+// 0 disables the cache.
+//
+// Every gateway connection shows up in the mesh as an edge to the
+// controller's node id.  The controller does not relay messages between its
+// connections, so the routers leave out the controller's edges.
+type MeshConnectionLocator struct {
+	connectionLocator ConnectionLocator
+	controllerNodeID  string
+	topologyTTL       time.Duration
+	topologies        map[string]map[string]*cachedTopology
+	now               func() time.Time
+	sync.Mutex
+}
+
+type cachedTopology struct {
+	version   uint64
+	edges     []mesh_router.Edge
+	router    *mesh_router.MeshRouter
+	expiresAt time.Time
+}
+
+func NewMeshConnectionLocator(cl ConnectionLocator, cfg *config.Config) *MeshConnectionLocator {
+	return &MeshConnectionLocator{
+		connectionLocator: cl,
+		controllerNodeID:  cfg.ReceptorControllerNodeId,
+		topologyTTL:       cfg.ReceptorMeshTopologyCacheTTL,
+		topologies:        make(map[string]map[string]*cachedTopology),
+		now:               time.Now,
+	}
+}
+
+// LocateConnectionToNode locates a connection that can be used to reach the
+// recipient.  A direct connection to the recipient is preferred.  Otherwise
+// the connection whose mesh advertises the lowest cost route to the recipient
+// is used.  The route from the connected node to the recipient is returned
+// along with the connection.
+func (ml *MeshConnectionLocator) LocateConnectionToNode(ctx context.Context, account string, recipient string) (Receptor, []string) {
+	client := ml.connectionLocator.GetConnection(ctx, account, recipient)
+	if client != nil {
+		return client, []string{recipient}
+	}
+
+	log := logger.Log.WithFields(logrus.Fields{"account": account, "recipient": recipient})
+
+	connections := ml.connectionLocator.GetConnectionsByAccount(ctx, account)
+	defer ml.forgetDisconnectedNodes(account, connections)
+
+	// Walk the connections in a stable order so that ties are broken consistently
+	nodeIDs := make([]string, 0, len(connections))
+	for nodeID := range connections {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Strings(nodeIDs)
+
+	var selectedClient Receptor
+	var selectedPath mesh_router.Path
+
+	for _, nodeID := range nodeIDs {
+		client := connections[nodeID]
+		if client == nil {
+			continue
+		}
+
+		router := ml.getRouter(ctx, log, account, nodeID, client)
+		if router == nil {
+			continue
+		}
+
+		path, found := router.GetPathToNode(nodeID, recipient)
+		if found == false {
+			continue
+		}
+
+		if selectedClient == nil || path.Cost < selectedPath.Cost {
+			selectedClient = client
+			selectedPath = path
+		}
+	}
+
+	if selectedClient == nil {
+		log.Debug("Unable to locate a connection with a route to the recipient")
+		return nil, nil
+	}
+
+	log.WithFields(logrus.Fields{"route_list": selectedPath.Nodes}).Debug("Located a route to the recipient")
+
+	return selectedClient, selectedPath.Nodes
+}
+
+// getRouter returns a router for the mesh that is reachable through the
+// connection.  The topology is only retrieved from the connection once the
+// cached copy has expired.  nil is returned if the topology is not available.
+func (ml *MeshConnectionLocator) getRouter(ctx context.Context, log *logrus.Entry, account string, nodeID string, client Receptor) *mesh_router.MeshRouter {
+	now := ml.now()
+
+	ml.Lock()
+	cached := ml.topologies[account][nodeID]
+	ml.Unlock()
+
+	if cached != nil && now.Before(cached.expiresAt) {
+		return cached.router
+	}
+
+	topology, err := client.GetTopology(ctx)
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err, "node_id": nodeID}).Warn("Unable to retrieve the mesh topology")
+		return nil
+	}
+
+	if topology == nil {
+		return nil
+	}
+
+	// The version alone does not identify the topology once the node has
+	// reconnected to another gateway, so the edges are compared as well
+	var router *mesh_router.MeshRouter
+	if cached != nil && cached.version == topology.Version && reflect.DeepEqual(cached.edges, topology.Edges) {
+		router = cached.router
+	} else {
+		router = topology.RouterExcluding(ml.controllerNodeID)
+	}
+
+	refreshed := &cachedTopology{
+		version:   topology.Version,
+		edges:     topology.Edges,
+		router:    router,
+		expiresAt: now.Add(ml.topologyTTL),
+	}
+
+	ml.Lock()
+	defer ml.Unlock()
+
+	if _, exists := ml.topologies[account]; exists == false {
+		ml.topologies[account] = make(map[string]*cachedTopology)
+	}
+	ml.topologies[account][nodeID] = refreshed
+
+	return refreshed.router
+}
+
+// forgetDisconnectedNodes removes the cached topologies of the nodes that are
+// no longer connected to the account
+func (ml *MeshConnectionLocator) forgetDisconnectedNodes(account string, connections map[string]Receptor) {
+	ml.Lock()
+	defer ml.Unlock()
+
+	for nodeID := range ml.topologies[account] {
+		if connections[nodeID] == nil {
+			delete(ml.topologies[account], nodeID)
+		}
+	}
+
+	if len(ml.topologies[account]) == 0 {
+		delete(ml.topologies, account)
+	}
+}
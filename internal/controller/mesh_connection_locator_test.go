@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/mesh_router"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/protocol"
+)
+
+func TestLocateConnectionToNode(t *testing.T) {
+	account := "0000001"
+
+	nodeA := newTestReceptorService(account, "node-a")
+	nodeA.UpdateRoutingTable("node-a", nil, []protocol.Edge{
+		{Left: "node-a", Right: "node-c", Cost: 5},
+		{Left: "node-c", Right: "node-d", Cost: 1},
+	}, nil)
+
+	nodeB := newTestReceptorService(account, "node-b")
+	nodeB.UpdateRoutingTable("node-b", nil, []protocol.Edge{
+		{Left: "node-b", Right: "node-c", Cost: 1},
+	}, nil)
+
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), account, "node-a", nodeA)
+	cm.Register(context.TODO(), account, "node-b", nodeB)
+	cm.Register(context.TODO(), account, "node-no-topology", &MockReceptor{})
+
+	ml := NewMeshConnectionLocator(cm, config.GetConfig())
+
+	tests := []struct {
+		recipient        string
+		expectedReceptor Receptor
+		expectedRoute    []string
+	}{
+		{"node-a", nodeA, []string{"node-a"}},
+		{"node-c", nodeB, []string{"node-b", "node-c"}},
+		{"node-d", nodeA, []string{"node-a", "node-c", "node-d"}},
+		{"node-z", nil, nil},
+	}
+
+	for _, tc := range tests {
+		receptor, route := ml.LocateConnectionToNode(context.TODO(), account, tc.recipient)
+
+		if receptor != tc.expectedReceptor {
+			t.Fatalf("Incorrect connection located for recipient %s", tc.recipient)
+		}
+
+		if reflect.DeepEqual(route, tc.expectedRoute) == false {
+			t.Fatalf("Incorrect route for recipient %s, got: %v, want: %v", tc.recipient, route, tc.expectedRoute)
+		}
+	}
+}
+
+type topologyCountingReceptor struct {
+	MockReceptor
+	topology      mesh_router.Topology
+	topologyCalls int
+}
+
+func (r *topologyCountingReceptor) GetTopology(context.Context) (*mesh_router.Topology, error) {
+	r.topologyCalls++
+	topology := r.topology
+	return &topology, nil
+}
+
+func TestLocateConnectionToNodeCachesTopology(t *testing.T) {
+	account := "0000001"
+
+	nodeA := &topologyCountingReceptor{topology: mesh_router.Topology{
+		Version: 1,
+		Edges:   []mesh_router.Edge{{Left: "node-a", Right: "node-c", Cost: 1}},
+	}}
+
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), account, "node-a", nodeA)
+
+	cfg := config.GetConfig()
+	cfg.ReceptorMeshTopologyCacheTTL = time.Minute
+
+	now := time.Now()
+	ml := NewMeshConnectionLocator(cm, cfg)
+	ml.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if receptor, _ := ml.LocateConnectionToNode(context.TODO(), account, "node-c"); receptor != nodeA {
+			t.Fatalf("Incorrect connection located for recipient node-c")
+		}
+	}
+
+	if nodeA.topologyCalls != 1 {
+		t.Fatalf("Topology was retrieved %d times, want: %d", nodeA.topologyCalls, 1)
+	}
+
+	router := ml.topologies[account]["node-a"].router
+
+	// The router is kept when the topology has not changed
+	now = now.Add(2 * time.Minute)
+	ml.LocateConnectionToNode(context.TODO(), account, "node-c")
+
+	if nodeA.topologyCalls != 2 || ml.topologies[account]["node-a"].router != router {
+		t.Fatalf("Expected the expired topology to be retrieved again with the same router")
+	}
+
+	// A new version of the topology is used once the cached copy expires
+	nodeA.topology = mesh_router.Topology{
+		Version: 2,
+		Edges:   []mesh_router.Edge{{Left: "node-a", Right: "node-d", Cost: 1}},
+	}
+
+	if receptor, _ := ml.LocateConnectionToNode(context.TODO(), account, "node-d"); receptor != nil {
+		t.Fatalf("Expected the cached topology to be used")
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	receptor, route := ml.LocateConnectionToNode(context.TODO(), account, "node-d")
+	if receptor != nodeA || reflect.DeepEqual(route, []string{"node-a", "node-d"}) == false {
+		t.Fatalf("Incorrect route for recipient node-d, got: %v", route)
+	}
+
+	// The topology of a node is forgotten once it disconnects
+	cm.Unregister(context.TODO(), account, "node-a")
+	ml.LocateConnectionToNode(context.TODO(), account, "node-d")
+
+	if _, exists := ml.topologies[account]; exists {
+		t.Fatalf("Expected the topology of the disconnected node to be forgotten")
+	}
+}
+
+func TestLocateConnectionToNodeDoesNotRouteThroughController(t *testing.T) {
+	account := "0000001"
+
+	cfg := config.GetConfig()
+	controllerNodeID := cfg.ReceptorControllerNodeId
+
+	// The cheapest path to node-c leaves the mesh through the controller and
+	// comes back in through another connection
+	nodeA := &topologyCountingReceptor{topology: mesh_router.Topology{
+		Version: 1,
+		Edges: []mesh_router.Edge{
+			{Left: "node-a", Right: controllerNodeID, Cost: 1},
+			{Left: controllerNodeID, Right: "node-b", Cost: 1},
+			{Left: "node-b", Right: "node-c", Cost: 1},
+			{Left: "node-a", Right: "node-d", Cost: 5},
+			{Left: "node-d", Right: "node-c", Cost: 5},
+			{Left: controllerNodeID, Right: "node-e", Cost: 1},
+		},
+	}}
+
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), account, "node-a", nodeA)
+
+	ml := NewMeshConnectionLocator(cm, cfg)
+
+	receptor, route := ml.LocateConnectionToNode(context.TODO(), account, "node-c")
+	if receptor != nodeA || reflect.DeepEqual(route, []string{"node-a", "node-d", "node-c"}) == false {
+		t.Fatalf("Incorrect route for recipient node-c, got: %v", route)
+	}
+
+	if receptor, route := ml.LocateConnectionToNode(context.TODO(), account, "node-e"); receptor != nil {
+		t.Fatalf("Expected node-e to be unreachable, got route: %v", route)
+	}
+}
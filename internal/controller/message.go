@@ -4,12 +4,18 @@ import (
 	"github.com/google/uuid"
 )
 
-type Message struct {
-	MessageID uuid.UUID
-	Recipient string
-	RouteList []string
-	Payload   interface{}
-	Directive string
+// JobMessage is a job that was submitted through the jobs topic.  The key of
+// the kafka message is "account:node_id" where node_id is the recipient of
+// the job.
+type JobMessage struct {
+	MessageID string      `json:"message_id"`
+	Payload   interface{} `json:"payload"`
+	Directive string      `json:"directive"`
+	TTL       int         `json:"ttl,omitempty"`
+	Lane      Lane        `json:"lane,omitempty"`
+
+	Account   string `json:"-"`
+	Recipient string `json:"-"`
 }
 
 type ResponseMessage struct {
@@ -21,4 +27,68 @@ type ResponseMessage struct {
 	Code          int         `json:"code"`
 	InResponseTo  string      `json:"in_response_to"`
 	Serial        int         `json:"serial"`
+
+	// SchemaViolations lists the ways in which the payload does not match
+	// the response schema of the job's directive
+	SchemaViolations []string `json:"schema_violations,omitempty"`
+}
+
+const (
+	// ResponseMessageTypeResponse is the message type of the responses that
+	// carry the output of a job
+	ResponseMessageTypeResponse = "response"
+
+	// ResponseMessageTypeEOF is the message type of the final response to a job
+	ResponseMessageTypeEOF = "eof"
+
+	// ResponseMessageTypeConnectionLost is the message type of the response
+	// that is produced by the controller for each job that was still in
+	// flight when the connection to the receptor node was lost
+	ResponseMessageTypeConnectionLost = "connection_lost"
+
+	// ResponseCodeConnectionLost is the code of the connection_lost response.
+	// Receptor nodes only use 0 (success) and 1 (error).
+	ResponseCodeConnectionLost = -1
+
+	// ResponseMessageTypeExpired is the message type of the response that is
+	// produced by the controller for a queued job that expired before the
+	// recipient connected
+	ResponseMessageTypeExpired = "expired"
+
+	// ResponseCodeExpired is the code of the expired response
+	ResponseCodeExpired = -2
+
+	// ResponseMessageTypeCancelled is the message type of the response that
+	// is produced by the controller when a job is cancelled
+	ResponseMessageTypeCancelled = "cancelled"
+
+	// ResponseCodeCancelled is the code of the cancelled response
+	ResponseCodeCancelled = -3
+)
+
+// CancelDirective asks the receptor node to stop a job.  The in_response_to
+// field and the payload of the cancel message hold the id of the job.
+const CancelDirective = "receptor:cancel"
+
+// The reasons for which the collection of responses to a job can end
+const (
+	ResponsesCompleted    = "completed"
+	ResponsesTimedOut     = "timed_out"
+	ResponsesDisconnected = "disconnected"
+	ResponsesCancelled    = "cancelled"
+	ResponsesExpired      = "expired"
+
+	ResponsesMemoryLimitExceeded = "memory_limit_exceeded"
+
+	// ResponsesOverflowed ends a stream whose reader did not keep up with
+	// the responses
+	ResponsesOverflowed = "overflowed"
+)
+
+// SyncJobResponse contains the responses that were collected while waiting
+// for a job to complete.  The responses are ordered by serial number.
+type SyncJobResponse struct {
+	MessageID uuid.UUID
+	Status    string
+	Responses []ResponseMessage
 }
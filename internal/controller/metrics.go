@@ -13,6 +13,15 @@ type Metrics struct {
 	responseMessageWithoutHandlerCounter prometheus.Counter
 	responseMessageHandledCounter        prometheus.Counter
 	messageDirectiveCounter              *prometheus.CounterVec
+	jobDispatchCounter                   *prometheus.CounterVec
+	jobRateLimitedCounter                *prometheus.CounterVec
+	connectionOverloadedCounter          *prometheus.CounterVec
+	directiveSchemaViolationCounter      *prometheus.CounterVec
+
+	responseAggregatorBufferedBytesGauge        prometheus.Gauge
+	responseAggregatorEarlyFlushCounter         prometheus.Counter
+	aggregatedResponseKafkaWriterSuccessCounter prometheus.Counter
+	aggregatedResponseKafkaWriterFailureCounter prometheus.Counter
 
 	podRunningStatusLookupFailure                 prometheus.Counter
 	autoConnectionClosureDueToDuplicateConnection prometheus.Counter
@@ -84,6 +93,46 @@ func NewMetrics() *Metrics {
 		Help: "The number of messages recieved by the receptor controller per directive",
 	}, []string{"directive"})
 
+	metrics.directiveSchemaViolationCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "receptor_controller_directive_schema_violation_count",
+		Help: "The number of job and response payloads that did not match the schema of their directive",
+	}, []string{"directive", "kind"})
+
+	metrics.jobDispatchCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "receptor_controller_job_dispatch_count",
+		Help: "The number of messages consumed from the jobs topic per dispatch result",
+	}, []string{"result"})
+
+	metrics.jobRateLimitedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "receptor_controller_job_rate_limited_count",
+		Help: "The number of job submissions that were rejected per rate limit",
+	}, []string{"limit"})
+
+	metrics.connectionOverloadedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "receptor_controller_connection_overloaded_count",
+		Help: "The number of messages that were rejected because the send buffer of the connection stayed full",
+	}, []string{"lane"})
+
+	metrics.responseAggregatorBufferedBytesGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "receptor_controller_response_aggregator_buffered_bytes",
+		Help: "The number of bytes of responses buffered by the response aggregator",
+	})
+
+	metrics.responseAggregatorEarlyFlushCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "receptor_controller_response_aggregator_early_flush_count",
+		Help: "The number of aggregated responses that were written early to keep the buffered responses within the limit",
+	})
+
+	metrics.aggregatedResponseKafkaWriterSuccessCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "receptor_controller_kafka_aggregated_response_writer_success_count",
+		Help: "The number of aggregated responses that were sent to the kafka topic",
+	})
+
+	metrics.aggregatedResponseKafkaWriterFailureCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "receptor_controller_kafka_aggregated_response_writer_failure_count",
+		Help: "The number of aggregated responses that failed to get produced to kafka topic",
+	})
+
 	return metrics
 }
 
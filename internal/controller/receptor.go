@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/mesh_router"
 	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/protocol"
 
 	"github.com/google/uuid"
@@ -22,17 +24,31 @@ var (
 	requestCancelledBySender        = errors.New("Unable to complete the request.  Request cancelled by message sender.")
 	requestTimedOut                 = errors.New("Unable to complete the request.  Request timed out.")
 	accountMismatch                 = errors.New("Account mismatch.  Unable to complete the request.")
+	jobCancelled                    = errors.New("Job cancelled")
+	recipientUnreachable            = errors.New("Recipient is not reachable through this connection")
 )
 
 type ReceptorServiceFactory struct {
-	kafkaWriter *kafka.Writer
-	config      *config.Config
+	kafkaWriter        *kafka.Writer
+	responseAggregator *ResponseAggregator
+	jobRegistry        JobRegistry
+	jobQueue           JobQueue
+	directiveSchemas   *DirectiveSchemaRegistry
+	config             *config.Config
 }
 
-func NewReceptorServiceFactory(w *kafka.Writer, cfg *config.Config) *ReceptorServiceFactory {
+// NewReceptorServiceFactory creates a ReceptorServiceFactory.  The response
+// aggregator is optional.  Responses are not aggregated if it is nil.  The
+// directive schema registry is optional.  Responses are not validated if it
+// is nil.
+func NewReceptorServiceFactory(w *kafka.Writer, ra *ResponseAggregator, jr JobRegistry, jq JobQueue, ds *DirectiveSchemaRegistry, cfg *config.Config) *ReceptorServiceFactory {
 	return &ReceptorServiceFactory{
-		kafkaWriter: w,
-		config:      cfg,
+		kafkaWriter:        w,
+		responseAggregator: ra,
+		jobRegistry:        jr,
+		jobQueue:           jq,
+		directiveSchemas:   ds,
+		config:             cfg,
 	}
 }
 
@@ -40,12 +56,22 @@ func (fact *ReceptorServiceFactory) NewReceptorService(logger *logrus.Entry, acc
 	return &ReceptorService{
 		AccountNumber: account,
 		NodeID:        nodeID,
+		ConnectionID:  uuid.New().String(),
 		responseDispatcherRegistrar: &DispatcherTable{
-			dispatchTable: make(map[uuid.UUID]chan ResponseMessage),
+			dispatchTable: make(map[uuid.UUID]*dispatcherEntry),
 		},
-		kafkaWriter: fact.kafkaWriter,
-		config:      fact.config,
-		logger:      logger,
+		inFlightJobs:       make(map[string]inFlightJob),
+		acknowledgedJobs:   make(map[string]time.Time),
+		sentJobs:           make(map[string]sentJob),
+		router:             mesh_router.NewMeshRouter(fact.config.ReceptorMeshNodeTTL),
+		chunkAssembler:     protocol.NewChunkAssembler(fact.config.PayloadMaxTransferSize, fact.config.PayloadTransferTimeout),
+		kafkaWriter:        fact.kafkaWriter,
+		responseAggregator: fact.responseAggregator,
+		jobRegistry:        fact.jobRegistry,
+		jobQueue:           fact.jobQueue,
+		directiveSchemas:   fact.directiveSchemas,
+		config:             fact.config,
+		logger:             logger,
 	}
 }
 
@@ -54,15 +80,79 @@ type ReceptorService struct {
 	NodeID        string
 	PeerNodeID    string
 
+	// ConnectionID identifies this connection to the peer.  The jobs that
+	// are sent through the connection are registered with it.
+	ConnectionID string
+
 	Metadata interface{}
 
+	// Compression is the compression that was negotiated with the peer
+	// during the handshake
+	Compression protocol.Compression
+
+	// Chunking is set if the peer said during the handshake that it can
+	// reassemble chunked payloads
+	Chunking bool
+
 	Transport *Transport
 
 	responseDispatcherRegistrar *DispatcherTable
 
-	kafkaWriter *kafka.Writer
-	config      *config.Config
-	logger      *logrus.Entry
+	// inFlightJobs maps the id of each job whose responses are written to
+	// kafka to the highest serial received so far.  A job is removed once
+	// its final response has been received or the job timeout has passed.
+	inFlightJobs      map[string]inFlightJob
+	inFlightJobsSwept time.Time
+	inFlightJobsLock  sync.Mutex
+
+	// acknowledgedJobs records when each job was first acknowledged by a
+	// response.  Only the first response and the final response to a job
+	// change its state, so the job registry is not updated for the
+	// responses in between.
+	acknowledgedJobs      map[string]time.Time
+	acknowledgedJobsSwept time.Time
+	acknowledgedJobsLock  sync.Mutex
+
+	// sentJobs records the directive of each job that was sent over the
+	// connection.  The responses do not carry the directive, so it is
+	// looked up here to validate them.
+	sentJobs      map[string]sentJob
+	sentJobsSwept time.Time
+	sentJobsLock  sync.Mutex
+
+	router *mesh_router.MeshRouter
+
+	// deliveringQueuedJobs is set while the queued jobs are delivered.
+	// queuedJobDeliveryRequested is set if another delivery was requested
+	// in the meantime.
+	deliveringQueuedJobs       bool
+	queuedJobDeliveryRequested bool
+	queuedJobDeliveryLock      sync.Mutex
+
+	// chunkAssembler reassembles the large responses that the node splits
+	// into chunks
+	chunkAssembler *protocol.ChunkAssembler
+
+	kafkaWriter        kafkaMessageWriter
+	responseAggregator *ResponseAggregator
+	jobRegistry        JobRegistry
+	jobQueue           JobQueue
+	directiveSchemas   *DirectiveSchemaRegistry
+	config             *config.Config
+	logger             *logrus.Entry
+}
+
+// inFlightJob is the highest serial received for a job and when the job was
+// sent
+type inFlightJob struct {
+	serial int
+	sentAt time.Time
+}
+
+// sentJob is the directive of a job that was sent and when it was sent
+type sentJob struct {
+	directive string
+	sentAt    time.Time
 }
 
 func (r *ReceptorService) RegisterConnection(peerNodeID string, metadata interface{}, transport *Transport) error {
@@ -75,12 +165,27 @@ func (r *ReceptorService) RegisterConnection(peerNodeID string, metadata interfa
 	return nil
 }
 
-func (r *ReceptorService) UpdateRoutingTable(edges string, seen string) error {
+func (r *ReceptorService) UpdateRoutingTable(nodeID string, capabilities interface{}, edges []protocol.Edge, seen []string) error {
 	r.logger.Debug("edges:", edges)
 	r.logger.Debug("seen:", seen)
+
+	meshEdges := make([]mesh_router.Edge, len(edges))
+	for i, edge := range edges {
+		meshEdges[i] = mesh_router.Edge{Left: edge.Left, Right: edge.Right, Cost: edge.Cost}
+	}
+
+	r.router.UpdateTopology(meshEdges, seen)
+	r.router.UpdateNodeCapabilities(nodeID, capabilities)
+
 	return nil
 }
 
+// GetRouteToNode returns the lowest cost route from the directly connected
+// peer to the recipient.  nil is returned if the recipient is not reachable.
+func (r *ReceptorService) GetRouteToNode(recipient string) []string {
+	return r.router.GetRouteToNode(r.PeerNodeID, recipient)
+}
+
 func (r *ReceptorService) SendMessage(msgSenderCtx context.Context, account string, recipient string, route []string, payload interface{}, directive string) (*uuid.UUID, error) {
 
 	if account != r.AccountNumber {
@@ -93,6 +198,34 @@ func (r *ReceptorService) SendMessage(msgSenderCtx context.Context, account stri
 		return nil, err
 	}
 
+	err = r.SendMessageWithID(msgSenderCtx, messageID, account, recipient, route, payload, directive)
+	if err != nil {
+		return nil, err
+	}
+
+	return &messageID, nil
+}
+
+// SendMessageWithID sends a message whose id was assigned by the submitter
+// of the job
+func (r *ReceptorService) SendMessageWithID(msgSenderCtx context.Context, messageID uuid.UUID, account string, recipient string, route []string, payload interface{}, directive string) error {
+
+	if account != r.AccountNumber {
+		return accountMismatch
+	}
+
+	err := r.sendJob(msgSenderCtx, messageID, recipient, route, payload, directive)
+	if err != nil {
+		r.updateJobState(messageID.String(), JobStateFailed)
+		return err
+	}
+
+	return nil
+}
+
+// sendJob sends a job whose responses are written to kafka
+func (r *ReceptorService) sendJob(msgSenderCtx context.Context, messageID uuid.UUID, recipient string, route []string, payload interface{}, directive string) error {
+
 	payloadMessage, err := protocol.BuildPayloadMessage(
 		messageID,
 		r.NodeID,
@@ -101,6 +234,10 @@ func (r *ReceptorService) SendMessage(msgSenderCtx context.Context, account stri
 		"directive",
 		directive,
 		payload)
+	if err != nil {
+		return err
+	}
+
 	r.logger.Infof("Sending PayloadMessage - %s\n", messageID)
 
 	msgSenderCtx, cancel := context.WithTimeout(msgSenderCtx, r.config.ReceptorSyncPingTimeout)
@@ -108,12 +245,365 @@ func (r *ReceptorService) SendMessage(msgSenderCtx context.Context, account stri
 
 	metrics.messageDirectiveCounter.With(prometheus.Labels{"directive": directive}).Inc()
 
+	r.registerJob(msgSenderCtx, messageID, recipient, directive)
+	r.addInFlightJob(messageID.String())
+
 	err = r.sendMessage(msgSenderCtx, payloadMessage)
 	if err != nil {
+		r.removeInFlightJob(messageID.String())
+		return err
+	}
+
+	return nil
+}
+
+// DeliverQueuedJobs sends the jobs that were queued while their recipients
+// were offline.  The queues of the peer and of every node that is reachable
+// through it are drained in the order that the jobs were submitted.  It is
+// called when the connection is established and whenever the topology is
+// updated.  A delivery that is requested while another one is running is
+// run again once the running delivery has finished.
+func (r *ReceptorService) DeliverQueuedJobs(ctx context.Context) {
+	r.queuedJobDeliveryLock.Lock()
+	if r.deliveringQueuedJobs {
+		r.queuedJobDeliveryRequested = true
+		r.queuedJobDeliveryLock.Unlock()
+		return
+	}
+	r.deliveringQueuedJobs = true
+	r.queuedJobDeliveryLock.Unlock()
+
+	for {
+		r.deliverQueuedJobsToReachableNodes(ctx)
+
+		r.queuedJobDeliveryLock.Lock()
+		if r.queuedJobDeliveryRequested == false {
+			r.deliveringQueuedJobs = false
+			r.queuedJobDeliveryLock.Unlock()
+			return
+		}
+		r.queuedJobDeliveryRequested = false
+		r.queuedJobDeliveryLock.Unlock()
+	}
+}
+
+func (r *ReceptorService) deliverQueuedJobsToReachableNodes(ctx context.Context) {
+	nodeIDs := []string{r.PeerNodeID}
+	for _, node := range r.router.GetTopology().Nodes {
+		if node.ID != r.PeerNodeID && node.ID != r.NodeID {
+			nodeIDs = append(nodeIDs, node.ID)
+		}
+	}
+
+	for _, nodeID := range nodeIDs {
+		route := r.GetRouteToNode(nodeID)
+		if route == nil {
+			continue
+		}
+
+		if r.deliverQueuedJobsToNode(ctx, nodeID, route) == false {
+			return
+		}
+	}
+}
+
+// deliverQueuedJobsToNode sends the queued jobs of a node along the route.
+// Jobs that expired before the node connected are reported as timed out.
+// Delivery stops if a job cannot be sent.  That job is returned to the front
+// of the queue and false is returned.
+func (r *ReceptorService) deliverQueuedJobsToNode(ctx context.Context, nodeID string, route []string) bool {
+	for {
+		queuedJob, err := r.jobQueue.Dequeue(ctx, r.AccountNumber, nodeID)
+		if err != nil {
+			r.logger.WithFields(logrus.Fields{"error": err, "recipient": nodeID}).Warn("Unable to read the queued jobs")
+			return false
+		}
+
+		if queuedJob == nil {
+			return true
+		}
+
+		logger := r.logger.WithFields(logrus.Fields{"message_id": queuedJob.MessageID, "recipient": nodeID})
+
+		if r.queuedJobCancelled(ctx, queuedJob.MessageID) {
+			logger.Info("Discarding queued job that was cancelled")
+			continue
+		}
+
+		if queuedJob.Expired(time.Now().UTC()) {
+			logger.Info("Queued job expired before the node connected")
+			r.updateJobState(queuedJob.MessageID, JobStateTimedOut)
+			r.writeControllerResponse(logger, queuedJob.MessageID, ResponseMessageTypeExpired, ResponseCodeExpired,
+				"Job expired before the recipient connected", 1)
+			continue
+		}
+
+		messageID, err := uuid.Parse(queuedJob.MessageID)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Error("Discarding queued job with an invalid message id")
+			continue
+		}
+
+		sendCtx := ctx
+		if queuedJob.Lane != "" {
+			sendCtx = WithLane(ctx, queuedJob.Lane)
+		}
+
+		err = r.sendJob(sendCtx, messageID, queuedJob.Recipient, route, queuedJob.Payload, queuedJob.Directive)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Warn("Unable to deliver queued job.  Returning it to the queue.")
+
+			ctx := context.Background()
+			r.jobQueue.Requeue(ctx, *queuedJob)
+			r.jobRegistry.Register(ctx, queuedJob.JobRecord())
+			return false
+		}
+
+		logger.Info("Delivered queued job")
+	}
+}
+
+func (r *ReceptorService) queuedJobCancelled(ctx context.Context, messageID string) bool {
+	job, err := r.jobRegistry.Get(ctx, messageID)
+	if err != nil {
+		return false
+	}
+
+	return job.State == JobStateCancelled
+}
+
+// SendMessageSync sends a message to the recipient and waits for the final
+// response.  The responses that were received before the timeout expired or
+// the connection was lost are returned along with the status of the job.
+func (r *ReceptorService) SendMessageSync(msgSenderCtx context.Context, account string, recipient string, route []string, payload interface{}, directive string, timeout time.Duration) (*SyncJobResponse, error) {
+
+	if account != r.AccountNumber {
+		return nil, accountMismatch
+	}
+
+	messageID, err := uuid.NewRandom()
+	if err != nil {
+		r.logger.Info("Unable to generate UUID for routing the job...cannot proceed")
 		return nil, err
 	}
 
-	return &messageID, nil
+	payloadMessage, err := protocol.BuildPayloadMessage(
+		messageID,
+		r.NodeID,
+		recipient,
+		route,
+		"directive",
+		directive,
+		payload)
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger.Infof("Sending sync PayloadMessage - %s\n", messageID)
+
+	responseChannel := make(chan ResponseMessage)
+
+	r.logger.Info("Registering a sync response handler")
+	r.responseDispatcherRegistrar.Register(messageID, responseChannel)
+	defer r.responseDispatcherRegistrar.Unregister(messageID)
+
+	msgSenderCtx, cancel := context.WithTimeout(msgSenderCtx, timeout)
+	defer cancel()
+
+	metrics.messageDirectiveCounter.With(prometheus.Labels{"directive": directive}).Inc()
+
+	r.registerJob(msgSenderCtx, messageID, recipient, directive)
+
+	err = r.sendMessage(msgSenderCtx, payloadMessage)
+	if err != nil {
+		r.updateJobState(messageID.String(), JobStateFailed)
+		return nil, err
+	}
+
+	responses, err := r.waitForResponses(msgSenderCtx, responseChannel)
+
+	syncJobResponse := &SyncJobResponse{MessageID: messageID, Responses: responses}
+
+	switch err {
+	case nil:
+		syncJobResponse.Status = ResponsesCompleted
+	case requestTimedOut:
+		syncJobResponse.Status = ResponsesTimedOut
+	case connectionToReceptorNetworkLost:
+		syncJobResponse.Status = ResponsesDisconnected
+	case jobCancelled:
+		syncJobResponse.Status = ResponsesCancelled
+	default:
+		return nil, err
+	}
+
+	sort.SliceStable(syncJobResponse.Responses, func(i, j int) bool {
+		return syncJobResponse.Responses[i].Serial < syncJobResponse.Responses[j].Serial
+	})
+
+	return syncJobResponse, nil
+}
+
+// SendMessageStream sends a message to the recipient and returns a stream of
+// the responses.  The stream is closed when the final response is received,
+// the connection is lost, the sender's context is cancelled or the reader
+// falls more than BufferedChannelSize responses behind.
+func (r *ReceptorService) SendMessageStream(msgSenderCtx context.Context, account string, recipient string, route []string, payload interface{}, directive string) (*ResponseStream, error) {
+
+	if account != r.AccountNumber {
+		return nil, accountMismatch
+	}
+
+	messageID, err := uuid.NewRandom()
+	if err != nil {
+		r.logger.Info("Unable to generate UUID for routing the job...cannot proceed")
+		return nil, err
+	}
+
+	payloadMessage, err := protocol.BuildPayloadMessage(
+		messageID,
+		r.NodeID,
+		recipient,
+		route,
+		"directive",
+		directive,
+		payload)
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger.Infof("Sending streaming PayloadMessage - %s\n", messageID)
+
+	responseChannel := make(chan ResponseMessage)
+
+	r.logger.Info("Registering a stream response handler")
+	r.responseDispatcherRegistrar.Register(messageID, responseChannel)
+
+	sendCtx, cancel := context.WithTimeout(msgSenderCtx, r.config.ReceptorSyncPingTimeout)
+	defer cancel()
+
+	metrics.messageDirectiveCounter.With(prometheus.Labels{"directive": directive}).Inc()
+
+	r.registerJob(sendCtx, messageID, recipient, directive)
+
+	err = r.sendMessage(sendCtx, payloadMessage)
+	if err != nil {
+		r.updateJobState(messageID.String(), JobStateFailed)
+		r.responseDispatcherRegistrar.Unregister(messageID)
+		return nil, err
+	}
+
+	stream := NewResponseStream(messageID, r.config.BufferedChannelSize)
+
+	go func() {
+		defer r.responseDispatcherRegistrar.Unregister(messageID)
+
+		for {
+			responseMsg, err := r.waitForResponse(msgSenderCtx, responseChannel)
+
+			switch err {
+			case nil:
+			case connectionToReceptorNetworkLost:
+				stream.Close(ResponsesDisconnected)
+				return
+			default:
+				stream.Close(ResponsesCancelled)
+				return
+			}
+
+			// The responses are handed over by the websocket's read loop so
+			// a slow reader must not hold up the connection.  The stream is
+			// dropped instead once its buffer is full.
+			if stream.TrySend(responseMsg) == false {
+				r.logger.WithFields(logrus.Fields{"message_id": messageID}).Warn("Response stream overflowed.  Dropping the stream.")
+				stream.Close(ResponsesOverflowed)
+				return
+			}
+
+			switch responseMsg.MessageType {
+			case ResponseMessageTypeEOF:
+				stream.Close(ResponsesCompleted)
+				return
+			case ResponseMessageTypeCancelled:
+				stream.Close(ResponsesCancelled)
+				return
+			}
+		}
+	}()
+
+	return stream, nil
+}
+
+// CancelMessage sends a cancel directive for the job to the recipient.  Once
+// the directive has been sent, the job is marked as cancelled.  A caller that
+// is waiting for the responses to the job is handed a cancelled response.
+// Otherwise, the cancelled response is written to kafka.
+func (r *ReceptorService) CancelMessage(msgSenderCtx context.Context, account string, recipient string, jobID uuid.UUID) error {
+
+	if account != r.AccountNumber {
+		return accountMismatch
+	}
+
+	route := r.GetRouteToNode(recipient)
+	if route == nil {
+		return recipientUnreachable
+	}
+
+	messageID, err := uuid.NewRandom()
+	if err != nil {
+		r.logger.Info("Unable to generate UUID for routing the job...cannot proceed")
+		return err
+	}
+
+	cancelMessage, err := protocol.BuildPayloadMessage(
+		messageID,
+		r.NodeID,
+		recipient,
+		route,
+		"directive",
+		CancelDirective,
+		jobID.String())
+	if err != nil {
+		return err
+	}
+
+	cancelMessage.(*protocol.PayloadMessage).Data.InResponseTo = jobID.String()
+
+	logger := r.logger.WithFields(logrus.Fields{"message_id": messageID, "in_response_to": jobID})
+	logger.Info("Sending cancel PayloadMessage")
+
+	msgSenderCtx, cancel := context.WithTimeout(msgSenderCtx, r.config.ReceptorSyncPingTimeout)
+	defer cancel()
+
+	metrics.messageDirectiveCounter.With(prometheus.Labels{"directive": CancelDirective}).Inc()
+
+	err = r.sendControlMessage(msgSenderCtx, cancelMessage)
+	if err != nil {
+		return err
+	}
+
+	r.updateJobState(jobID.String(), JobStateCancelled)
+
+	serial, inFlight := r.removeInFlightJob(jobID.String())
+
+	cancelledResponse, err := r.newControllerResponse(jobID.String(), ResponseMessageTypeCancelled, ResponseCodeCancelled,
+		"Job cancelled", serial+1)
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Error("Unable to build the cancelled response")
+		return nil
+	}
+
+	if r.responseDispatcherRegistrar.Dispatch(jobID, cancelledResponse) {
+		logger.Info("Added cancelled response message to response channel")
+		return nil
+	}
+
+	if inFlight {
+		logger.Info("Dispatching cancelled response message")
+		r.writeResponse(logger, cancelledResponse)
+	}
+
+	return nil
 }
 
 func (r *ReceptorService) Ping(msgSenderCtx context.Context, account string, recipient string, route []string) (interface{}, error) {
@@ -159,24 +649,277 @@ func (r *ReceptorService) Ping(msgSenderCtx context.Context, account string, rec
 	return responseMsg, nil
 }
 
+// registerJob records the job in the job registry before it is sent.  A
+// failure to record the job is logged but does not prevent the job from
+// being sent.
+func (r *ReceptorService) registerJob(ctx context.Context, messageID uuid.UUID, recipient string, directive string) {
+	now := time.Now().UTC()
+
+	r.addSentJob(messageID.String(), directive, now)
+
+	job := Job{
+		MessageID:    messageID.String(),
+		Account:      r.AccountNumber,
+		Recipient:    recipient,
+		NodeID:       r.PeerNodeID,
+		Directive:    directive,
+		State:        JobStateSent,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		ConnectionID: r.ConnectionID,
+	}
+
+	err := r.jobRegistry.Register(ctx, job)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{"error": err, "message_id": job.MessageID}).Warn("Unable to register job")
+	}
+}
+
+func (r *ReceptorService) updateJobState(messageID string, state string) {
+	// The job state must be recorded even if the sender has gone away
+	err := r.jobRegistry.UpdateState(context.Background(), messageID, state)
+	if err != nil && err != ErrJobNotFound {
+		r.logger.WithFields(logrus.Fields{"error": err, "message_id": messageID}).Warn("Unable to update job state")
+	}
+}
+
+// isJobStateTransition returns true if a response moves the job to a new
+// state.  Jobs that have not received their final response are forgotten
+// once the job timeout has passed.
+func (r *ReceptorService) isJobStateTransition(messageID string, state string) bool {
+	r.acknowledgedJobsLock.Lock()
+	defer r.acknowledgedJobsLock.Unlock()
+
+	if isTerminalJobState(state) {
+		delete(r.acknowledgedJobs, messageID)
+		return true
+	}
+
+	if _, acknowledged := r.acknowledgedJobs[messageID]; acknowledged {
+		return false
+	}
+
+	now := time.Now()
+	timeout := r.config.JobRegistryJobTimeout
+
+	if isSweepDue(now, &r.acknowledgedJobsSwept, timeout) {
+		for jobID, acknowledgedAt := range r.acknowledgedJobs {
+			if now.Sub(acknowledgedAt) >= timeout {
+				delete(r.acknowledgedJobs, jobID)
+			}
+		}
+	}
+
+	r.acknowledgedJobs[messageID] = now
+
+	return true
+}
+
+// addSentJob records the directive of the job.  Jobs that have not received
+// their final response are forgotten once the job timeout has passed.
+func (r *ReceptorService) addSentJob(messageID string, directive string, now time.Time) {
+	r.sentJobsLock.Lock()
+	defer r.sentJobsLock.Unlock()
+
+	timeout := r.config.JobRegistryJobTimeout
+
+	if isSweepDue(now, &r.sentJobsSwept, timeout) {
+		for jobID, job := range r.sentJobs {
+			if now.Sub(job.sentAt) >= timeout {
+				delete(r.sentJobs, jobID)
+			}
+		}
+	}
+
+	r.sentJobs[messageID] = sentJob{directive: directive, sentAt: now}
+}
+
+// getSentJobDirective returns the directive of the job that a response
+// answers.  The job is forgotten once its final response has been received.
+func (r *ReceptorService) getSentJobDirective(messageID string, state string) (string, bool) {
+	r.sentJobsLock.Lock()
+	defer r.sentJobsLock.Unlock()
+
+	job, exists := r.sentJobs[messageID]
+	if isTerminalJobState(state) {
+		delete(r.sentJobs, messageID)
+	}
+
+	return job.directive, exists
+}
+
+// isSweepDue returns true if the entries that are older than the timeout
+// should be swept.  A sweep is due at most once per timeout.
+func isSweepDue(now time.Time, lastSwept *time.Time, timeout time.Duration) bool {
+	if now.Sub(*lastSwept) < timeout {
+		return false
+	}
+
+	*lastSwept = now
+	return true
+}
+
+func (r *ReceptorService) addInFlightJob(messageID string) {
+	r.inFlightJobsLock.Lock()
+	defer r.inFlightJobsLock.Unlock()
+
+	now := time.Now()
+	r.expireInFlightJobs(now)
+	r.inFlightJobs[messageID] = inFlightJob{sentAt: now}
+}
+
+// expireInFlightJobs forgets the jobs that have not received their final
+// response within the job timeout.  The caller must hold the lock.
+func (r *ReceptorService) expireInFlightJobs(now time.Time) {
+	timeout := r.config.JobRegistryJobTimeout
+
+	if isSweepDue(now, &r.inFlightJobsSwept, timeout) {
+		for jobID, job := range r.inFlightJobs {
+			if now.Sub(job.sentAt) >= timeout {
+				delete(r.inFlightJobs, jobID)
+			}
+		}
+	}
+}
+
+// removeInFlightJob stops tracking the job.  The highest serial received so
+// far is returned along with true if the job was being tracked.
+func (r *ReceptorService) removeInFlightJob(messageID string) (int, bool) {
+	r.inFlightJobsLock.Lock()
+	defer r.inFlightJobsLock.Unlock()
+
+	job, exists := r.inFlightJobs[messageID]
+	delete(r.inFlightJobs, messageID)
+
+	return job.serial, exists
+}
+
+func (r *ReceptorService) updateInFlightJob(responseMessage ResponseMessage) {
+	r.inFlightJobsLock.Lock()
+	defer r.inFlightJobsLock.Unlock()
+
+	job, exists := r.inFlightJobs[responseMessage.InResponseTo]
+	if exists == false {
+		return
+	}
+
+	if isTerminalJobState(JobStateForResponse(responseMessage)) {
+		delete(r.inFlightJobs, responseMessage.InResponseTo)
+	} else if responseMessage.Serial > job.serial {
+		job.serial = responseMessage.Serial
+		r.inFlightJobs[responseMessage.InResponseTo] = job
+	}
+}
+
+// FailInFlightJobs writes a connection_lost response to kafka for each job
+// that has not received its final response.  This allows the consumers of
+// the responses to fail the job instead of waiting for their own timeouts.
+func (r *ReceptorService) FailInFlightJobs() {
+	r.inFlightJobsLock.Lock()
+	inFlightJobs := r.inFlightJobs
+	r.inFlightJobs = make(map[string]inFlightJob)
+	r.inFlightJobsLock.Unlock()
+
+	for inResponseTo, job := range inFlightJobs {
+		logger := r.logger.WithFields(logrus.Fields{"in_response_to": inResponseTo})
+
+		logger.Info("Dispatching connection lost response message")
+
+		r.writeControllerResponse(logger, inResponseTo, ResponseMessageTypeConnectionLost, ResponseCodeConnectionLost,
+			connectionToReceptorNetworkLost.Error(), job.serial+1)
+	}
+}
+
+// writeControllerResponse writes a response that was produced by the
+// controller on behalf of the receptor node
+func (r *ReceptorService) writeControllerResponse(logger *logrus.Entry, inResponseTo string, messageType string, code int, payload interface{}, serial int) {
+	responseMessage, err := r.newControllerResponse(inResponseTo, messageType, code, payload, serial)
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Error("Unable to generate UUID for the response")
+		return
+	}
+
+	r.writeResponse(logger, responseMessage)
+}
+
+func (r *ReceptorService) newControllerResponse(inResponseTo string, messageType string, code int, payload interface{}, serial int) (ResponseMessage, error) {
+	messageID, err := uuid.NewRandom()
+	if err != nil {
+		return ResponseMessage{}, err
+	}
+
+	return ResponseMessage{
+		AccountNumber: r.AccountNumber,
+		Sender:        r.NodeID,
+		MessageID:     messageID.String(),
+		MessageType:   messageType,
+		Payload:       payload,
+		Code:          code,
+		InResponseTo:  inResponseTo,
+		Serial:        serial,
+	}, nil
+}
+
 // FIXME:  Does it make sense to move this logic to the transport object?  Or am I missing an abstraction?
 func (r *ReceptorService) sendControlMessage(msgSenderCtx context.Context, msgToSend protocol.Message) error {
 
-	msg := ReceptorMessage{AccountNumber: r.AccountNumber, Message: msgToSend}
+	msg := ReceptorMessage{AccountNumber: r.AccountNumber, Message: msgToSend, Compression: r.Compression}
 
-	return sendMessage(r.logger, r.Transport.Ctx, r.Transport.ControlChannel, msgSenderCtx, msg)
+	return sendMessage(r.logger, r.Transport.Ctx, LaneControl, r.Transport.Lanes[LaneControl], r.config.ReceptorMaxSendWait, msgSenderCtx, msg)
 }
 
+// sendMessage passes the message to the async layer on the lane chosen by
+// the sender.  Payloads that are larger than the chunk size are split into
+// chunks which are passed to the async layer in order.
 func (r *ReceptorService) sendMessage(msgSenderCtx context.Context, msgToSend protocol.Message) error {
 
-	msg := ReceptorMessage{AccountNumber: r.AccountNumber, Message: msgToSend}
+	lane := LaneFromContext(msgSenderCtx)
+
+	logger := r.logger.WithFields(logrus.Fields{"lane": lane})
+
+	// Peers that do not understand chunks get their payloads in one piece
+	payloadMessage, ok := msgToSend.(*protocol.PayloadMessage)
+	if !ok || r.Chunking == false {
+		msg := ReceptorMessage{AccountNumber: r.AccountNumber, Message: msgToSend, Compression: r.Compression}
+		return sendMessage(logger, r.Transport.Ctx, lane, r.Transport.Lanes[lane], r.config.ReceptorMaxSendWait, msgSenderCtx, msg)
+	}
+
+	chunks, err := protocol.SplitPayloadMessage(payloadMessage, r.config.PayloadChunkSize)
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Error("Unable to split the payload into chunks")
+		return err
+	}
+
+	if len(chunks) > 1 {
+		logger.WithFields(logrus.Fields{"chunks": len(chunks),
+			"transfer_id": chunks[0].Data.Chunk.TransferID}).Info("Sending the payload in chunks")
+	}
+
+	for _, chunk := range chunks {
+		msg := ReceptorMessage{AccountNumber: r.AccountNumber, Message: chunk, Compression: r.Compression}
+		err = sendMessage(logger, r.Transport.Ctx, lane, r.Transport.Lanes[lane], r.config.ReceptorMaxSendWait, msgSenderCtx, msg)
+		if err != nil {
+			return err
+		}
+	}
 
-	return sendMessage(r.logger, r.Transport.Ctx, r.Transport.Send, msgSenderCtx, msg)
+	return nil
 }
 
-func sendMessage(logger *logrus.Entry, transportCtx context.Context, sendChannel chan ReceptorMessage, msgSenderCtx context.Context, msgToSend ReceptorMessage) error {
+// sendMessage waits up to maxWait for room on the lane's channel.  A
+// ConnectionOverloadedError is returned if the channel stays full so that a
+// slow connection can be told apart from a dead one.  A maxWait of zero waits
+// until the sender gives up.
+func sendMessage(logger *logrus.Entry, transportCtx context.Context, lane Lane, sendChannel chan ReceptorMessage, maxWait time.Duration, msgSenderCtx context.Context, msgToSend ReceptorMessage) error {
 	logger.Debug("Passing message to async layer")
 
+	var overloaded <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		overloaded = timer.C
+	}
+
 	select {
 
 	case sendChannel <- msgToSend:
@@ -186,6 +929,11 @@ func sendMessage(logger *logrus.Entry, transportCtx context.Context, sendChannel
 		logger.Info("Connection to receptor network lost")
 		return connectionToReceptorNetworkLost
 
+	case <-overloaded:
+		logger.WithFields(logrus.Fields{"queue_depth": len(sendChannel)}).Info("Connection overloaded")
+		metrics.connectionOverloadedCounter.With(prometheus.Labels{"lane": string(lane)}).Inc()
+		return &ConnectionOverloadedError{Lane: lane, QueueDepth: len(sendChannel), QueueCapacity: cap(sendChannel)}
+
 	case <-msgSenderCtx.Done():
 		switch msgSenderCtx.Err().(error) {
 		case context.DeadlineExceeded:
@@ -226,6 +974,28 @@ func (r *ReceptorService) waitForResponse(msgSenderCtx context.Context, response
 	}
 }
 
+// waitForResponses collects responses until the final (eof) response is
+// received or the job is cancelled
+func (r *ReceptorService) waitForResponses(msgSenderCtx context.Context, responseChannel chan ResponseMessage) ([]ResponseMessage, error) {
+	responses := make([]ResponseMessage, 0)
+
+	for {
+		responseMsg, err := r.waitForResponse(msgSenderCtx, responseChannel)
+		if err != nil {
+			return responses, err
+		}
+
+		responses = append(responses, responseMsg)
+
+		switch responseMsg.MessageType {
+		case ResponseMessageTypeEOF:
+			return responses, nil
+		case ResponseMessageTypeCancelled:
+			return responses, jobCancelled
+		}
+	}
+}
+
 func (r *ReceptorService) DispatchResponse(payloadMessage *protocol.PayloadMessage) {
 
 	logger := r.logger.WithFields(logrus.Fields{"in_response_to": payloadMessage.Data.InResponseTo,
@@ -239,6 +1009,17 @@ func (r *ReceptorService) DispatchResponse(payloadMessage *protocol.PayloadMessa
 		return
 	}
 
+	payloadMessage, complete, err := r.chunkAssembler.Add(payloadMessage)
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Error("Unable to reassemble the chunked response.  Discarding message.")
+		return
+	}
+
+	if !complete {
+		logger.Debug("Waiting for the rest of the chunked response")
+		return
+	}
+
 	responseMessage := ResponseMessage{
 		AccountNumber: r.AccountNumber,
 		Sender:        payloadMessage.RoutingInfo.Sender,
@@ -250,6 +1031,32 @@ func (r *ReceptorService) DispatchResponse(payloadMessage *protocol.PayloadMessa
 		Serial:        payloadMessage.Data.Serial,
 	}
 
+	state := JobStateForResponse(responseMessage)
+
+	// The nodes do not echo the directive in their responses, so the
+	// directive that the job was sent with is used.  A response that does
+	// not match the schema is still passed on so that the submitter of the
+	// job can see what the node sent.  The violations are attached to the
+	// response whether it is written to kafka, returned from a sync job or
+	// streamed.
+	directive, sent := r.getSentJobDirective(responseMessage.InResponseTo, state)
+	if sent == false {
+		directive = payloadMessage.Data.Directive
+	}
+
+	if responseMessage.MessageType == ResponseMessageTypeResponse {
+		err = r.directiveSchemas.ValidateResponse(directive, responseMessage.Payload)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"directive": directive,
+				"error": err}).Warn("Response does not match the schema of the directive")
+
+			var violationErr *DirectiveSchemaViolationError
+			if errors.As(err, &violationErr) {
+				responseMessage.SchemaViolations = violationErr.Violations
+			}
+		}
+	}
+
 	inResponseTo, err := uuid.Parse(payloadMessage.Data.InResponseTo)
 	if err != nil {
 		logger.WithFields(logrus.Fields{"error": err}).Error("Unable to convert " +
@@ -257,22 +1064,35 @@ func (r *ReceptorService) DispatchResponse(payloadMessage *protocol.PayloadMessa
 		return
 	}
 
-	responseChannel, _ := r.responseDispatcherRegistrar.GetDispatchChannel(inResponseTo)
+	if r.isJobStateTransition(responseMessage.InResponseTo, state) {
+		r.updateJobState(responseMessage.InResponseTo, state)
+	}
 
-	if responseChannel != nil {
-		logger.Info("Adding response message to response channel")
-		responseChannel <- responseMessage
+	if r.responseDispatcherRegistrar.Dispatch(inResponseTo, responseMessage) {
+		logger.Info("Added response message to response channel")
 		return
 	}
 
+	r.updateInFlightJob(responseMessage)
+
 	logger.Info("Dispatching response message")
 
+	r.writeResponse(logger, responseMessage)
+}
+
+// writeResponse writes the response to the responses topic and passes it to
+// the response aggregator
+func (r *ReceptorService) writeResponse(logger *logrus.Entry, responseMessage ResponseMessage) {
 	jsonResponseMessage, err := json.Marshal(responseMessage)
 	if err != nil {
 		logger.WithFields(logrus.Fields{"error": err}).Error("JSON marshal of ResponseMessage failed")
 		return
 	}
 
+	if r.responseAggregator != nil {
+		r.responseAggregator.AddResponse(responseMessage, len(jsonResponseMessage))
+	}
+
 	go func() {
 		metrics.responseKafkaWriterGoRoutineGauge.Inc()
 
@@ -280,9 +1100,9 @@ func (r *ReceptorService) DispatchResponse(payloadMessage *protocol.PayloadMessa
 		// If we pass the context from the transport to the kafka writer, then
 		// closing the websocket would cause the context to be canceled which
 		// could cause these messages to be lost.
-		err = r.kafkaWriter.WriteMessages(context.Background(),
+		err := r.kafkaWriter.WriteMessages(context.Background(),
 			kafka.Message{
-				Key:   []byte(payloadMessage.Data.InResponseTo),
+				Key:   []byte(responseMessage.InResponseTo),
 				Value: jsonResponseMessage,
 			})
 
@@ -298,7 +1118,6 @@ func (r *ReceptorService) DispatchResponse(payloadMessage *protocol.PayloadMessa
 
 		metrics.responseKafkaWriterGoRoutineGauge.Dec()
 	}()
-
 }
 
 func (r *ReceptorService) Close(ctx context.Context) error {
@@ -327,29 +1146,84 @@ func (r *ReceptorService) GetCapabilities(ctx context.Context) (interface{}, err
 	return capabilities, nil
 }
 
+// GetInFlightJobCount returns the number of jobs sent through this
+// connection that have not received their final response
+func (r *ReceptorService) GetInFlightJobCount(ctx context.Context) (int, error) {
+	r.inFlightJobsLock.Lock()
+	defer r.inFlightJobsLock.Unlock()
+
+	r.expireInFlightJobs(time.Now())
+
+	return len(r.inFlightJobs), nil
+}
+
+// GetStatus returns the capabilities of the peer along with the number of
+// jobs in flight
+func (r *ReceptorService) GetStatus(ctx context.Context) (*ConnectionStatus, error) {
+	capabilities, err := r.GetCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inFlightJobs, err := r.GetInFlightJobCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConnectionStatus{Capabilities: capabilities, InFlightJobs: inFlightJobs}, nil
+}
+
+// GetTopology returns a copy of the mesh that is reachable through this connection
+func (r *ReceptorService) GetTopology(ctx context.Context) (*mesh_router.Topology, error) {
+	topology := r.router.GetTopology()
+	return &topology, nil
+}
+
 type DispatcherTable struct {
-	dispatchTable map[uuid.UUID]chan ResponseMessage
+	dispatchTable map[uuid.UUID]*dispatcherEntry
 	sync.Mutex
 }
 
+type dispatcherEntry struct {
+	responseChannel chan ResponseMessage
+	unregistered    chan struct{}
+}
+
 func (dt *DispatcherTable) Register(msgID uuid.UUID, responseChannel chan ResponseMessage) {
 	dt.Lock()
-	dt.dispatchTable[msgID] = responseChannel
+	dt.dispatchTable[msgID] = &dispatcherEntry{
+		responseChannel: responseChannel,
+		unregistered:    make(chan struct{}),
+	}
 	dt.Unlock()
 }
 
 func (dt *DispatcherTable) Unregister(msgID uuid.UUID) {
 	dt.Lock()
-	delete(dt.dispatchTable, msgID)
+	entry, exists := dt.dispatchTable[msgID]
+	if exists {
+		close(entry.unregistered)
+		delete(dt.dispatchTable, msgID)
+	}
 	dt.Unlock()
 }
 
-func (dt *DispatcherTable) GetDispatchChannel(msgID uuid.UUID) (chan ResponseMessage, error) {
-	var dispatchChannel chan ResponseMessage
-
+// Dispatch passes the response to the channel registered for msgID.  false
+// is returned if there is no channel registered or if the channel was
+// unregistered before the response could be delivered.
+func (dt *DispatcherTable) Dispatch(msgID uuid.UUID, responseMessage ResponseMessage) bool {
 	dt.Lock()
-	dispatchChannel, _ = dt.dispatchTable[msgID]
+	entry, exists := dt.dispatchTable[msgID]
 	dt.Unlock()
 
-	return dispatchChannel, nil
+	if exists == false {
+		return false
+	}
+
+	select {
+	case entry.responseChannel <- responseMessage:
+		return true
+	case <-entry.unregistered:
+		return false
+	}
 }
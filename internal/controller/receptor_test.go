@@ -0,0 +1,785 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/protocol"
+
+	"github.com/google/uuid"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func newTestTransport() *Transport {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Transport{
+		Lanes: map[Lane]chan ReceptorMessage{
+			LaneControl:     make(chan ReceptorMessage, 1),
+			LaneInteractive: make(chan ReceptorMessage, 1),
+			LaneBulk:        make(chan ReceptorMessage, 1),
+		},
+		Ctx:    ctx,
+		Cancel: cancel,
+	}
+}
+
+func buildTestResponse(receptor *ReceptorService, inResponseTo string, messageType string, serial int) *protocol.PayloadMessage {
+	return &protocol.PayloadMessage{
+		RoutingInfo: &protocol.RoutingMessage{Sender: "node-a", Recipient: receptor.NodeID},
+		Data: protocol.InnerEnvelope{
+			MessageID:    "response",
+			InResponseTo: inResponseTo,
+			MessageType:  messageType,
+			Serial:       serial,
+		},
+	}
+}
+
+func TestSendMessageSyncCollectsResponses(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	go func() {
+		msg := <-transport.Lanes[LaneInteractive]
+		payloadMessage := msg.Message.(*protocol.PayloadMessage)
+		messageID := payloadMessage.Data.MessageID
+
+		receptor.DispatchResponse(buildTestResponse(receptor, messageID, "response", 2))
+		receptor.DispatchResponse(buildTestResponse(receptor, messageID, "response", 1))
+		receptor.DispatchResponse(buildTestResponse(receptor, messageID, ResponseMessageTypeEOF, 3))
+	}()
+
+	response, err := receptor.SendMessageSync(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if response.Status != ResponsesCompleted {
+		t.Fatalf("Status was incorrect, got: %s, want: %s", response.Status, ResponsesCompleted)
+	}
+
+	if len(response.Responses) != 3 {
+		t.Fatalf("Expected 3 responses, got: %v", response.Responses)
+	}
+
+	for i, r := range response.Responses {
+		if r.Serial != i+1 {
+			t.Fatalf("Responses were not ordered by serial: %v", response.Responses)
+		}
+	}
+
+	job, err := receptor.jobRegistry.Get(context.TODO(), response.MessageID.String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if job.State != JobStateCompleted {
+		t.Fatalf("Job state was incorrect, got: %s, want: %s", job.State, JobStateCompleted)
+	}
+}
+
+func TestSendMessageSyncTimesOut(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	go func() {
+		msg := <-transport.Lanes[LaneInteractive]
+		payloadMessage := msg.Message.(*protocol.PayloadMessage)
+		receptor.DispatchResponse(buildTestResponse(receptor, payloadMessage.Data.MessageID, "response", 1))
+	}()
+
+	response, err := receptor.SendMessageSync(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action", 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if response.Status != ResponsesTimedOut {
+		t.Fatalf("Status was incorrect, got: %s, want: %s", response.Status, ResponsesTimedOut)
+	}
+
+	if len(response.Responses) != 1 {
+		t.Fatalf("Expected 1 response, got: %v", response.Responses)
+	}
+}
+
+func TestSendMessageSyncConnectionLost(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	go func() {
+		<-transport.Lanes[LaneInteractive]
+		transport.Cancel()
+	}()
+
+	response, err := receptor.SendMessageSync(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if response.Status != ResponsesDisconnected {
+		t.Fatalf("Status was incorrect, got: %s, want: %s", response.Status, ResponsesDisconnected)
+	}
+}
+
+func TestSendMessageStreamDeliversResponses(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	go func() {
+		msg := <-transport.Lanes[LaneInteractive]
+		payloadMessage := msg.Message.(*protocol.PayloadMessage)
+		messageID := payloadMessage.Data.MessageID
+
+		receptor.DispatchResponse(buildTestResponse(receptor, messageID, "response", 1))
+		receptor.DispatchResponse(buildTestResponse(receptor, messageID, "response", 2))
+		receptor.DispatchResponse(buildTestResponse(receptor, messageID, ResponseMessageTypeEOF, 3))
+	}()
+
+	stream, err := receptor.SendMessageStream(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	serial := 1
+	for responseMsg := range stream.Responses() {
+		if responseMsg.Serial != serial {
+			t.Fatalf("Serial was incorrect, got: %d, want: %d", responseMsg.Serial, serial)
+		}
+		serial++
+	}
+
+	if stream.Status() != ResponsesCompleted {
+		t.Fatalf("Status was incorrect, got: %s, want: %s", stream.Status(), ResponsesCompleted)
+	}
+}
+
+func TestSendMessageStreamOverflow(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	receptor.config.BufferedChannelSize = 1
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	// The responses that arrive after the stream was dropped are written to kafka
+	receptor.kafkaWriter = &channelKafkaWriter{messages: make(chan kafka.Message, 10)}
+
+	dispatched := make(chan struct{})
+
+	go func() {
+		msg := <-transport.Lanes[LaneInteractive]
+		payloadMessage := msg.Message.(*protocol.PayloadMessage)
+		messageID := payloadMessage.Data.MessageID
+
+		// Nobody reads the stream while the responses are dispatched
+		receptor.DispatchResponse(buildTestResponse(receptor, messageID, "response", 1))
+		receptor.DispatchResponse(buildTestResponse(receptor, messageID, "response", 2))
+		receptor.DispatchResponse(buildTestResponse(receptor, messageID, ResponseMessageTypeEOF, 3))
+		close(dispatched)
+	}()
+
+	stream, err := receptor.SendMessageStream(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second):
+		t.Fatalf("Dispatching the responses was blocked by the stream's reader")
+	}
+
+	count := 0
+	for range stream.Responses() {
+		count++
+	}
+
+	if count != 1 {
+		t.Fatalf("Expected 1 response, got: %d", count)
+	}
+
+	if stream.Status() != ResponsesOverflowed {
+		t.Fatalf("Status was incorrect, got: %s, want: %s", stream.Status(), ResponsesOverflowed)
+	}
+}
+
+func TestSendMessageStreamConnectionLost(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	go func() {
+		msg := <-transport.Lanes[LaneInteractive]
+		payloadMessage := msg.Message.(*protocol.PayloadMessage)
+		receptor.DispatchResponse(buildTestResponse(receptor, payloadMessage.Data.MessageID, "response", 1))
+		transport.Cancel()
+	}()
+
+	stream, err := receptor.SendMessageStream(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	count := 0
+	for range stream.Responses() {
+		count++
+	}
+
+	if count != 1 {
+		t.Fatalf("Expected 1 response, got: %d", count)
+	}
+
+	if stream.Status() != ResponsesDisconnected {
+		t.Fatalf("Status was incorrect, got: %s, want: %s", stream.Status(), ResponsesDisconnected)
+	}
+}
+
+func TestSendMessageStreamSenderGoesAway(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stream, err := receptor.SendMessageStream(ctx, "0000001", "node-a", []string{"node-a"}, "payload", "worker:action")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	cancel()
+
+	for range stream.Responses() {
+	}
+
+	if stream.Status() != ResponsesCancelled {
+		t.Fatalf("Status was incorrect, got: %s, want: %s", stream.Status(), ResponsesCancelled)
+	}
+
+	// Responses that arrive after the sender went away must not block the dispatcher
+	msg := <-transport.Lanes[LaneInteractive]
+	payloadMessage := msg.Message.(*protocol.PayloadMessage)
+	inResponseTo, _ := uuid.Parse(payloadMessage.Data.MessageID)
+	if receptor.responseDispatcherRegistrar.Dispatch(inResponseTo, ResponseMessage{}) {
+		t.Fatalf("Expected the response not to be dispatched")
+	}
+}
+
+func TestFailInFlightJobs(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	w := &channelKafkaWriter{messages: make(chan kafka.Message, 10)}
+	receptor.kafkaWriter = w
+
+	completedJobID, _ := receptor.SendMessage(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action")
+	<-transport.Lanes[LaneInteractive]
+	inFlightJobID, _ := receptor.SendMessage(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action")
+	<-transport.Lanes[LaneInteractive]
+
+	receptor.DispatchResponse(buildTestResponse(receptor, completedJobID.String(), ResponseMessageTypeEOF, 1))
+	receptor.DispatchResponse(buildTestResponse(receptor, inFlightJobID.String(), "response", 1))
+
+	// Wait for the responses from the receptor node to be written
+	for i := 0; i < 2; i++ {
+		<-w.messages
+	}
+
+	receptor.FailInFlightJobs()
+
+	select {
+	case msg := <-w.messages:
+		var responseMessage ResponseMessage
+		json.Unmarshal(msg.Value, &responseMessage)
+
+		if responseMessage.InResponseTo != inFlightJobID.String() {
+			t.Fatalf("Expected a response to %s, got: %s", inFlightJobID, responseMessage.InResponseTo)
+		}
+
+		if responseMessage.MessageType != ResponseMessageTypeConnectionLost || responseMessage.Code != ResponseCodeConnectionLost {
+			t.Fatalf("Expected a connection lost response, got: %v", responseMessage)
+		}
+
+		if responseMessage.Serial != 2 {
+			t.Fatalf("Serial was incorrect, got: %d, want: %d", responseMessage.Serial, 2)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the connection lost response")
+	}
+
+	select {
+	case msg := <-w.messages:
+		t.Fatalf("Unexpected message: %s", msg.Value)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+type stateCountingJobRegistry struct {
+	JobRegistry
+	updates []string
+}
+
+func (r *stateCountingJobRegistry) UpdateState(ctx context.Context, messageID string, state string) error {
+	r.updates = append(r.updates, state)
+	return r.JobRegistry.UpdateState(ctx, messageID, state)
+}
+
+func TestDispatchResponseOnlyUpdatesJobStateOnTransitions(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	registry := &stateCountingJobRegistry{JobRegistry: receptor.jobRegistry}
+	receptor.jobRegistry = registry
+
+	w := &channelKafkaWriter{messages: make(chan kafka.Message, 10)}
+	receptor.kafkaWriter = w
+
+	jobID, _ := receptor.SendMessage(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action")
+	<-transport.Lanes[LaneInteractive]
+
+	for serial := 1; serial <= 3; serial++ {
+		receptor.DispatchResponse(buildTestResponse(receptor, jobID.String(), "response", serial))
+	}
+	receptor.DispatchResponse(buildTestResponse(receptor, jobID.String(), ResponseMessageTypeEOF, 4))
+
+	for i := 0; i < 4; i++ {
+		<-w.messages
+	}
+
+	expectedUpdates := []string{JobStateAcknowledged, JobStateCompleted}
+	if strings.Join(registry.updates, ",") != strings.Join(expectedUpdates, ",") {
+		t.Fatalf("Job state updates were incorrect, got: %v, want: %v", registry.updates, expectedUpdates)
+	}
+
+	verifyJobState(t, registry, jobID.String(), JobStateCompleted)
+
+	if len(receptor.acknowledgedJobs) != 0 {
+		t.Fatalf("Expected the completed job to be forgotten, got: %v", receptor.acknowledgedJobs)
+	}
+}
+
+func TestDispatchResponseAttachesSchemaViolations(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	receptor.directiveSchemas = NewDirectiveSchemaRegistry()
+	receptor.directiveSchemas.Register(DirectiveSchema{
+		Directive: "worker:action",
+		Response:  json.RawMessage(`{"type": "object", "required": ["status"]}`),
+	})
+
+	go func() {
+		msg := <-transport.Lanes[LaneInteractive]
+		messageID := msg.Message.(*protocol.PayloadMessage).Data.MessageID
+
+		invalidResponse := buildTestResponse(receptor, messageID, "response", 1)
+		invalidResponse.Data.RawPayload = map[string]interface{}{}
+		receptor.DispatchResponse(invalidResponse)
+
+		validResponse := buildTestResponse(receptor, messageID, "response", 2)
+		validResponse.Data.RawPayload = map[string]interface{}{"status": "ok"}
+		receptor.DispatchResponse(validResponse)
+
+		receptor.DispatchResponse(buildTestResponse(receptor, messageID, ResponseMessageTypeEOF, 3))
+	}()
+
+	response, err := receptor.SendMessageSync(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(response.Responses) != 3 {
+		t.Fatalf("Expected 3 responses, got: %v", response.Responses)
+	}
+
+	if len(response.Responses[0].SchemaViolations) != 1 {
+		t.Fatalf("Expected the invalid response to carry its violation, got: %v", response.Responses[0].SchemaViolations)
+	}
+
+	if len(response.Responses[1].SchemaViolations) != 0 {
+		t.Fatalf("Expected no violations for the valid response, got: %v", response.Responses[1].SchemaViolations)
+	}
+
+	if _, sent := receptor.getSentJobDirective(response.MessageID.String(), JobStateAcknowledged); sent {
+		t.Fatalf("Expected the job to be forgotten once its final response was received")
+	}
+}
+
+func TestDeliverQueuedJobs(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	w := &channelKafkaWriter{messages: make(chan kafka.Message, 10)}
+	receptor.kafkaWriter = w
+
+	queuedJobs := []QueuedJob{
+		newTestQueuedJob(uuid.New().String(), time.Minute),
+		newTestQueuedJob(uuid.New().String(), -time.Minute),
+		newTestQueuedJob(uuid.New().String(), time.Minute),
+	}
+
+	for _, queuedJob := range queuedJobs {
+		receptor.jobQueue.Enqueue(context.TODO(), queuedJob)
+		receptor.jobRegistry.Register(context.TODO(), queuedJob.JobRecord())
+	}
+
+	go receptor.DeliverQueuedJobs(context.TODO())
+
+	for _, i := range []int{0, 2} {
+		msg := <-transport.Lanes[LaneInteractive]
+		payloadMessage := msg.Message.(*protocol.PayloadMessage)
+		if payloadMessage.Data.MessageID != queuedJobs[i].MessageID {
+			t.Fatalf("Delivered job was incorrect, got: %s, want: %s", payloadMessage.Data.MessageID, queuedJobs[i].MessageID)
+		}
+	}
+
+	select {
+	case msg := <-w.messages:
+		var responseMessage ResponseMessage
+		json.Unmarshal(msg.Value, &responseMessage)
+
+		if responseMessage.InResponseTo != queuedJobs[1].MessageID || responseMessage.MessageType != ResponseMessageTypeExpired {
+			t.Fatalf("Expected an expired response to %s, got: %v", queuedJobs[1].MessageID, responseMessage)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the expired response")
+	}
+
+	verifyJobState(t, receptor.jobRegistry, queuedJobs[0].MessageID, JobStateSent)
+	verifyJobState(t, receptor.jobRegistry, queuedJobs[1].MessageID, JobStateTimedOut)
+}
+
+func TestDeliverQueuedJobsToReachableNodes(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	queuedJob := newTestQueuedJob(uuid.New().String(), time.Minute)
+	queuedJob.Recipient = "node-c"
+	receptor.jobQueue.Enqueue(context.TODO(), queuedJob)
+	receptor.jobRegistry.Register(context.TODO(), queuedJob.JobRecord())
+
+	handler := RouteTableHandler{Receptor: receptor, Transport: transport, Logger: receptor.logger}
+
+	// The job is delivered once a topology update makes node-c reachable
+	handler.HandleMessage(context.TODO(), &protocol.RouteTableMessage{
+		Command: "ROUTE",
+		ID:      "node-a",
+		Edges: [][]interface{}{
+			{"node-cloud-receptor-controller", "node-a", float64(1)},
+			{"node-a", "node-b", float64(1)},
+			{"node-b", "node-c", float64(1)},
+		},
+		Seen: []string{"node-a", "node-b", "node-c"},
+	})
+
+	select {
+	case msg := <-transport.Lanes[LaneInteractive]:
+		payloadMessage := msg.Message.(*protocol.PayloadMessage)
+		if payloadMessage.Data.MessageID != queuedJob.MessageID {
+			t.Fatalf("Delivered job was incorrect, got: %s, want: %s", payloadMessage.Data.MessageID, queuedJob.MessageID)
+		}
+
+		expectedRoute := []string{"node-a", "node-b", "node-c"}
+		if strings.Join(payloadMessage.RoutingInfo.RouteList, ",") != strings.Join(expectedRoute, ",") {
+			t.Fatalf("Route was incorrect, got: %v, want: %v", payloadMessage.RoutingInfo.RouteList, expectedRoute)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the queued job")
+	}
+}
+
+func TestCancelMessageSync(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	cancelErr := make(chan error, 1)
+
+	go func() {
+		msg := <-transport.Lanes[LaneInteractive]
+		payloadMessage := msg.Message.(*protocol.PayloadMessage)
+		jobID, _ := uuid.Parse(payloadMessage.Data.MessageID)
+
+		receptor.DispatchResponse(buildTestResponse(receptor, jobID.String(), "response", 1))
+
+		cancelErr <- receptor.CancelMessage(context.TODO(), "0000001", "node-a", jobID)
+	}()
+
+	response, err := receptor.SendMessageSync(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if response.Status != ResponsesCancelled {
+		t.Fatalf("Status was incorrect, got: %s, want: %s", response.Status, ResponsesCancelled)
+	}
+
+	if len(response.Responses) != 2 || response.Responses[1].MessageType != ResponseMessageTypeCancelled {
+		t.Fatalf("Expected a response followed by a cancelled response, got: %v", response.Responses)
+	}
+
+	if err := <-cancelErr; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	msg := <-transport.Lanes[LaneControl]
+	cancelMessage := msg.Message.(*protocol.PayloadMessage)
+	if cancelMessage.Data.Directive != CancelDirective || cancelMessage.Data.InResponseTo != response.MessageID.String() {
+		t.Fatalf("Expected a cancel message for %s, got: %v", response.MessageID, cancelMessage.Data)
+	}
+
+	verifyJobState(t, receptor.jobRegistry, response.MessageID.String(), JobStateCancelled)
+}
+
+func TestCancelMessageInFlight(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	w := &channelKafkaWriter{messages: make(chan kafka.Message, 10)}
+	receptor.kafkaWriter = w
+
+	jobID, _ := receptor.SendMessage(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action")
+	<-transport.Lanes[LaneInteractive]
+
+	receptor.DispatchResponse(buildTestResponse(receptor, jobID.String(), "response", 1))
+	<-w.messages
+
+	if err := receptor.CancelMessage(context.TODO(), "0000001", "node-a", *jobID); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	msg := <-transport.Lanes[LaneControl]
+	cancelMessage := msg.Message.(*protocol.PayloadMessage)
+	if cancelMessage.Data.Directive != CancelDirective || cancelMessage.Data.InResponseTo != jobID.String() {
+		t.Fatalf("Expected a cancel message for %s, got: %v", jobID, cancelMessage.Data)
+	}
+
+	select {
+	case msg := <-w.messages:
+		var responseMessage ResponseMessage
+		json.Unmarshal(msg.Value, &responseMessage)
+
+		if responseMessage.InResponseTo != jobID.String() || responseMessage.MessageType != ResponseMessageTypeCancelled {
+			t.Fatalf("Expected a cancelled response to %s, got: %v", jobID, responseMessage)
+		}
+
+		if responseMessage.Serial != 2 {
+			t.Fatalf("Serial was incorrect, got: %d, want: %d", responseMessage.Serial, 2)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the cancelled response")
+	}
+
+	verifyJobState(t, receptor.jobRegistry, jobID.String(), JobStateCancelled)
+
+	// The job is no longer in flight once it has been cancelled
+	receptor.FailInFlightJobs()
+
+	select {
+	case msg := <-w.messages:
+		t.Fatalf("Unexpected message: %s", msg.Value)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDeliverQueuedJobsSkipsCancelledJobs(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	queuedJobs := []QueuedJob{
+		newTestQueuedJob(uuid.New().String(), time.Minute),
+		newTestQueuedJob(uuid.New().String(), time.Minute),
+	}
+
+	for _, queuedJob := range queuedJobs {
+		receptor.jobQueue.Enqueue(context.TODO(), queuedJob)
+		receptor.jobRegistry.Register(context.TODO(), queuedJob.JobRecord())
+	}
+
+	receptor.jobRegistry.UpdateState(context.TODO(), queuedJobs[0].MessageID, JobStateCancelled)
+
+	go receptor.DeliverQueuedJobs(context.TODO())
+
+	msg := <-transport.Lanes[LaneInteractive]
+	payloadMessage := msg.Message.(*protocol.PayloadMessage)
+	if payloadMessage.Data.MessageID != queuedJobs[1].MessageID {
+		t.Fatalf("Delivered job was incorrect, got: %s, want: %s", payloadMessage.Data.MessageID, queuedJobs[1].MessageID)
+	}
+
+	verifyJobState(t, receptor.jobRegistry, queuedJobs[0].MessageID, JobStateCancelled)
+}
+
+func TestInFlightJobsExpire(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	w := &channelKafkaWriter{messages: make(chan kafka.Message, 10)}
+	receptor.kafkaWriter = w
+
+	expiredJobID, _ := receptor.SendMessage(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action")
+	<-transport.Lanes[LaneInteractive]
+
+	// Pretend that the job was sent, and the jobs were last swept, before
+	// the job timeout
+	sentAt := time.Now().Add(-2 * receptor.config.JobRegistryJobTimeout)
+	receptor.inFlightJobsLock.Lock()
+	receptor.inFlightJobs[expiredJobID.String()] = inFlightJob{sentAt: sentAt}
+	receptor.inFlightJobsSwept = sentAt
+	receptor.inFlightJobsLock.Unlock()
+
+	inFlightJobID, _ := receptor.SendMessage(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action")
+	<-transport.Lanes[LaneInteractive]
+
+	if count, _ := receptor.GetInFlightJobCount(context.TODO()); count != 1 {
+		t.Fatalf("Expected 1 job in flight, got: %d", count)
+	}
+
+	receptor.FailInFlightJobs()
+
+	select {
+	case msg := <-w.messages:
+		var responseMessage ResponseMessage
+		json.Unmarshal(msg.Value, &responseMessage)
+
+		if responseMessage.InResponseTo != inFlightJobID.String() {
+			t.Fatalf("Expected a response to %s, got: %s", inFlightJobID, responseMessage.InResponseTo)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the connection lost response")
+	}
+
+	select {
+	case msg := <-w.messages:
+		t.Fatalf("Unexpected message: %s", msg.Value)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSendMessageConnectionOverloaded(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	receptor.config.ReceptorMaxSendWait = 50 * time.Millisecond
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	// Fill up the interactive lane
+	transport.Lanes[LaneInteractive] <- ReceptorMessage{}
+
+	_, err := receptor.SendMessage(context.TODO(), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action")
+
+	overloadedErr, ok := err.(*ConnectionOverloadedError)
+	if !ok {
+		t.Fatalf("Expected a ConnectionOverloadedError, got: %v", err)
+	}
+
+	if overloadedErr.Lane != LaneInteractive || overloadedErr.QueueDepth != 1 || overloadedErr.QueueCapacity != 1 {
+		t.Fatalf("Overloaded error was incorrect, got: %+v", overloadedErr)
+	}
+
+	if count, _ := receptor.GetInFlightJobCount(context.TODO()); count != 0 {
+		t.Fatalf("Expected no jobs in flight, got: %d", count)
+	}
+}
+
+func TestSendMessageWaitsForRoomOnTheLane(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	receptor.config.ReceptorMaxSendWait = time.Second
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	transport.Lanes[LaneBulk] <- ReceptorMessage{}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-transport.Lanes[LaneBulk]
+	}()
+
+	_, err := receptor.SendMessage(WithLane(context.TODO(), LaneBulk), "0000001", "node-a", []string{"node-a"}, "payload", "worker:action")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+}
+
+func TestSendMessageSyncChunksLargePayloads(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	receptor.config.PayloadChunkSize = 1024
+	receptor.Chunking = true
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	largePayload := strings.Repeat("x", 5000)
+
+	go func() {
+		// Pass the chunks through the wire format and send them back as
+		// the response
+		for {
+			msg := <-transport.Lanes[LaneInteractive]
+
+			var buf bytes.Buffer
+			protocol.WriteMessage(&buf, msg.Message)
+			message, _ := protocol.ReadMessage(&buf)
+			chunk := message.(*protocol.PayloadMessage)
+
+			response := buildTestResponse(receptor, chunk.Data.MessageID, ResponseMessageTypeEOF, 1)
+			response.Data.RawPayload = chunk.Data.RawPayload
+			response.Data.Chunk = chunk.Data.Chunk
+			receptor.DispatchResponse(response)
+
+			if chunk.Data.Chunk.Index == chunk.Data.Chunk.Count-1 {
+				return
+			}
+		}
+	}()
+
+	response, err := receptor.SendMessageSync(context.TODO(), "0000001", "node-a", []string{"node-a"}, largePayload, "worker:action", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if response.Status != ResponsesCompleted {
+		t.Fatalf("Status was incorrect, got: %s, want: %s", response.Status, ResponsesCompleted)
+	}
+
+	if len(response.Responses) != 1 || response.Responses[0].Payload != largePayload {
+		t.Fatalf("Expected the reassembled payload in a single response, got %d responses", len(response.Responses))
+	}
+}
+
+func TestSendMessageDoesNotChunkForPeersWithoutChunking(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+	receptor.config.PayloadChunkSize = 1024
+	transport := newTestTransport()
+	receptor.Transport = transport
+
+	largePayload := strings.Repeat("x", 5000)
+
+	_, err := receptor.SendMessage(context.TODO(), "0000001", "node-a", []string{"node-a"}, largePayload, "worker:action")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	msg := <-transport.Lanes[LaneInteractive]
+	payloadMessage := msg.Message.(*protocol.PayloadMessage)
+
+	if payloadMessage.Data.Chunk != nil || payloadMessage.Data.RawPayload != largePayload {
+		t.Fatalf("Expected the payload to be sent in one piece, got chunk: %+v", payloadMessage.Data.Chunk)
+	}
+
+	select {
+	case msg := <-transport.Lanes[LaneInteractive]:
+		t.Fatalf("Unexpected message: %+v", msg.Message)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+)
+
+// RedisJobDeduplicator stores the idempotency keys in redis next to the
+// connection registry so that the keys are shared by all of the job receiver
+// replicas
+type RedisJobDeduplicator struct {
+	client *redis.Client
+	window time.Duration
+}
+
+func NewRedisJobDeduplicator(client *redis.Client, cfg *config.Config) *RedisJobDeduplicator {
+	return &RedisJobDeduplicator{
+		client: client,
+		window: cfg.JobIdempotencyWindow,
+	}
+}
+
+func (d *RedisJobDeduplicator) Reserve(ctx context.Context, account string, key string, messageID string) (string, bool, error) {
+	logger := logger.Log.WithFields(logrus.Fields{"account": account, "idempotency_key": key})
+
+	idempotencyKey := getIdempotencyKey(account, key)
+
+	for {
+		reserved, err := d.client.SetNX(idempotencyKey, messageID, d.window).Result()
+		if err != nil {
+			logRedisError(logger, err)
+			return "", false, err
+		}
+
+		if reserved {
+			return messageID, true, nil
+		}
+
+		existingMessageID, err := d.client.Get(idempotencyKey).Result()
+		if err == redis.Nil {
+			// The key expired or was released in the meantime
+			continue
+		} else if err != nil {
+			logRedisError(logger, err)
+			return "", false, err
+		}
+
+		return existingMessageID, false, nil
+	}
+}
+
+func (d *RedisJobDeduplicator) Release(ctx context.Context, account string, key string, messageID string) error {
+	logger := logger.Log.WithFields(logrus.Fields{"account": account, "idempotency_key": key})
+
+	idempotencyKey := getIdempotencyKey(account, key)
+
+	err := d.client.Watch(func(tx *redis.Tx) error {
+		existingMessageID, err := tx.Get(idempotencyKey).Result()
+		if err == redis.Nil {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// The key was reserved again by another submission
+		if existingMessageID != messageID {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.Del(idempotencyKey)
+			return nil
+		})
+
+		return err
+	}, idempotencyKey)
+
+	if err != nil {
+		logRedisError(logger, err)
+	}
+
+	return err
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+)
+
+func getQueuedJobsKey(account, nodeID string) string {
+	return "queued-jobs:" + account + ":" + nodeID
+}
+
+// RedisJobQueue stores the queued jobs for each node in a redis list so that
+// jobs submitted to the job receiver can be delivered by any gateway pod
+type RedisJobQueue struct {
+	client *redis.Client
+	maxTTL time.Duration
+}
+
+func NewRedisJobQueue(client *redis.Client, cfg *config.Config) *RedisJobQueue {
+	return &RedisJobQueue{
+		client: client,
+		maxTTL: cfg.JobQueueMaxTTL,
+	}
+}
+
+func (q *RedisJobQueue) Enqueue(ctx context.Context, job QueuedJob) error {
+	return q.push(job, func(pipe redis.Pipeliner, key string, value []byte) {
+		pipe.RPush(key, value)
+	})
+}
+
+func (q *RedisJobQueue) Requeue(ctx context.Context, job QueuedJob) error {
+	return q.push(job, func(pipe redis.Pipeliner, key string, value []byte) {
+		pipe.LPush(key, value)
+	})
+}
+
+func (q *RedisJobQueue) push(job QueuedJob, pushFunc func(redis.Pipeliner, string, []byte)) error {
+	logger := logger.Log.WithFields(logrus.Fields{"account": job.Account, "nodeID": job.Recipient, "message_id": job.MessageID})
+
+	jobJSON, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	queueKey := getQueuedJobsKey(job.Account, job.Recipient)
+
+	_, err = q.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pushFunc(pipe, queueKey, jobJSON)
+		// No job in the queue can outlive the max ttl.  The registry
+		// reports the jobs that are dropped with the queue as timed out.
+		pipe.Expire(queueKey, q.maxTTL)
+		return nil
+	})
+
+	if err != nil {
+		logRedisError(logger, err)
+		return err
+	}
+
+	return nil
+}
+
+func (q *RedisJobQueue) Dequeue(ctx context.Context, account string, nodeID string) (*QueuedJob, error) {
+	logger := logger.Log.WithFields(logrus.Fields{"account": account, "nodeID": nodeID})
+
+	jobJSON, err := q.client.LPop(getQueuedJobsKey(account, nodeID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		logRedisError(logger, err)
+		return nil, err
+	}
+
+	var job QueuedJob
+	if err = json.Unmarshal(jobJSON, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// takeTokensScript refills each bucket based on the time since it was last
+// updated and then takes a token from every bucket, but only if every bucket
+// has a token.  The buckets are checked and updated in a single script so
+// that the job receiver replicas cannot race each other.
+//
+// The time is read from the redis server so that the buckets do not depend
+// on the clocks of the job receiver replicas agreeing with each other.
+//
+// KEYS are the buckets.  ARGV[1] overrides the current time in milliseconds
+// when it is not empty (only the tests set it).  It is followed by the rate
+// (tokens per second) and burst of each bucket.  The script returns 1 if the
+// tokens were taken.  Otherwise, it returns 0, the index of an empty bucket
+// and the number of milliseconds until that bucket has a token.
+var takeTokensScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+if now == nil then
+	-- TIME is not deterministic, so the script's writes must be replicated
+	-- instead of the script itself
+	redis.replicate_commands()
+	local time = redis.call("TIME")
+	now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+end
+
+local tokens = {}
+local wait = 0
+local limited = 0
+
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2])
+	local burst = tonumber(ARGV[i * 2 + 1])
+
+	local bucket = redis.call("HMGET", key, "tokens", "updated_at")
+	local available = tonumber(bucket[1])
+	local updatedAt = tonumber(bucket[2])
+	if available == nil or updatedAt == nil then
+		available = burst
+		updatedAt = now
+	end
+
+	available = math.min(burst, available + math.max(0, now - updatedAt) * rate / 1000)
+	tokens[i] = available
+
+	if available < 1 then
+		local bucketWait = math.ceil((1 - available) * 1000 / rate)
+		if bucketWait > wait then
+			wait = bucketWait
+			limited = i
+		end
+	end
+end
+
+if limited > 0 then
+	return {0, limited, wait}
+end
+
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2])
+	local burst = tonumber(ARGV[i * 2 + 1])
+
+	redis.call("HMSET", key, "tokens", tostring(tokens[i] - 1), "updated_at", now)
+	-- The bucket would be full by the time that it expires
+	redis.call("PEXPIRE", key, math.ceil(burst * 1000 / rate) + 1000)
+end
+
+return {1, 0, 0}
+`)
+
+// RedisJobRateLimiter stores the token buckets in redis so that the limits
+// are shared by all of the job receiver replicas
+type RedisJobRateLimiter struct {
+	client *redis.Client
+
+	// now overrides the redis server's clock.  It is only set by the tests.
+	now func() time.Time
+}
+
+func NewRedisJobRateLimiter(client *redis.Client) *RedisJobRateLimiter {
+	return &RedisJobRateLimiter{
+		client: client,
+	}
+}
+
+func (l *RedisJobRateLimiter) Take(ctx context.Context, limits []RateLimit) (bool, string, time.Duration, error) {
+	if len(limits) == 0 {
+		return true, "", 0, nil
+	}
+
+	keys := make([]string, len(limits))
+	var now interface{} = ""
+	if l.now != nil {
+		now = l.now().UnixNano() / int64(time.Millisecond)
+	}
+
+	args := []interface{}{now}
+	for i, limit := range limits {
+		keys[i] = limit.Key
+		args = append(args, limit.Rate, limit.Burst)
+	}
+
+	result, err := takeTokensScript.Run(l.client, keys, args...).Result()
+	if err != nil {
+		logRedisError(logger.Log.WithFields(logrus.Fields{"rate_limits": keys}), err)
+		return false, "", 0, err
+	}
+
+	values := result.([]interface{})
+	if values[0].(int64) == 1 {
+		return true, "", 0, nil
+	}
+
+	limit := limits[values[1].(int64)-1]
+	wait := time.Duration(values[2].(int64)) * time.Millisecond
+
+	metrics.jobRateLimitedCounter.With(prometheus.Labels{"limit": limit.Scope}).Inc()
+
+	return false, limit.Scope, wait, nil
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+
+	"github.com/alicebob/miniredis"
+)
+
+func newTestJobRateLimiter(t *testing.T) (*RedisJobRateLimiter, *time.Time) {
+	s, _ := miniredis.Run()
+	t.Cleanup(s.Close)
+
+	now := time.Now()
+
+	limiter := NewRedisJobRateLimiter(newTestRedisClient(s.Addr()))
+	limiter.now = func() time.Time { return now }
+
+	return limiter, &now
+}
+
+func verifyTake(t *testing.T, limiter JobRateLimiter, limits []RateLimit, expectedAllowed bool, expectedScope string) time.Duration {
+	allowed, scope, wait, err := limiter.Take(context.TODO(), limits)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if allowed != expectedAllowed || scope != expectedScope {
+		t.Fatalf("expected (%t, %s), got (%t, %s)", expectedAllowed, expectedScope, allowed, scope)
+	}
+
+	return wait
+}
+
+func TestRedisJobRateLimiterBurst(t *testing.T) {
+	limiter, now := newTestJobRateLimiter(t)
+
+	limits := []RateLimit{{Scope: RateLimitNode, Key: "rate-limit:node:0000001:node-a", Rate: 1, Burst: 2}}
+
+	verifyTake(t, limiter, limits, true, "")
+	verifyTake(t, limiter, limits, true, "")
+
+	wait := verifyTake(t, limiter, limits, false, RateLimitNode)
+	if wait != time.Second {
+		t.Fatalf("Wait was incorrect, got: %s, want: %s", wait, time.Second)
+	}
+
+	*now = now.Add(time.Second)
+
+	verifyTake(t, limiter, limits, true, "")
+	verifyTake(t, limiter, limits, false, RateLimitNode)
+}
+
+func TestRedisJobRateLimiterUsesRedisTime(t *testing.T) {
+	s, _ := miniredis.Run()
+	t.Cleanup(s.Close)
+
+	now := time.Now()
+	s.SetTime(now)
+
+	limiter := NewRedisJobRateLimiter(newTestRedisClient(s.Addr()))
+	limits := []RateLimit{{Key: "rate:account:0000001", Scope: "account", Rate: 1, Burst: 1}}
+
+	verifyTake(t, limiter, limits, true, "")
+	verifyTake(t, limiter, limits, false, "account")
+
+	// The bucket is refilled once the redis server's clock moves on
+	s.SetTime(now.Add(time.Second))
+
+	verifyTake(t, limiter, limits, true, "")
+}
+
+func TestRedisJobRateLimiterTakesFromAllBuckets(t *testing.T) {
+	limiter, _ := newTestJobRateLimiter(t)
+
+	account := RateLimit{Scope: RateLimitAccount, Key: "rate-limit:account:0000001", Rate: 1, Burst: 2}
+	nodeA := RateLimit{Scope: RateLimitNode, Key: "rate-limit:node:0000001:node-a", Rate: 1, Burst: 1}
+	nodeB := RateLimit{Scope: RateLimitNode, Key: "rate-limit:node:0000001:node-b", Rate: 1, Burst: 1}
+
+	verifyTake(t, limiter, []RateLimit{account, nodeA}, true, "")
+
+	// A rejected submission does not take a token from the account
+	verifyTake(t, limiter, []RateLimit{account, nodeA}, false, RateLimitNode)
+
+	verifyTake(t, limiter, []RateLimit{account, nodeB}, true, "")
+	verifyTake(t, limiter, []RateLimit{account}, false, RateLimitAccount)
+}
+
+func TestJobRateLimits(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.JobAccountRateLimit = 10
+	cfg.JobNodeRateLimit = 0
+	cfg.JobClientRateLimit = 5
+
+	limits := JobRateLimits(cfg, "0000001", "node-a", "")
+	if len(limits) != 1 || limits[0].Scope != RateLimitAccount {
+		t.Fatalf("Expected only the account limit, got: %v", limits)
+	}
+
+	limits = JobRateLimits(cfg, "0000001", "node-a", "client-a")
+	if len(limits) != 2 || limits[1].Scope != RateLimitClient || limits[1].Key != "rate-limit:client:client-a" {
+		t.Fatalf("Expected the account and client limits, got: %v", limits)
+	}
+}
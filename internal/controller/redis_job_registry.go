@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+)
+
+func getJobKey(messageID string) string {
+	return "job:" + messageID
+}
+
+// getInFlightJobsKey returns the key of the set of jobs that were sent
+// through the connection and have not reached a terminal state
+func getInFlightJobsKey(account, nodeID, connectionID string) string {
+	return "jobs:" + getJobConnectionKey(account, nodeID, connectionID)
+}
+
+// redisJob is the json that is stored for a job.  The connection id is kept
+// out of the job's json so that it is not returned from the job api.
+type redisJob struct {
+	Job
+	ConnectionID string `json:"connection_id,omitempty"`
+}
+
+// RedisJobRegistry tracks jobs in redis so that the job state can be read
+// from any gateway or job receiver pod
+type RedisJobRegistry struct {
+	client     *redis.Client
+	ttl        time.Duration
+	jobTimeout time.Duration
+}
+
+func NewRedisJobRegistry(client *redis.Client, cfg *config.Config) *RedisJobRegistry {
+	return &RedisJobRegistry{
+		client:     client,
+		ttl:        cfg.JobRegistryTTL,
+		jobTimeout: cfg.JobRegistryJobTimeout,
+	}
+}
+
+func (r *RedisJobRegistry) Register(ctx context.Context, job Job) error {
+	logger := logger.Log.WithFields(logrus.Fields{"account": job.Account, "message_id": job.MessageID})
+
+	jobJSON, err := marshalJob(&job)
+	if err != nil {
+		return err
+	}
+
+	jobKey := getJobKey(job.MessageID)
+	inFlightJobsKey := getInFlightJobsKey(job.Account, job.NodeID, job.ConnectionID)
+
+	err = r.client.Watch(func(tx *redis.Tx) error {
+		existingJob, err := getJob(tx, jobKey)
+		if err == nil && existingJob.Finished() {
+			return ErrJobFinished
+		} else if err != nil && err != ErrJobNotFound {
+			return err
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			if existingJob != nil && existingJob.sentOnConnection() {
+				pipe.SRem(getInFlightJobsKey(existingJob.Account, existingJob.NodeID, existingJob.ConnectionID), job.MessageID)
+			}
+
+			pipe.Set(jobKey, jobJSON, job.retention(r.ttl, time.Now().UTC()))
+			if job.sentOnConnection() {
+				pipe.SAdd(inFlightJobsKey, job.MessageID)
+				pipe.Expire(inFlightJobsKey, r.ttl)
+			}
+			return nil
+		})
+
+		return err
+	}, jobKey)
+
+	if err != nil && err != ErrJobFinished {
+		logRedisError(logger, err)
+	}
+
+	return err
+}
+
+func (r *RedisJobRegistry) UpdateState(ctx context.Context, messageID string, state string) error {
+	logger := logger.Log.WithFields(logrus.Fields{"message_id": messageID})
+
+	jobKey := getJobKey(messageID)
+
+	err := r.client.Watch(func(tx *redis.Tx) error {
+		job, err := getJob(tx, jobKey)
+		if err != nil {
+			return err
+		}
+
+		if job.applyTransition(state, time.Now().UTC()) == false {
+			return nil
+		}
+
+		jobJSON, err := marshalJob(job)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(jobKey, jobJSON, r.ttl)
+			if isTerminalJobState(job.State) {
+				pipe.SRem(getInFlightJobsKey(job.Account, job.NodeID, job.ConnectionID), job.MessageID)
+			}
+			return nil
+		})
+
+		return err
+	}, jobKey)
+
+	if err != nil && err != ErrJobNotFound {
+		logRedisError(logger, err)
+	}
+
+	return err
+}
+
+func (r *RedisJobRegistry) Get(ctx context.Context, messageID string) (*Job, error) {
+	logger := logger.Log.WithFields(logrus.Fields{"message_id": messageID})
+
+	job, err := getJob(r.client, getJobKey(messageID))
+	if err != nil {
+		if err != ErrJobNotFound {
+			logRedisError(logger, err)
+		}
+		return nil, err
+	}
+
+	job.applyTimeout(r.jobTimeout, time.Now().UTC())
+
+	return job, nil
+}
+
+// MarkConnectionLost only sweeps the jobs that were sent on the connection.
+// The node may already have reconnected, possibly to another gateway pod, and
+// the jobs sent on the new connection are left alone.
+func (r *RedisJobRegistry) MarkConnectionLost(ctx context.Context, account string, nodeID string, connectionID string) error {
+	logger := logger.Log.WithFields(logrus.Fields{"account": account, "nodeID": nodeID})
+
+	inFlightJobsKey := getInFlightJobsKey(account, nodeID, connectionID)
+
+	inFlightJobs, err := r.client.SMembers(inFlightJobsKey).Result()
+	if err != nil {
+		logRedisError(logger, err)
+		return err
+	}
+
+	for _, messageID := range inFlightJobs {
+		err = r.UpdateState(ctx, messageID, JobStateLost)
+		if err != nil && err != ErrJobNotFound {
+			return err
+		}
+	}
+
+	return r.client.Del(inFlightJobsKey).Err()
+}
+
+func marshalJob(job *Job) ([]byte, error) {
+	return json.Marshal(redisJob{Job: *job, ConnectionID: job.ConnectionID})
+}
+
+func getJob(client redis.Cmdable, jobKey string) (*Job, error) {
+	jobJSON, err := client.Get(jobKey).Bytes()
+	if err == redis.Nil {
+		return nil, ErrJobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var storedJob redisJob
+	if err = json.Unmarshal(jobJSON, &storedJob); err != nil {
+		return nil, err
+	}
+
+	job := storedJob.Job
+	job.ConnectionID = storedJob.ConnectionID
+
+	return &job, nil
+}
@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+// AggregatedResponseMessage is the consolidated record that is produced once
+// all of the responses to a message have been received
+type AggregatedResponseMessage struct {
+	AccountNumber string            `json:"account"`
+	Sender        string            `json:"sender"`
+	InResponseTo  string            `json:"in_response_to"`
+	Status        string            `json:"status"`
+	Responses     []ResponseMessage `json:"responses"`
+}
+
+type kafkaMessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// ResponseAggregator buffers the responses to a message until the final (eof)
+// response is received.  The responses are then ordered by serial and written
+// to kafka as a single AggregatedResponseMessage.
+//
+// The size of the aggregated response for each message is limited to maxBytes,
+// which is never larger than the largest message the kafka broker accepts.  If
+// adding a response would exceed the limit, the responses that have been
+// buffered for that message are written with a memory_limit_exceeded status.
+// Responses that do not complete within the timeout are written with a
+// timed_out status.  Any responses to that message that arrive within the
+// timeout after it has been written are not aggregated.
+//
+// The responses buffered for all of the messages are limited to
+// maxBufferedBytes.  If buffering a response would exceed that limit, the
+// largest aggregates are written early with a memory_limit_exceeded status
+// until the response fits.
+type ResponseAggregator struct {
+	writer           kafkaMessageWriter
+	maxBytes         int
+	maxBufferedBytes int
+	timeout          time.Duration
+	aggregates       map[string]*responseAggregate
+	flushed          map[string]*time.Timer
+	bufferedBytes    int
+	sync.Mutex
+}
+
+type responseAggregate struct {
+	accountNumber string
+	sender        string
+	inResponseTo  string
+	responses     []ResponseMessage
+	size          int
+	overhead      int
+	timer         *time.Timer
+}
+
+func NewResponseAggregator(w kafkaMessageWriter, cfg *config.Config) *ResponseAggregator {
+	maxBytes := cfg.ResponseAggregationMaxBytes
+	if cfg.KafkaMaxMessageBytes < maxBytes {
+		maxBytes = cfg.KafkaMaxMessageBytes
+	}
+
+	return &ResponseAggregator{
+		writer:           w,
+		maxBytes:         maxBytes,
+		maxBufferedBytes: cfg.ResponseAggregationMaxBufferedBytes,
+		timeout:          cfg.ResponseAggregationTimeout,
+		aggregates:       make(map[string]*responseAggregate),
+		flushed:          make(map[string]*time.Timer),
+	}
+}
+
+// AddResponse buffers a response.  size is the size of the encoded response.
+func (ra *ResponseAggregator) AddResponse(responseMessage ResponseMessage, size int) {
+	ra.Lock()
+	defer ra.Unlock()
+
+	inResponseTo := responseMessage.InResponseTo
+
+	if _, exists := ra.flushed[inResponseTo]; exists {
+		return
+	}
+
+	aggregate, exists := ra.aggregates[inResponseTo]
+	if exists == false {
+		aggregate = &responseAggregate{
+			accountNumber: responseMessage.AccountNumber,
+			sender:        responseMessage.Sender,
+			inResponseTo:  inResponseTo,
+			timer: time.AfterFunc(ra.timeout, func() {
+				ra.expire(inResponseTo)
+			}),
+		}
+		aggregate.overhead = aggregate.envelopeSize()
+		ra.aggregates[inResponseTo] = aggregate
+	}
+
+	if aggregate.recordSize(size) > ra.maxBytes {
+		ra.flush(aggregate, ResponsesMemoryLimitExceeded)
+		return
+	}
+
+	if ra.makeRoom(aggregate, size) == false {
+		return
+	}
+
+	aggregate.responses = append(aggregate.responses, responseMessage)
+	aggregate.size += size
+	ra.bufferedBytes += size
+	metrics.responseAggregatorBufferedBytesGauge.Set(float64(ra.bufferedBytes))
+
+	switch responseMessage.MessageType {
+	case ResponseMessageTypeEOF:
+		ra.flush(aggregate, ResponsesCompleted)
+	case ResponseMessageTypeConnectionLost:
+		ra.flush(aggregate, ResponsesDisconnected)
+	case ResponseMessageTypeExpired:
+		ra.flush(aggregate, ResponsesExpired)
+	case ResponseMessageTypeCancelled:
+		ra.flush(aggregate, ResponsesCancelled)
+	}
+}
+
+// makeRoom flushes the largest aggregates until a response of the given size
+// can be buffered without exceeding maxBufferedBytes.  false is returned if the
+// aggregate that the response belongs to had to be flushed.
+func (ra *ResponseAggregator) makeRoom(aggregate *responseAggregate, size int) bool {
+	for ra.bufferedBytes+size > ra.maxBufferedBytes {
+		largest := aggregate
+		for _, a := range ra.aggregates {
+			if a.size > largest.size || (a.size == largest.size && a.inResponseTo < largest.inResponseTo) {
+				largest = a
+			}
+		}
+
+		metrics.responseAggregatorEarlyFlushCounter.Inc()
+		ra.flush(largest, ResponsesMemoryLimitExceeded)
+
+		if largest == aggregate {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (ra *ResponseAggregator) expire(inResponseTo string) {
+	ra.Lock()
+	defer ra.Unlock()
+
+	aggregate, exists := ra.aggregates[inResponseTo]
+	if exists == false {
+		return
+	}
+
+	ra.flush(aggregate, ResponsesTimedOut)
+}
+
+// envelopeSize returns the size of the encoded aggregated response without any
+// responses.  The longest status is used so that the size holds for any status.
+func (aggregate *responseAggregate) envelopeSize() int {
+	envelope, _ := json.Marshal(AggregatedResponseMessage{
+		AccountNumber: aggregate.accountNumber,
+		Sender:        aggregate.sender,
+		InResponseTo:  aggregate.inResponseTo,
+		Status:        ResponsesMemoryLimitExceeded,
+		Responses:     []ResponseMessage{},
+	})
+	return len(envelope)
+}
+
+// recordSize returns the size of the encoded aggregated response once a
+// response of the given size has been added to it.
+func (aggregate *responseAggregate) recordSize(size int) int {
+	// Each response is separated from the previous one by a comma
+	return aggregate.overhead + aggregate.size + len(aggregate.responses) + size
+}
+
+// rememberFlushed stops the aggregation of any further responses to a message
+// that has been flushed.  The message is forgotten once the timeout has passed.
+func (ra *ResponseAggregator) rememberFlushed(inResponseTo string) {
+	ra.flushed[inResponseTo] = time.AfterFunc(ra.timeout, func() {
+		ra.Lock()
+		delete(ra.flushed, inResponseTo)
+		ra.Unlock()
+	})
+}
+
+func (ra *ResponseAggregator) flush(aggregate *responseAggregate, status string) {
+	aggregate.timer.Stop()
+	delete(ra.aggregates, aggregate.inResponseTo)
+	ra.rememberFlushed(aggregate.inResponseTo)
+	ra.bufferedBytes -= aggregate.size
+	metrics.responseAggregatorBufferedBytesGauge.Set(float64(ra.bufferedBytes))
+
+	sort.SliceStable(aggregate.responses, func(i, j int) bool {
+		return aggregate.responses[i].Serial < aggregate.responses[j].Serial
+	})
+
+	aggregatedResponse := AggregatedResponseMessage{
+		AccountNumber: aggregate.accountNumber,
+		Sender:        aggregate.sender,
+		InResponseTo:  aggregate.inResponseTo,
+		Status:        status,
+		Responses:     aggregate.responses,
+	}
+
+	logger := logger.Log.WithFields(logrus.Fields{"account": aggregate.accountNumber,
+		"in_response_to": aggregate.inResponseTo,
+		"status":         status,
+		"response_count": len(aggregate.responses)})
+
+	jsonAggregatedResponse, err := json.Marshal(aggregatedResponse)
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Error("JSON marshal of AggregatedResponseMessage failed")
+		return
+	}
+
+	logger.Info("Dispatching aggregated response message")
+
+	go func() {
+		err := ra.writer.WriteMessages(context.Background(),
+			kafka.Message{
+				Key:   []byte(aggregate.inResponseTo),
+				Value: jsonAggregatedResponse,
+			})
+
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Error("Error writing aggregated response message to kafka")
+
+			if errors.Is(err, context.Canceled) != true {
+				metrics.aggregatedResponseKafkaWriterFailureCounter.Inc()
+			}
+		} else {
+			metrics.aggregatedResponseKafkaWriterSuccessCounter.Inc()
+		}
+	}()
+}
@@ -0,0 +1,261 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+type channelKafkaWriter struct {
+	messages chan kafka.Message
+}
+
+func (w *channelKafkaWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	for _, msg := range msgs {
+		w.messages <- msg
+	}
+	return nil
+}
+
+func newTestResponseAggregator(maxBytes int, timeout time.Duration) (*ResponseAggregator, *channelKafkaWriter) {
+	cfg := config.GetConfig()
+	cfg.ResponseAggregationMaxBytes = maxBytes
+	cfg.ResponseAggregationMaxBufferedBytes = 1024 * 1024
+	cfg.KafkaMaxMessageBytes = maxBytes
+	cfg.ResponseAggregationTimeout = timeout
+
+	w := &channelKafkaWriter{messages: make(chan kafka.Message, 10)}
+
+	return NewResponseAggregator(w, cfg), w
+}
+
+// testEnvelopeSize is the size of an aggregated response to the given message
+// without any responses
+func testEnvelopeSize(inResponseTo string) int {
+	aggregate := responseAggregate{inResponseTo: inResponseTo}
+	return aggregate.envelopeSize()
+}
+
+func verifyNoAggregatedResponse(t *testing.T, w *channelKafkaWriter) {
+	select {
+	case msg := <-w.messages:
+		t.Fatalf("Unexpected aggregated response: %s", msg.Value)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func readAggregatedResponse(t *testing.T, w *channelKafkaWriter) AggregatedResponseMessage {
+	select {
+	case msg := <-w.messages:
+		var aggregatedResponse AggregatedResponseMessage
+		if err := json.Unmarshal(msg.Value, &aggregatedResponse); err != nil {
+			t.Fatalf("Unable to unmarshal aggregated response: %s", err)
+		}
+		if string(msg.Key) != aggregatedResponse.InResponseTo {
+			t.Fatalf("Key was incorrect, got: %s, want: %s", msg.Key, aggregatedResponse.InResponseTo)
+		}
+		return aggregatedResponse
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the aggregated response")
+	}
+	return AggregatedResponseMessage{}
+}
+
+func TestResponseAggregatorOrdersResponses(t *testing.T) {
+	ra, w := newTestResponseAggregator(1024, time.Minute)
+
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 2}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-2", MessageType: "response", Serial: 1}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 1}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: ResponseMessageTypeEOF, Serial: 3}, 10)
+
+	aggregatedResponse := readAggregatedResponse(t, w)
+
+	if aggregatedResponse.InResponseTo != "job-1" || aggregatedResponse.Status != ResponsesCompleted {
+		t.Fatalf("Aggregated response was incorrect, got: %+v", aggregatedResponse)
+	}
+
+	if len(aggregatedResponse.Responses) != 3 {
+		t.Fatalf("Expected 3 responses, got: %v", aggregatedResponse.Responses)
+	}
+
+	for i, r := range aggregatedResponse.Responses {
+		if r.Serial != i+1 {
+			t.Fatalf("Responses were not ordered by serial: %v", aggregatedResponse.Responses)
+		}
+	}
+
+	if ra.bufferedBytes != 10 {
+		t.Fatalf("Buffered bytes was incorrect, got: %d, want: %d", ra.bufferedBytes, 10)
+	}
+}
+
+func TestResponseAggregatorTimesOut(t *testing.T) {
+	ra, w := newTestResponseAggregator(1024, 50*time.Millisecond)
+
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 1}, 10)
+
+	aggregatedResponse := readAggregatedResponse(t, w)
+
+	if aggregatedResponse.Status != ResponsesTimedOut || len(aggregatedResponse.Responses) != 1 {
+		t.Fatalf("Aggregated response was incorrect, got: %+v", aggregatedResponse)
+	}
+
+	// Late responses must not start a new aggregation
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: ResponseMessageTypeEOF, Serial: 2}, 10)
+
+	verifyNoAggregatedResponse(t, w)
+}
+
+func TestResponseAggregatorIgnoresLateResponses(t *testing.T) {
+	ra, w := newTestResponseAggregator(1024, time.Minute)
+
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 1}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: ResponseMessageTypeEOF, Serial: 2}, 10)
+
+	aggregatedResponse := readAggregatedResponse(t, w)
+
+	if aggregatedResponse.Status != ResponsesCompleted || len(aggregatedResponse.Responses) != 2 {
+		t.Fatalf("Aggregated response was incorrect, got: %+v", aggregatedResponse)
+	}
+
+	// Duplicate responses that arrive after the eof must not start a new aggregation
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 1}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: ResponseMessageTypeEOF, Serial: 2}, 10)
+
+	verifyNoAggregatedResponse(t, w)
+
+	if len(ra.aggregates) != 0 {
+		t.Fatalf("Expected no aggregates, got: %v", ra.aggregates)
+	}
+}
+
+func TestResponseAggregatorMemoryLimit(t *testing.T) {
+	// Room for two 10 byte responses separated by a comma
+	ra, w := newTestResponseAggregator(testEnvelopeSize("job-1")+21, time.Minute)
+
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 1}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 2}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 3}, 10)
+
+	aggregatedResponse := readAggregatedResponse(t, w)
+
+	if aggregatedResponse.Status != ResponsesMemoryLimitExceeded || len(aggregatedResponse.Responses) != 2 {
+		t.Fatalf("Aggregated response was incorrect, got: %+v", aggregatedResponse)
+	}
+
+	if ra.bufferedBytes != 0 {
+		t.Fatalf("Buffered bytes was incorrect, got: %d, want: %d", ra.bufferedBytes, 0)
+	}
+
+	// The remaining responses to the message are not aggregated
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: ResponseMessageTypeEOF, Serial: 4}, 10)
+
+	verifyNoAggregatedResponse(t, w)
+}
+
+func TestResponseAggregatorMemoryLimitIsPerMessage(t *testing.T) {
+	ra, w := newTestResponseAggregator(testEnvelopeSize("job-1")+21, time.Minute)
+
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 1}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 2}, 10)
+
+	// The responses buffered for job-1 do not count against the limit of job-2
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-2", MessageType: "response", Serial: 1}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-2", MessageType: ResponseMessageTypeEOF, Serial: 2}, 10)
+
+	aggregatedResponse := readAggregatedResponse(t, w)
+
+	if aggregatedResponse.InResponseTo != "job-2" || aggregatedResponse.Status != ResponsesCompleted || len(aggregatedResponse.Responses) != 2 {
+		t.Fatalf("Aggregated response was incorrect, got: %+v", aggregatedResponse)
+	}
+
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: ResponseMessageTypeEOF, Serial: 3}, 1)
+
+	aggregatedResponse = readAggregatedResponse(t, w)
+
+	if aggregatedResponse.InResponseTo != "job-1" || aggregatedResponse.Status != ResponsesMemoryLimitExceeded || len(aggregatedResponse.Responses) != 2 {
+		t.Fatalf("Aggregated response was incorrect, got: %+v", aggregatedResponse)
+	}
+}
+
+func TestResponseAggregatorBufferedBytesLimit(t *testing.T) {
+	ra, w := newTestResponseAggregator(1024, time.Minute)
+	ra.maxBufferedBytes = 30
+
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 1}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 2}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-2", MessageType: "response", Serial: 1}, 10)
+
+	verifyNoAggregatedResponse(t, w)
+
+	// The largest aggregate is written early to make room for the response
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-2", MessageType: "response", Serial: 2}, 10)
+
+	aggregatedResponse := readAggregatedResponse(t, w)
+
+	if aggregatedResponse.InResponseTo != "job-1" || aggregatedResponse.Status != ResponsesMemoryLimitExceeded || len(aggregatedResponse.Responses) != 2 {
+		t.Fatalf("Aggregated response was incorrect, got: %+v", aggregatedResponse)
+	}
+
+	if ra.bufferedBytes != 20 {
+		t.Fatalf("Buffered bytes was incorrect, got: %d, want: %d", ra.bufferedBytes, 20)
+	}
+
+	// The aggregate that the response belongs to is the largest one
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-3", MessageType: "response", Serial: 1}, 5)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-2", MessageType: "response", Serial: 3}, 10)
+
+	aggregatedResponse = readAggregatedResponse(t, w)
+
+	if aggregatedResponse.InResponseTo != "job-2" || aggregatedResponse.Status != ResponsesMemoryLimitExceeded || len(aggregatedResponse.Responses) != 2 {
+		t.Fatalf("Aggregated response was incorrect, got: %+v", aggregatedResponse)
+	}
+
+	if ra.bufferedBytes != 5 {
+		t.Fatalf("Buffered bytes was incorrect, got: %d, want: %d", ra.bufferedBytes, 5)
+	}
+}
+
+func TestResponseAggregatorLimitedToKafkaMaxMessageBytes(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.ResponseAggregationMaxBytes = 1024 * 1024
+	cfg.KafkaMaxMessageBytes = testEnvelopeSize("job-1") + 10
+	cfg.ResponseAggregationTimeout = time.Minute
+
+	w := &channelKafkaWriter{messages: make(chan kafka.Message, 10)}
+	ra := NewResponseAggregator(w, cfg)
+
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 1}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: ResponseMessageTypeEOF, Serial: 2}, 10)
+
+	aggregatedResponse := readAggregatedResponse(t, w)
+
+	if aggregatedResponse.Status != ResponsesMemoryLimitExceeded || len(aggregatedResponse.Responses) != 1 {
+		t.Fatalf("Aggregated response was incorrect, got: %+v", aggregatedResponse)
+	}
+
+	verifyNoAggregatedResponse(t, w)
+}
+
+func TestResponseAggregatorConnectionLost(t *testing.T) {
+	ra, w := newTestResponseAggregator(1024, time.Minute)
+
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: "response", Serial: 1}, 10)
+	ra.AddResponse(ResponseMessage{InResponseTo: "job-1", MessageType: ResponseMessageTypeConnectionLost, Serial: 2}, 10)
+
+	aggregatedResponse := readAggregatedResponse(t, w)
+
+	if aggregatedResponse.Status != ResponsesDisconnected {
+		t.Fatalf("Status was incorrect, got: %s, want: %s", aggregatedResponse.Status, ResponsesDisconnected)
+	}
+
+	if len(aggregatedResponse.Responses) != 2 {
+		t.Fatalf("Expected 2 responses, got: %v", aggregatedResponse.Responses)
+	}
+}
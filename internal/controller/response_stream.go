@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// ResponseStream delivers the responses to a job as they arrive.  The
+// responses channel is closed when the stream ends.  Status reports why the
+// stream ended once the responses channel has been closed.
+type ResponseStream struct {
+	MessageID uuid.UUID
+
+	responses chan ResponseMessage
+	status    string
+}
+
+func NewResponseStream(messageID uuid.UUID, bufferSize int) *ResponseStream {
+	return &ResponseStream{
+		MessageID: messageID,
+		responses: make(chan ResponseMessage, bufferSize),
+	}
+}
+
+func (s *ResponseStream) Responses() <-chan ResponseMessage {
+	return s.responses
+}
+
+// Status must only be called after the responses channel has been closed
+func (s *ResponseStream) Status() string {
+	return s.status
+}
+
+// Send passes a response to the reader of the stream.  false is returned if
+// the reader went away before the response could be delivered.
+func (s *ResponseStream) Send(ctx context.Context, responseMessage ResponseMessage) bool {
+	select {
+	case s.responses <- responseMessage:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// TrySend passes a response to the reader of the stream without waiting for
+// the reader.  false is returned if the stream's buffer is full because the
+// reader is not keeping up.
+func (s *ResponseStream) TrySend(responseMessage ResponseMessage) bool {
+	select {
+	case s.responses <- responseMessage:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close ends the stream.  Close must only be called once.
+func (s *ResponseStream) Close(status string) {
+	s.status = status
+	close(s.responses)
+}
@@ -2,7 +2,6 @@ package controller
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/protocol"
 
@@ -28,9 +27,21 @@ func (rth RouteTableHandler) HandleMessage(ctx context.Context, m protocol.Messa
 		return
 	}
 
+	edges, err := routingTableMessage.GetEdges()
+	if err != nil {
+		rth.Logger.WithFields(logrus.Fields{"error": err}).Info("Unable to parse the edges from the RouteTableMessage")
+		return
+	}
+
 	rth.Receptor.UpdateRoutingTable(
-		fmt.Sprintf("%s", routingTableMessage.Edges),
-		fmt.Sprintf("%s", routingTableMessage.Seen))
+		routingTableMessage.ID,
+		routingTableMessage.Capabilities,
+		edges,
+		routingTableMessage.Seen)
+
+	// Nodes that have become reachable may have jobs that were queued
+	// while they were offline.  This must not block the response reactor.
+	go rth.Receptor.DeliverQueuedJobs(rth.Transport.Ctx)
 
 	return
 }
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/platform/logger"
+	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/protocol"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestReceptorService(account, peerNodeID string) *ReceptorService {
+	log := logrus.NewEntry(logger.Log)
+	factory := NewReceptorServiceFactory(nil, nil, NewInMemoryJobRegistry(config.GetConfig()), NewInMemoryJobQueue(), nil, config.GetConfig())
+	receptor := factory.NewReceptorService(log, account, "node-cloud-receptor-controller")
+	receptor.RegisterConnection(peerNodeID, nil, &Transport{})
+	return receptor
+}
+
+func TestRouteTableHandlerUpdatesRoutes(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+
+	handler := RouteTableHandler{
+		Receptor:  receptor,
+		Transport: newTestTransport(),
+		Logger:    logrus.NewEntry(logger.Log),
+	}
+
+	routeTableMessage := &protocol.RouteTableMessage{
+		Command: "ROUTE",
+		ID:      "node-a",
+		Edges: [][]interface{}{
+			{"node-cloud-receptor-controller", "node-a", float64(1)},
+			{"node-a", "node-b", float64(1)},
+			{"node-b", "node-c", float64(1)},
+		},
+		Seen: []string{"node-a", "node-b", "node-c"},
+	}
+
+	handler.HandleMessage(context.TODO(), routeTableMessage)
+
+	route := receptor.GetRouteToNode("node-c")
+	expected := []string{"node-a", "node-b", "node-c"}
+	if reflect.DeepEqual(route, expected) == false {
+		t.Fatalf("Route was incorrect, got: %v, want: %v", route, expected)
+	}
+
+	if route := receptor.GetRouteToNode("not-in-mesh"); route != nil {
+		t.Fatalf("Expected no route, got: %v", route)
+	}
+}
+
+func TestRouteTableHandlerRemovesEdges(t *testing.T) {
+	receptor := newTestReceptorService("0000001", "node-a")
+
+	handler := RouteTableHandler{
+		Receptor:  receptor,
+		Transport: newTestTransport(),
+		Logger:    logrus.NewEntry(logger.Log),
+	}
+
+	handler.HandleMessage(context.TODO(), &protocol.RouteTableMessage{
+		Command: "ROUTE",
+		ID:      "node-a",
+		Edges: [][]interface{}{
+			{"node-a", "node-b", float64(1)},
+			{"node-b", "node-c", float64(1)},
+		},
+		Seen: []string{"node-a", "node-b", "node-c"},
+	})
+
+	handler.HandleMessage(context.TODO(), &protocol.RouteTableMessage{
+		Command: "ROUTE",
+		ID:      "node-a",
+		Edges: [][]interface{}{
+			{"node-a", "node-b", float64(1)},
+		},
+		Seen: []string{"node-a", "node-b"},
+	})
+
+	topology, _ := receptor.GetTopology(context.TODO())
+	if topology.Version != 2 {
+		t.Fatalf("Topology version was incorrect, got: %d, want: %d", topology.Version, 2)
+	}
+
+	if len(topology.Edges) != 1 {
+		t.Fatalf("Expected a single edge, got: %v", topology.Edges)
+	}
+
+	if route := receptor.GetRouteToNode("node-c"); route != nil {
+		t.Fatalf("Expected no route, got: %v", route)
+	}
+}
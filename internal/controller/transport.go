@@ -2,13 +2,20 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"sync/atomic"
 
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
 	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/protocol"
 )
 
 type ReceptorMessage struct {
 	AccountNumber string
 	Message       protocol.Message
+
+	// Compression is the compression that was negotiated for the
+	// connection's payload frames
+	Compression protocol.Compression
 }
 
 type ReceptorErrorMessage struct {
@@ -16,24 +23,185 @@ type ReceptorErrorMessage struct {
 	Error         error
 }
 
+// Lane is a priority lane on which messages are passed to the write side of
+// the websocket
+type Lane string
+
+const (
+	// LaneControl carries command/control messages such as the handshake
+	// and cancel directives
+	LaneControl Lane = "control"
+
+	// LaneInteractive carries jobs that a caller is waiting on
+	LaneInteractive Lane = "interactive"
+
+	// LaneBulk carries jobs that can wait behind the interactive jobs
+	LaneBulk Lane = "bulk"
+)
+
+// Lanes lists the lanes in the order that they are scheduled
+var Lanes = []Lane{LaneControl, LaneInteractive, LaneBulk}
+
+func ParseLane(lane string) (Lane, error) {
+	for _, l := range Lanes {
+		if string(l) == lane {
+			return l, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid lane (%s)", lane)
+}
+
+func laneBufferSize(cfg *config.Config, lane Lane) int {
+	switch lane {
+	case LaneControl:
+		return cfg.ControlLaneBufferSize
+	case LaneInteractive:
+		return cfg.InteractiveLaneBufferSize
+	default:
+		return cfg.BulkLaneBufferSize
+	}
+}
+
+func laneWeight(cfg *config.Config, lane Lane) int {
+	weight := cfg.BulkLaneWeight
+	switch lane {
+	case LaneControl:
+		weight = cfg.ControlLaneWeight
+	case LaneInteractive:
+		weight = cfg.InteractiveLaneWeight
+	}
+
+	// Every lane must be given a turn or it would never be drained
+	if weight < 1 {
+		return 1
+	}
+
+	return weight
+}
+
+// NewLaneChannels creates a channel for each lane using the lane's buffer
+// size
+func NewLaneChannels(cfg *config.Config) map[Lane]chan ReceptorMessage {
+	lanes := make(map[Lane]chan ReceptorMessage, len(Lanes))
+	for _, lane := range Lanes {
+		lanes[lane] = make(chan ReceptorMessage, laneBufferSize(cfg, lane))
+	}
+	return lanes
+}
+
+type laneContextKey struct{}
+
+// WithLane returns a copy of the context that sends messages on the lane
+func WithLane(ctx context.Context, lane Lane) context.Context {
+	return context.WithValue(ctx, laneContextKey{}, lane)
+}
+
+// LaneFromContext returns the lane that was set on the context.  Messages
+// are sent on the interactive lane unless the sender chose a lane.
+func LaneFromContext(ctx context.Context) Lane {
+	if lane, ok := ctx.Value(laneContextKey{}).(Lane); ok {
+		return lane
+	}
+	return LaneInteractive
+}
+
+// LaneScheduler hands out the queued messages using weighted round robin.
+// Each lane may have up to its weight in messages written before the next
+// lane gets a turn.  A lane with no queued messages gives up its turn.  This
+// keeps a flood of bulk jobs from starving the control and interactive
+// messages while still guaranteeing that the bulk jobs make progress.
+type LaneScheduler struct {
+	lanes   map[Lane]chan ReceptorMessage
+	weights map[Lane]int
+	current int
+	credits int
+}
+
+func NewLaneScheduler(lanes map[Lane]chan ReceptorMessage, cfg *config.Config) *LaneScheduler {
+	weights := make(map[Lane]int, len(Lanes))
+	for _, lane := range Lanes {
+		weights[lane] = laneWeight(cfg, lane)
+	}
+
+	return &LaneScheduler{
+		lanes:   lanes,
+		weights: weights,
+		credits: weights[Lanes[0]],
+	}
+}
+
+// Next returns the next message to be written without blocking.  false is
+// returned if none of the lanes have a queued message.
+func (s *LaneScheduler) Next() (ReceptorMessage, bool) {
+	// Visit each lane once and then return to the current lane with a
+	// fresh set of credits
+	for i := 0; i <= len(Lanes); i++ {
+		if s.credits > 0 {
+			select {
+			case msg := <-s.lanes[Lanes[s.current]]:
+				s.credits--
+				return msg, true
+			default:
+			}
+		}
+
+		s.current = (s.current + 1) % len(Lanes)
+		s.credits = s.weights[Lanes[s.current]]
+	}
+
+	return ReceptorMessage{}, false
+}
+
+// ConnectionOverloadedError is returned when a message could not be passed
+// to the write side of the websocket because the lane's buffer stayed full
+// for longer than the maximum send wait.  The queue depth is included so
+// that the caller can decide how long to back off.
+type ConnectionOverloadedError struct {
+	Lane          Lane
+	QueueDepth    int
+	QueueCapacity int
+}
+
+func (e *ConnectionOverloadedError) Error() string {
+	return fmt.Sprintf("Connection overloaded.  %d of %d messages are queued on the %s lane",
+		e.QueueDepth, e.QueueCapacity, e.Lane)
+}
+
 type Transport struct {
 
-	// send is a channel on which messages are sent.
-	Send chan ReceptorMessage
+	// Lanes are the channels on which messages are passed to the write
+	// side of the websocket.  The lanes are scheduled by priority so that
+	// command/control messages and interactive jobs can bypass any queued
+	// bulk jobs.
+	Lanes map[Lane]chan ReceptorMessage
 
 	// recv is a channel on which responses are sent.
 	Recv chan protocol.Message
 
-	// controlChannel is a channel on which command/control
-	// messages are passed to the write side of the websocket...
-	// this allows command/control messages to bypass any queued
-	// job messages
-	ControlChannel chan ReceptorMessage
-
 	// errorChannel is a channel on which errors are sent
 	// to the go routine managing write side of the websocket
 	ErrorChannel chan ReceptorErrorMessage
 
 	Ctx    context.Context
 	Cancel context.CancelFunc
+
+	// compression is the compression that was negotiated during the
+	// handshake.  The read side of the websocket only decompresses
+	// payload frames that were compressed with it.
+	compression atomic.Value
+}
+
+// SetCompression records the compression that was negotiated during the
+// handshake.  It has to be set before the handshake response is sent since
+// the peer starts compressing as soon as it reads the response.
+func (t *Transport) SetCompression(compression protocol.Compression) {
+	t.compression.Store(compression)
+}
+
+// Compression returns the compression that was negotiated during the
+// handshake.  No compression is used until the handshake completes.
+func (t *Transport) Compression() protocol.Compression {
+	compression, _ := t.compression.Load().(protocol.Compression)
+	return compression
 }
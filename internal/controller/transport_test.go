@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
+)
+
+func newTestLaneScheduler(controlWeight, interactiveWeight, bulkWeight int) (*LaneScheduler, map[Lane]chan ReceptorMessage) {
+	cfg := config.GetConfig()
+	cfg.ControlLaneBufferSize = 100
+	cfg.InteractiveLaneBufferSize = 100
+	cfg.BulkLaneBufferSize = 100
+	cfg.ControlLaneWeight = controlWeight
+	cfg.InteractiveLaneWeight = interactiveWeight
+	cfg.BulkLaneWeight = bulkWeight
+
+	lanes := NewLaneChannels(cfg)
+
+	return NewLaneScheduler(lanes, cfg), lanes
+}
+
+func fillLane(lanes map[Lane]chan ReceptorMessage, lane Lane, count int) {
+	for i := 0; i < count; i++ {
+		lanes[lane] <- ReceptorMessage{AccountNumber: string(lane)}
+	}
+}
+
+func nextLanes(t *testing.T, scheduler *LaneScheduler, count int) []Lane {
+	var order []Lane
+	for i := 0; i < count; i++ {
+		msg, ok := scheduler.Next()
+		if !ok {
+			t.Fatalf("Expected a message after %d messages", i)
+		}
+		order = append(order, Lane(msg.AccountNumber))
+	}
+	return order
+}
+
+func TestLaneSchedulerWeightedFairness(t *testing.T) {
+	scheduler, lanes := newTestLaneScheduler(2, 2, 1)
+
+	fillLane(lanes, LaneBulk, 50)
+	fillLane(lanes, LaneInteractive, 4)
+	fillLane(lanes, LaneControl, 1)
+
+	expected := []Lane{
+		LaneControl,
+		LaneInteractive, LaneInteractive,
+		LaneBulk,
+		LaneInteractive, LaneInteractive,
+		LaneBulk,
+		LaneBulk,
+	}
+
+	actual := nextLanes(t, scheduler, len(expected))
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("Lane order was incorrect, got: %v, want: %v", actual, expected)
+		}
+	}
+}
+
+func TestLaneSchedulerBulkIsNotStarved(t *testing.T) {
+	scheduler, lanes := newTestLaneScheduler(8, 4, 1)
+
+	fillLane(lanes, LaneInteractive, 50)
+	fillLane(lanes, LaneBulk, 1)
+
+	actual := nextLanes(t, scheduler, 5)
+	if actual[4] != LaneBulk {
+		t.Fatalf("Expected the bulk lane to get a turn, got: %v", actual)
+	}
+}
+
+func TestLaneSchedulerEmpty(t *testing.T) {
+	scheduler, lanes := newTestLaneScheduler(1, 1, 1)
+
+	if _, ok := scheduler.Next(); ok {
+		t.Fatal("Expected no message from empty lanes")
+	}
+
+	fillLane(lanes, LaneBulk, 1)
+
+	actual := nextLanes(t, scheduler, 1)
+	if actual[0] != LaneBulk {
+		t.Fatalf("Lane was incorrect, got: %s, want: %s", actual[0], LaneBulk)
+	}
+}
+
+func TestLaneFromContext(t *testing.T) {
+	if lane := LaneFromContext(context.TODO()); lane != LaneInteractive {
+		t.Fatalf("Default lane was incorrect, got: %s, want: %s", lane, LaneInteractive)
+	}
+
+	if lane := LaneFromContext(WithLane(context.TODO(), LaneBulk)); lane != LaneBulk {
+		t.Fatalf("Lane was incorrect, got: %s, want: %s", lane, LaneBulk)
+	}
+}
+
+func TestParseLane(t *testing.T) {
+	for _, lane := range Lanes {
+		if parsed, err := ParseLane(string(lane)); err != nil || parsed != lane {
+			t.Fatalf("Unable to parse lane %s, got: %s, %v", lane, parsed, err)
+		}
+	}
+
+	if _, err := ParseLane("express"); err == nil {
+		t.Fatal("Expected an error for an invalid lane")
+	}
+}
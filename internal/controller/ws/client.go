@@ -1,14 +1,18 @@
 package ws
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/RedHatInsights/platform-receptor-controller/internal/config"
 	"github.com/RedHatInsights/platform-receptor-controller/internal/controller"
 	"github.com/RedHatInsights/platform-receptor-controller/internal/receptor/protocol"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
@@ -18,13 +22,23 @@ type rcClient struct {
 	// socket is the web socket for this client.
 	socket *websocket.Conn
 
-	// send is a channel on which messages are sent.
-	send chan controller.ReceptorMessage
+	// lanes are the channels on which messages are sent.
+	lanes map[controller.Lane]chan controller.ReceptorMessage
 
-	controlChannel chan controller.ReceptorMessage
+	// scheduler decides which lane the next message is taken from.
+	scheduler *controller.LaneScheduler
+
+	// codec is the protocol.Codec that speaks the peer's wire format.  It
+	// is picked from the websocket subprotocol or from the first frame
+	// that the peer sends.
+	codec atomic.Value
 
 	errorChannel chan controller.ReceptorErrorMessage
 
+	// transport is shared with the handshake handler which records the
+	// negotiated compression on it
+	transport *controller.Transport
+
 	// recv is a channel on which responses are sent.
 	recv chan protocol.Message
 
@@ -50,7 +64,26 @@ func (c *rcClient) read(ctx context.Context) {
 			return
 		}
 
-		message, err := protocol.ReadMessage(r)
+		codec, ok := c.codec.Load().(protocol.Codec)
+		if !ok {
+			codec, r = c.sniffCodec(r)
+		}
+
+		message, err := codec.ReadMessage(r, c.transport.Compression())
+
+		var unknownCommandErr *protocol.UnknownCommandError
+		if errors.As(err, &unknownCommandErr) {
+			c.logger.WithFields(logrus.Fields{"command": unknownCommandErr.Command}).Warn("Skipping unknown command")
+			c.socket.SetReadDeadline(time.Time{})
+			continue
+		}
+
+		if errors.Is(err, protocol.ErrMessageSkipped) {
+			c.logger.WithFields(logrus.Fields{"reason": err}).Debug("Skipping message")
+			c.socket.SetReadDeadline(time.Time{})
+			continue
+		}
+
 		if err != nil {
 			c.logger.WithFields(logrus.Fields{"error": err}).Error("Error while reading receptor message")
 			return
@@ -73,6 +106,24 @@ func (c *rcClient) read(ctx context.Context) {
 	}
 }
 
+func (c *rcClient) setCodec(codec protocol.Codec) {
+	c.logger.WithFields(logrus.Fields{"codec": codec.Name()}).Info("Using codec")
+	c.codec.Store(codec)
+	metrics.CodecCounter.With(prometheus.Labels{"codec": codec.Name()}).Inc()
+}
+
+// sniffCodec picks the codec from the first bytes of the first frame.  The
+// returned reader replays the bytes that were sniffed.
+func (c *rcClient) sniffCodec(r io.Reader) (protocol.Codec, io.Reader) {
+	br := bufio.NewReaderSize(r, protocol.SniffLength)
+	prefix, _ := br.Peek(protocol.SniffLength)
+
+	codec := protocol.SniffCodec(prefix)
+	c.setCodec(codec)
+
+	return codec, br
+}
+
 func (c *rcClient) configurePongHandler() {
 
 	if c.config.PongWait > 0 {
@@ -101,7 +152,14 @@ func (c *rcClient) writeMessage(msg controller.ReceptorMessage) error {
 		return err
 	}
 
-	err = protocol.WriteMessage(w, msg.Message)
+	// Nothing but errors should be written before the peer's first frame
+	// picks the codec
+	codec, ok := c.codec.Load().(protocol.Codec)
+	if !ok {
+		codec = protocol.LegacyCodec{}
+	}
+
+	err = codec.WriteMessage(w, msg.Message, msg.Compression)
 	if err != nil {
 		return err
 	}
@@ -124,48 +182,88 @@ func (c *rcClient) write(ctx context.Context) {
 
 	for {
 
+		var msg controller.ReceptorMessage
+		var ok bool
+
+		// Errors and pings are handled before any queued messages
 		select {
 		case <-ctx.Done():
 			return
 
 		case errMsg := <-c.errorChannel:
-			c.logger.WithFields(logrus.Fields{"error": errMsg.Error}).Error("Received an error from the sync layer")
-
-			if err := c.verifyAccountNumber(errMsg.AccountNumber); err != nil {
-				c.logger.WithFields(logrus.Fields{"error": err}).Error("Account mismatch while processing error from the sync layer")
-				break
-			}
-
-			c.socket.WriteMessage(websocket.CloseMessage,
-				websocket.FormatCloseMessage(websocket.CloseNormalClosure, errMsg.Error.Error()))
-			// FIXME: is a sleep needed here??
-			return
-
-		case msg := <-c.controlChannel:
-			c.logger.Tracef("Sending message received from control channel: %+v", msg)
-			err := c.writeMessage(msg)
-			if err != nil {
-				c.logger.WithFields(logrus.Fields{"error": err}).Error("Error while sending a control message")
+			if c.handleSyncLayerError(errMsg) {
 				return
 			}
+			continue
 
-		case msg := <-c.send:
-			c.logger.Tracef("Sending message received from send channel: %+v", msg)
-			err := c.writeMessage(msg)
-			if err != nil {
-				c.logger.WithFields(logrus.Fields{"error": err}).Error("Error while sending a message")
+		case <-pingTicker.C:
+			if err := c.writePing(); err != nil {
 				return
 			}
+			continue
 
-		case <-pingTicker.C:
-			// c.logger.Debug("Sending a ping message")
-			c.socket.SetWriteDeadline(time.Now().Add(c.config.WriteWait))
-			if err := c.socket.WriteMessage(websocket.PingMessage, nil); err != nil {
-				c.logger.WithFields(logrus.Fields{"error": err}).Error("Error while sending a ping message")
+		default:
+			msg, ok = c.scheduler.Next()
+		}
+
+		if !ok {
+			// All of the lanes are empty so the first message to arrive
+			// is written
+			select {
+			case <-ctx.Done():
 				return
+
+			case errMsg := <-c.errorChannel:
+				if c.handleSyncLayerError(errMsg) {
+					return
+				}
+				continue
+
+			case <-pingTicker.C:
+				if err := c.writePing(); err != nil {
+					return
+				}
+				continue
+
+			case msg = <-c.lanes[controller.LaneControl]:
+			case msg = <-c.lanes[controller.LaneInteractive]:
+			case msg = <-c.lanes[controller.LaneBulk]:
 			}
 		}
+
+		c.logger.Tracef("Sending message: %+v", msg)
+		err := c.writeMessage(msg)
+		if err != nil {
+			c.logger.WithFields(logrus.Fields{"error": err}).Error("Error while sending a message")
+			return
+		}
+	}
+}
+
+// handleSyncLayerError closes the websocket.  true is returned if the
+// websocket was closed.
+func (c *rcClient) handleSyncLayerError(errMsg controller.ReceptorErrorMessage) bool {
+	c.logger.WithFields(logrus.Fields{"error": errMsg.Error}).Error("Received an error from the sync layer")
+
+	if err := c.verifyAccountNumber(errMsg.AccountNumber); err != nil {
+		c.logger.WithFields(logrus.Fields{"error": err}).Error("Account mismatch while processing error from the sync layer")
+		return false
+	}
+
+	c.socket.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, errMsg.Error.Error()))
+	// FIXME: is a sleep needed here??
+	return true
+}
+
+func (c *rcClient) writePing() error {
+	// c.logger.Debug("Sending a ping message")
+	c.socket.SetWriteDeadline(time.Now().Add(c.config.WriteWait))
+	err := c.socket.WriteMessage(websocket.PingMessage, nil)
+	if err != nil {
+		c.logger.WithFields(logrus.Fields{"error": err}).Error("Error while sending a ping message")
 	}
+	return err
 }
 
 func (c *rcClient) configurePingTicker() *time.Ticker {
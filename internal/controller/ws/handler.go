@@ -17,22 +17,20 @@ import (
 )
 
 type ReceptorController struct {
-	connectionMgr            controller.ConnectionRegistrar
-	router                   *mux.Router
-	config                   *config.Config
-	responseReactorFactory   *controller.ResponseReactorFactory
-	messageDispatcherFactory *controller.MessageDispatcherFactory
-	receptorServiceFactory   *controller.ReceptorServiceFactory
+	connectionMgr          controller.ConnectionRegistrar
+	router                 *mux.Router
+	config                 *config.Config
+	responseReactorFactory *controller.ResponseReactorFactory
+	receptorServiceFactory *controller.ReceptorServiceFactory
 }
 
-func NewReceptorController(cfg *config.Config, cm controller.ConnectionRegistrar, r *mux.Router, rd *controller.ResponseReactorFactory, md *controller.MessageDispatcherFactory, rs *controller.ReceptorServiceFactory) *ReceptorController {
+func NewReceptorController(cfg *config.Config, cm controller.ConnectionRegistrar, r *mux.Router, rd *controller.ResponseReactorFactory, rs *controller.ReceptorServiceFactory) *ReceptorController {
 	return &ReceptorController{
-		connectionMgr:            cm,
-		router:                   r,
-		config:                   cfg,
-		responseReactorFactory:   rd,
-		messageDispatcherFactory: md,
-		receptorServiceFactory:   rs,
+		connectionMgr:          cm,
+		router:                 r,
+		config:                 cfg,
+		responseReactorFactory: rd,
+		receptorServiceFactory: rs,
 	}
 }
 
@@ -46,7 +44,9 @@ func (rc *ReceptorController) handleWebSocket() http.HandlerFunc {
 
 	return func(w http.ResponseWriter, req *http.Request) {
 
-		upgrader := &websocket.Upgrader{ReadBufferSize: rc.config.SocketBufferSize, WriteBufferSize: rc.config.SocketBufferSize}
+		upgrader := &websocket.Upgrader{ReadBufferSize: rc.config.SocketBufferSize,
+			WriteBufferSize: rc.config.SocketBufferSize,
+			Subprotocols:    protocol.Subprotocols()}
 
 		requestId := request_id.GetReqID(req.Context())
 		rhIdentity := identity.Get(req.Context())
@@ -68,42 +68,52 @@ func (rc *ReceptorController) handleWebSocket() http.HandlerFunc {
 
 		logger.Info("Accepted websocket connection")
 
+		lanes := controller.NewLaneChannels(rc.config)
+
 		client := &rcClient{
-			account:        rhIdentity.Identity.AccountNumber,
-			config:         rc.config,
-			socket:         socket,
-			send:           make(chan controller.ReceptorMessage, rc.config.BufferedChannelSize),
-			controlChannel: make(chan controller.ReceptorMessage, rc.config.BufferedChannelSize),
-			errorChannel:   make(chan controller.ReceptorErrorMessage),
-			recv:           make(chan protocol.Message, rc.config.BufferedChannelSize),
-			logger:         logger,
+			account:      rhIdentity.Identity.AccountNumber,
+			config:       rc.config,
+			socket:       socket,
+			lanes:        lanes,
+			scheduler:    controller.NewLaneScheduler(lanes, rc.config),
+			errorChannel: make(chan controller.ReceptorErrorMessage),
+			recv:         make(chan protocol.Message, rc.config.BufferedChannelSize),
+			logger:       logger,
+		}
+
+		// Peers that do not ask for a subprotocol get a codec once their
+		// first frame is read
+		if codec, ok := protocol.CodecForSubprotocol(socket.Subprotocol()); ok {
+			client.setCodec(codec)
 		}
 
+		metrics.LaneQueueDepth.Register(client)
+		defer metrics.LaneQueueDepth.Unregister(client)
+
 		ctx := req.Context()
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 		client.cancel = cancel
 
 		transport := &controller.Transport{
-			Send:           client.send,
-			Recv:           client.recv,
-			ControlChannel: client.controlChannel,
-			ErrorChannel:   client.errorChannel,
-			Cancel:         client.cancel,
-			Ctx:            ctx,
+			Lanes:        client.lanes,
+			Recv:         client.recv,
+			ErrorChannel: client.errorChannel,
+			Cancel:       client.cancel,
+			Ctx:          ctx,
 		}
+		client.transport = transport
 
 		responseReactor := rc.responseReactorFactory.NewResponseReactor(logger, transport.Recv)
 
 		handshakeHandler := controller.HandshakeHandler{
-			Transport:                transport,
-			ReceptorServiceFactory:   rc.receptorServiceFactory,
-			ResponseReactor:          responseReactor,
-			AccountNumber:            rhIdentity.Identity.AccountNumber,
-			NodeID:                   rc.config.ReceptorControllerNodeId,
-			ConnectionMgr:            rc.connectionMgr,
-			MessageDispatcherFactory: rc.messageDispatcherFactory,
-			Logger:                   logger,
+			Transport:              transport,
+			ReceptorServiceFactory: rc.receptorServiceFactory,
+			ResponseReactor:        responseReactor,
+			AccountNumber:          rhIdentity.Identity.AccountNumber,
+			NodeID:                 rc.config.ReceptorControllerNodeId,
+			ConnectionMgr:          rc.connectionMgr,
+			Logger:                 logger,
 		}
 		responseReactor.RegisterHandler(protocol.HiMessageType, handshakeHandler)
 
@@ -63,21 +63,14 @@ var _ = Describe("WsController", func() {
 		wsMux = mux.NewRouter()
 		cfg = config.GetConfig()
 		cr = controller.NewLocalConnectionManager()
-		kc := &queue.ConsumerConfig{
-			Brokers:        cfg.KafkaBrokers,
-			Topic:          cfg.KafkaJobsTopic,
-			GroupID:        cfg.KafkaGroupID,
-			ConsumerOffset: cfg.KafkaConsumerOffset,
-		}
-		md := controller.NewMessageDispatcherFactory(kc)
 		kw, err := queue.StartProducer(&queue.ProducerConfig{
 			Brokers: cfg.KafkaBrokers,
 			Topic:   cfg.KafkaResponsesTopic,
 		})
 		Expect(err).NotTo(HaveOccurred())
 		rd := controller.NewResponseReactorFactory()
-		rs := controller.NewReceptorServiceFactory(kw, cfg)
-		rc = NewReceptorController(cfg, cr, wsMux, rd, md, rs)
+		rs := controller.NewReceptorServiceFactory(kw, nil, controller.NewInMemoryJobRegistry(cfg), controller.NewInMemoryJobQueue(), nil, cfg)
+		rc = NewReceptorController(cfg, cr, wsMux, rd, rs)
 		rc.Routes()
 
 		d = wstest.NewDialer(rc.router)
@@ -145,6 +138,45 @@ var _ = Describe("WsController", func() {
 		})
 	})
 
+	Describe("Connecting to the receptor controller with the legacy subprotocol", func() {
+		Context("With an open connection and sending Hi", func() {
+			It("Should pick the legacy codec and receive a HiMessage", func() {
+				d.Subprotocols = []string{protocol.LegacyCodecName}
+
+				c, _, err := d.Dial("ws://localhost:8080/wss/receptor-controller/gateway", header)
+				Expect(err).NotTo(HaveOccurred())
+				defer c.Close()
+
+				Expect(c.Subprotocol()).To(Equal(protocol.LegacyCodecName))
+
+				hiMessage := protocol.HiMessage{Command: "HI", ID: "TestClient"}
+				writeSocket(c, &hiMessage)
+
+				m, _ := readSocket(c, 1)
+				Expect(m.Type()).To(Equal(protocol.HiMessageType))
+			})
+		})
+	})
+
+	Describe("Connecting to the receptor controller and sending an unknown command", func() {
+		Context("With an open connection", func() {
+			It("Should skip the unknown command and complete the handshake", func() {
+				c, _, err := d.Dial("ws://localhost:8080/wss/receptor-controller/gateway", header)
+				Expect(err).NotTo(HaveOccurred())
+				defer c.Close()
+
+				unknownMessage := protocol.HiMessage{Command: "PING", ID: "TestClient"}
+				writeSocket(c, &unknownMessage)
+
+				hiMessage := protocol.HiMessage{Command: "HI", ID: "TestClient"}
+				writeSocket(c, &hiMessage)
+
+				m, _ := readSocket(c, 1)
+				Expect(m.Type()).To(Equal(protocol.HiMessageType))
+			})
+		})
+	})
+
 	Describe("Connecting to the receptor controller and sending a routing message", func() {
 		Context("With an open connection and successful handshake", func() {
 			It("Should send a routing message and close the connection gracefully", func() {
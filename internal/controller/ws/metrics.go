@@ -1,6 +1,9 @@
 package ws
 
 import (
+	"sync"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/controller"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -10,6 +13,108 @@ type Metrics struct {
 	ActiveConnectionCounter      prometheus.Gauge
 	TotalMessagesSentCounter     prometheus.Counter
 	TotalMessagesReceivedCounter prometheus.Counter
+	LaneQueueDepth               *laneQueueDepthCollector
+	CodecCounter                 *prometheus.CounterVec
+}
+
+// laneFullnessBuckets are the upper bounds of the fullness histogram.  The
+// fullness of a lane is the fraction of its buffer that is in use.
+var laneFullnessBuckets = []float64{0, 0.25, 0.5, 0.75, 1}
+
+// laneQueueDepthCollector reports the number of messages waiting on each
+// lane and the size of the lane buffers summed across the active websocket
+// connections, along with a histogram of how full each connection's lane
+// buffer is.  The depth is read from the lane channels when the metrics are
+// scraped.  The metrics are only labeled by lane so that their cardinality
+// does not grow with the number of connections.
+type laneQueueDepthCollector struct {
+	desc         *prometheus.Desc
+	capacityDesc *prometheus.Desc
+	fullnessDesc *prometheus.Desc
+	clients      map[*rcClient]struct{}
+	sync.Mutex
+}
+
+func newLaneQueueDepthCollector() *laneQueueDepthCollector {
+	return &laneQueueDepthCollector{
+		desc: prometheus.NewDesc("receptor_controller_websocket_lane_queue_depth",
+			"The number of messages waiting to be sent over the websocket connections by lane",
+			[]string{"lane"}, nil),
+		capacityDesc: prometheus.NewDesc("receptor_controller_websocket_lane_capacity",
+			"The number of messages that the lane buffers of the websocket connections can hold by lane",
+			[]string{"lane"}, nil),
+		fullnessDesc: prometheus.NewDesc("receptor_controller_websocket_lane_fullness",
+			"The fraction of the lane buffer of each websocket connection that is in use by lane",
+			[]string{"lane"}, nil),
+		clients: make(map[*rcClient]struct{}),
+	}
+}
+
+func (c *laneQueueDepthCollector) Register(client *rcClient) {
+	c.Lock()
+	defer c.Unlock()
+	c.clients[client] = struct{}{}
+}
+
+func (c *laneQueueDepthCollector) Unregister(client *rcClient) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.clients, client)
+}
+
+func (c *laneQueueDepthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+	ch <- c.capacityDesc
+	ch <- c.fullnessDesc
+}
+
+// laneFullness accumulates the fullness histogram of a lane
+type laneFullness struct {
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+}
+
+func (f *laneFullness) observe(fullness float64) {
+	f.count++
+	f.sum += fullness
+	for _, bound := range laneFullnessBuckets {
+		if fullness <= bound {
+			f.buckets[bound]++
+		}
+	}
+}
+
+func (c *laneQueueDepthCollector) Collect(ch chan<- prometheus.Metric) {
+	depths := make(map[controller.Lane]int, len(controller.Lanes))
+	capacities := make(map[controller.Lane]int, len(controller.Lanes))
+	fullness := make(map[controller.Lane]*laneFullness, len(controller.Lanes))
+	for _, lane := range controller.Lanes {
+		fullness[lane] = &laneFullness{buckets: make(map[float64]uint64, len(laneFullnessBuckets))}
+		for _, bound := range laneFullnessBuckets {
+			fullness[lane].buckets[bound] = 0
+		}
+	}
+
+	c.Lock()
+	for client := range c.clients {
+		for lane, channel := range client.lanes {
+			depth, capacity := len(channel), cap(channel)
+			depths[lane] += depth
+			capacities[lane] += capacity
+			if capacity > 0 {
+				fullness[lane].observe(float64(depth) / float64(capacity))
+			}
+		}
+	}
+	c.Unlock()
+
+	for _, lane := range controller.Lanes {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(depths[lane]), string(lane))
+		ch <- prometheus.MustNewConstMetric(c.capacityDesc, prometheus.GaugeValue, float64(capacities[lane]), string(lane))
+		ch <- prometheus.MustNewConstHistogram(c.fullnessDesc, fullness[lane].count, fullness[lane].sum,
+			fullness[lane].buckets, string(lane))
+	}
 }
 
 func NewMetrics() *Metrics {
@@ -35,6 +140,14 @@ func NewMetrics() *Metrics {
 		Help: "The total number of messages received over a websocket connection",
 	})
 
+	metrics.CodecCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "receptor_controller_websocket_codec_count",
+		Help: "The number of receptor websocket connections by the codec of their wire format",
+	}, []string{"codec"})
+
+	metrics.LaneQueueDepth = newLaneQueueDepthCollector()
+	prometheus.MustRegister(metrics.LaneQueueDepth)
+
 	return metrics
 }
 
@@ -0,0 +1,73 @@
+package ws
+
+import (
+	"strings"
+
+	"github.com/RedHatInsights/platform-receptor-controller/internal/controller"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func newTestLanes(depths map[controller.Lane]int, capacity int) map[controller.Lane]chan controller.ReceptorMessage {
+	lanes := make(map[controller.Lane]chan controller.ReceptorMessage, len(controller.Lanes))
+	for _, lane := range controller.Lanes {
+		lanes[lane] = make(chan controller.ReceptorMessage, capacity)
+		for i := 0; i < depths[lane]; i++ {
+			lanes[lane] <- controller.ReceptorMessage{}
+		}
+	}
+	return lanes
+}
+
+var _ = Describe("Lane queue depth metrics", func() {
+	Context("With two connections", func() {
+		It("Should aggregate the lanes of the connections", func() {
+			collector := newLaneQueueDepthCollector()
+			collector.Register(&rcClient{lanes: newTestLanes(map[controller.Lane]int{controller.LaneBulk: 4}, 4)})
+			collector.Register(&rcClient{lanes: newTestLanes(map[controller.Lane]int{controller.LaneBulk: 1}, 4)})
+
+			expected := `
+# HELP receptor_controller_websocket_lane_capacity The number of messages that the lane buffers of the websocket connections can hold by lane
+# TYPE receptor_controller_websocket_lane_capacity gauge
+receptor_controller_websocket_lane_capacity{lane="bulk"} 8
+receptor_controller_websocket_lane_capacity{lane="control"} 8
+receptor_controller_websocket_lane_capacity{lane="interactive"} 8
+# HELP receptor_controller_websocket_lane_fullness The fraction of the lane buffer of each websocket connection that is in use by lane
+# TYPE receptor_controller_websocket_lane_fullness histogram
+receptor_controller_websocket_lane_fullness_bucket{lane="bulk",le="0"} 0
+receptor_controller_websocket_lane_fullness_bucket{lane="bulk",le="0.25"} 1
+receptor_controller_websocket_lane_fullness_bucket{lane="bulk",le="0.5"} 1
+receptor_controller_websocket_lane_fullness_bucket{lane="bulk",le="0.75"} 1
+receptor_controller_websocket_lane_fullness_bucket{lane="bulk",le="1"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="bulk",le="+Inf"} 2
+receptor_controller_websocket_lane_fullness_sum{lane="bulk"} 1.25
+receptor_controller_websocket_lane_fullness_count{lane="bulk"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="control",le="0"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="control",le="0.25"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="control",le="0.5"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="control",le="0.75"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="control",le="1"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="control",le="+Inf"} 2
+receptor_controller_websocket_lane_fullness_sum{lane="control"} 0
+receptor_controller_websocket_lane_fullness_count{lane="control"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="interactive",le="0"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="interactive",le="0.25"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="interactive",le="0.5"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="interactive",le="0.75"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="interactive",le="1"} 2
+receptor_controller_websocket_lane_fullness_bucket{lane="interactive",le="+Inf"} 2
+receptor_controller_websocket_lane_fullness_sum{lane="interactive"} 0
+receptor_controller_websocket_lane_fullness_count{lane="interactive"} 2
+# HELP receptor_controller_websocket_lane_queue_depth The number of messages waiting to be sent over the websocket connections by lane
+# TYPE receptor_controller_websocket_lane_queue_depth gauge
+receptor_controller_websocket_lane_queue_depth{lane="bulk"} 5
+receptor_controller_websocket_lane_queue_depth{lane="control"} 0
+receptor_controller_websocket_lane_queue_depth{lane="interactive"} 0
+`
+
+			Expect(testutil.CollectAndCompare(collector, strings.NewReader(expected))).To(Succeed())
+		})
+	})
+})
@@ -25,6 +25,13 @@ type Principal interface {
 	GetAccount() string
 }
 
+// ClientPrincipal is implemented by the principals of the service to service
+// requests
+type ClientPrincipal interface {
+	Principal
+	GetClientID() string
+}
+
 type key int
 
 var principalKey key
@@ -39,3 +39,10 @@ func (ww *wrappedResponseWriter) WriteHeader(status int) {
 	ww.statusCode = status
 	ww.ResponseWriter.WriteHeader(status)
 }
+
+// Flush allows streaming handlers to flush the wrapped ResponseWriter
+func (ww *wrappedResponseWriter) Flush() {
+	if flusher, ok := ww.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -1,15 +1,18 @@
 package mesh_router
 
-import "log"
+import (
+	"container/heap"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
 
 type Edge struct {
-	Left  *string
-	Right *string
-	/*
-	   Left *node
-	   Right *node
-	*/
-	Cost int
+	Left  string `json:"left"`
+	Right string `json:"right"`
+	Cost  int    `json:"cost"`
 }
 
 // From here:  https://blog.golang.org/go-maps-in-action
@@ -17,44 +20,320 @@ type EdgeKey struct {
 	Left, Right string
 }
 
-/*
-type node struct {
-  Name string
+type Node struct {
+	ID           string      `json:"id"`
+	LastSeen     time.Time   `json:"last_seen"`
+	Capabilities interface{} `json:"capabilities,omitempty"`
+}
+
+// Topology is a point in time copy of the mesh known to a MeshRouter
+type Topology struct {
+	Version uint64 `json:"version"`
+	Nodes   []Node `json:"nodes"`
+	Edges   []Edge `json:"edges"`
 }
-*/
 
 type MeshRouter struct {
-	edges map[EdgeKey]int
-	nodes map[string]string
+	edges        map[EdgeKey]int
+	neighbors    map[string]map[string]int
+	nodes        map[string]time.Time
+	capabilities map[string]interface{}
+	version      uint64
+	nodeTTL      time.Duration
+	now          func() time.Time
+	sync.RWMutex
 }
 
-func NewMeshRouter() *MeshRouter {
+// NewMeshRouter creates a MeshRouter.  Nodes that have not been seen in a
+// topology update for longer than nodeTTL are removed from the mesh.  A
+// nodeTTL of 0 disables the expiration of nodes.
+func NewMeshRouter(nodeTTL time.Duration) *MeshRouter {
 	return &MeshRouter{
-		edges: make(map[EdgeKey]int),
-		nodes: make(map[string]string),
+		edges:        make(map[EdgeKey]int),
+		neighbors:    make(map[string]map[string]int),
+		nodes:        make(map[string]time.Time),
+		capabilities: make(map[string]interface{}),
+		nodeTTL:      nodeTTL,
+		now:          time.Now,
+	}
+}
+
+// Receptor links are bidirectional, so the key is normalized to make
+// (A, B) and (B, A) refer to the same edge
+func buildEdgeKey(left string, right string) EdgeKey {
+	if right < left {
+		left, right = right, left
 	}
+	return EdgeKey{Left: left, Right: right}
 }
 
-func (mr *MeshRouter) GetRouteToNode(from_node string, to_node string) []*string {
-	return nil
-	/*
-	   visited := make(map[string]struct{}{})
-	   for len(visited) < len(mr.nodes) {
-	   }
-	*/
+// GetRouteToNode returns the nodes along the lowest cost path between
+// from_node and to_node.  The returned route includes both from_node and
+// to_node.  nil is returned if to_node is not reachable.
+func (mr *MeshRouter) GetRouteToNode(from_node string, to_node string) []string {
+	path, found := mr.GetPathToNode(from_node, to_node)
+	if found == false {
+		return nil
+	}
+
+	return path.Nodes
+}
+
+// GetPathToNode uses Dijkstra's algorithm to locate the lowest cost path
+// between from_node and to_node.
+func (mr *MeshRouter) GetPathToNode(from_node string, to_node string) (Path, bool) {
+	mr.RLock()
+	defer mr.RUnlock()
+
+	if from_node == to_node {
+		return Path{Cost: 0, Nodes: []string{from_node}}, true
+	}
+
+	neighbors := mr.neighbors
+
+	visited := make(map[string]struct{})
+
+	h := &PathHeap{Path{Cost: 0, Nodes: []string{from_node}}}
+	heap.Init(h)
+
+	for h.Len() > 0 {
+		path := heap.Pop(h).(Path)
+		currentNode := path.Nodes[len(path.Nodes)-1]
+
+		if currentNode == to_node {
+			return path, true
+		}
+
+		if _, seen := visited[currentNode]; seen {
+			continue
+		}
+		visited[currentNode] = struct{}{}
+
+		for neighbor, cost := range neighbors[currentNode] {
+			if _, seen := visited[neighbor]; seen {
+				continue
+			}
+
+			nodes := make([]string, len(path.Nodes), len(path.Nodes)+1)
+			copy(nodes, path.Nodes)
+			nodes = append(nodes, neighbor)
+
+			heap.Push(h, Path{Cost: path.Cost + cost, Nodes: nodes})
+		}
+	}
+
+	return Path{}, false
+}
+
+// buildNeighborMap indexes the edges by node.  The index is rebuilt whenever
+// the edges change so that it is shared by every path lookup.
+func (mr *MeshRouter) buildNeighborMap() map[string]map[string]int {
+	neighbors := make(map[string]map[string]int)
+
+	addNeighbor := func(from string, to string, cost int) {
+		if _, exists := neighbors[from]; !exists {
+			neighbors[from] = make(map[string]int)
+		}
+		neighbors[from][to] = cost
+	}
+
+	for edge, cost := range mr.edges {
+		addNeighbor(edge.Left, edge.Right, cost)
+		addNeighbor(edge.Right, edge.Left, cost)
+	}
+
+	return neighbors
 }
 
 func (mr *MeshRouter) AddEdge(left string, right string, cost int) {
-	log.Println("** MeshRouter.AddEdge()")
-	edge_key := EdgeKey{Left: left, Right: right}
+	mr.Lock()
+	defer mr.Unlock()
+
+	now := mr.now()
+	mr.nodes[left] = now
+	mr.nodes[right] = now
+
+	edge_key := buildEdgeKey(left, right)
 	existing_cost, exists := mr.edges[edge_key]
 	if exists == false {
 		log.Println("Adding a new edge...")
 		mr.edges[edge_key] = cost
+		mr.version++
+		mr.neighbors = mr.buildNeighborMap()
 	} else if exists && cost < existing_cost {
 		log.Println("New cost is less than the existing cost...updating cost...")
 		mr.edges[edge_key] = cost
-	} else {
-		log.Println("Existing edge...no-op...")
+		mr.version++
+		mr.neighbors = mr.buildNeighborMap()
+	}
+}
+
+// UpdateTopology replaces the edges of the mesh with the edges from a
+// routing table update.  Edges that are no longer advertised are removed.
+// Every node that is part of an edge or that is in the seen list is marked
+// as seen.  Nodes that have not been seen within the node ttl are removed.
+func (mr *MeshRouter) UpdateTopology(edges []Edge, seen []string) {
+	mr.Lock()
+	defer mr.Unlock()
+
+	now := mr.now()
+	changed := false
+
+	updatedEdges := make(map[EdgeKey]int, len(edges))
+	for _, edge := range edges {
+		edge_key := buildEdgeKey(edge.Left, edge.Right)
+		existing_cost, exists := updatedEdges[edge_key]
+		if exists == false || edge.Cost < existing_cost {
+			updatedEdges[edge_key] = edge.Cost
+		}
+	}
+
+	for edge_key := range mr.edges {
+		if _, exists := updatedEdges[edge_key]; exists == false {
+			delete(mr.edges, edge_key)
+			changed = true
+		}
+	}
+
+	for edge_key, cost := range updatedEdges {
+		existing_cost, exists := mr.edges[edge_key]
+		if exists == false || existing_cost != cost {
+			mr.edges[edge_key] = cost
+			changed = true
+		}
+
+		changed = mr.markNodeSeen(edge_key.Left, now) || changed
+		changed = mr.markNodeSeen(edge_key.Right, now) || changed
+	}
+
+	for _, node := range seen {
+		changed = mr.markNodeSeen(node, now) || changed
 	}
+
+	changed = mr.expireNodes(now) || changed
+
+	if changed {
+		mr.version++
+		mr.neighbors = mr.buildNeighborMap()
+	}
+}
+
+// UpdateNodeCapabilities records the capabilities that a node has advertised
+func (mr *MeshRouter) UpdateNodeCapabilities(node string, capabilities interface{}) {
+	if capabilities == nil {
+		return
+	}
+
+	mr.Lock()
+	defer mr.Unlock()
+
+	changed := mr.markNodeSeen(node, mr.now())
+
+	if reflect.DeepEqual(mr.capabilities[node], capabilities) == false {
+		mr.capabilities[node] = capabilities
+		changed = true
+	}
+
+	if changed {
+		mr.version++
+	}
+}
+
+func (mr *MeshRouter) markNodeSeen(node string, now time.Time) bool {
+	_, exists := mr.nodes[node]
+	mr.nodes[node] = now
+	return exists == false
+}
+
+func (mr *MeshRouter) expireNodes(now time.Time) bool {
+	if mr.nodeTTL <= 0 {
+		return false
+	}
+
+	expired := false
+
+	for node, lastSeen := range mr.nodes {
+		if now.Sub(lastSeen) <= mr.nodeTTL {
+			continue
+		}
+
+		delete(mr.nodes, node)
+		delete(mr.capabilities, node)
+		expired = true
+
+		for edge_key := range mr.edges {
+			if edge_key.Left == node || edge_key.Right == node {
+				delete(mr.edges, edge_key)
+			}
+		}
+	}
+
+	return expired
+}
+
+// GetTopology returns a copy of the current mesh topology.  The nodes and
+// edges are sorted to make the result stable.
+func (mr *MeshRouter) GetTopology() Topology {
+	mr.RLock()
+	defer mr.RUnlock()
+
+	topology := Topology{
+		Version: mr.version,
+		Nodes:   make([]Node, 0, len(mr.nodes)),
+		Edges:   make([]Edge, 0, len(mr.edges)),
+	}
+
+	for node, lastSeen := range mr.nodes {
+		topology.Nodes = append(topology.Nodes, Node{
+			ID:           node,
+			LastSeen:     lastSeen,
+			Capabilities: mr.capabilities[node],
+		})
+	}
+
+	sort.Slice(topology.Nodes, func(i, j int) bool {
+		return topology.Nodes[i].ID < topology.Nodes[j].ID
+	})
+
+	for edge_key, cost := range mr.edges {
+		topology.Edges = append(topology.Edges, Edge{Left: edge_key.Left, Right: edge_key.Right, Cost: cost})
+	}
+
+	sort.Slice(topology.Edges, func(i, j int) bool {
+		if topology.Edges[i].Left != topology.Edges[j].Left {
+			return topology.Edges[i].Left < topology.Edges[j].Left
+		}
+		return topology.Edges[i].Right < topology.Edges[j].Right
+	})
+
+	return topology
+}
+
+// Router builds a MeshRouter from the edges of the topology.  The router can
+// be kept to locate any number of paths within this version of the topology.
+func (t *Topology) Router() *MeshRouter {
+	router := NewMeshRouter(0)
+	router.UpdateTopology(t.Edges, nil)
+	return router
+}
+
+// RouterExcluding builds a MeshRouter from the edges of the topology that do
+// not touch the node, so that no path passes through it.
+func (t *Topology) RouterExcluding(node string) *MeshRouter {
+	edges := make([]Edge, 0, len(t.Edges))
+	for _, edge := range t.Edges {
+		if edge.Left != node && edge.Right != node {
+			edges = append(edges, edge)
+		}
+	}
+
+	router := NewMeshRouter(0)
+	router.UpdateTopology(edges, nil)
+	return router
+}
+
+// GetPathToNode locates the lowest cost path between two nodes of the
+// topology.  Use Router when locating more than one path.
+func (t *Topology) GetPathToNode(from_node string, to_node string) (Path, bool) {
+	return t.Router().GetPathToNode(from_node, to_node)
 }
@@ -1,12 +1,169 @@
 package mesh_router
 
 import (
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestRouter(t *testing.T) {
-	router := NewMeshRouter()
+	router := NewMeshRouter(0)
 	router.AddEdge("A", "B", 4)
 	router.AddEdge("A", "C", 10)
 	router.AddEdge("B", "C", 1)
 }
+
+func TestGetRouteToNode(t *testing.T) {
+	router := NewMeshRouter(0)
+	router.AddEdge("A", "B", 4)
+	router.AddEdge("A", "C", 10)
+	router.AddEdge("B", "C", 1)
+	router.AddEdge("D", "C", 1)
+
+	tests := []struct {
+		from     string
+		to       string
+		expected []string
+	}{
+		{"A", "A", []string{"A"}},
+		{"A", "B", []string{"A", "B"}},
+		{"A", "C", []string{"A", "B", "C"}},
+		{"A", "D", []string{"A", "B", "C", "D"}},
+		{"D", "A", []string{"D", "C", "B", "A"}},
+		{"A", "Z", nil},
+	}
+
+	for _, tc := range tests {
+		route := router.GetRouteToNode(tc.from, tc.to)
+		if reflect.DeepEqual(route, tc.expected) == false {
+			t.Errorf("Route from %s to %s was incorrect, got: %v, want: %v.", tc.from, tc.to, route, tc.expected)
+		}
+	}
+}
+
+func TestAddEdgeKeepsLowestCost(t *testing.T) {
+	router := NewMeshRouter(0)
+	router.AddEdge("A", "B", 10)
+	router.AddEdge("A", "C", 4)
+	router.AddEdge("C", "B", 4)
+
+	route := router.GetRouteToNode("A", "B")
+	expected := []string{"A", "C", "B"}
+	if reflect.DeepEqual(route, expected) == false {
+		t.Fatalf("Route was incorrect, got: %v, want: %v.", route, expected)
+	}
+
+	// Adding the same edge in the reverse direction with a lower cost should update the edge
+	router.AddEdge("B", "A", 1)
+
+	route = router.GetRouteToNode("A", "B")
+	expected = []string{"A", "B"}
+	if reflect.DeepEqual(route, expected) == false {
+		t.Fatalf("Route was incorrect, got: %v, want: %v.", route, expected)
+	}
+}
+
+func TestUpdateTopologyRemovesMissingEdges(t *testing.T) {
+	router := NewMeshRouter(0)
+
+	router.UpdateTopology([]Edge{{"A", "B", 1}, {"B", "C", 1}}, []string{"A", "B"})
+	topology := router.GetTopology()
+	if topology.Version != 1 {
+		t.Fatalf("Version was incorrect, got: %d, want: %d.", topology.Version, 1)
+	}
+
+	if route := router.GetRouteToNode("A", "C"); reflect.DeepEqual(route, []string{"A", "B", "C"}) == false {
+		t.Fatalf("Route was incorrect, got: %v", route)
+	}
+
+	// The same update should not change the version
+	router.UpdateTopology([]Edge{{"B", "A", 1}, {"B", "C", 1}}, []string{"A", "B"})
+	if version := router.GetTopology().Version; version != 1 {
+		t.Fatalf("Version was incorrect, got: %d, want: %d.", version, 1)
+	}
+
+	router.UpdateTopology([]Edge{{"A", "B", 1}}, []string{"A", "B"})
+
+	topology = router.GetTopology()
+	if topology.Version != 2 {
+		t.Fatalf("Version was incorrect, got: %d, want: %d.", topology.Version, 2)
+	}
+
+	expectedEdges := []Edge{{"A", "B", 1}}
+	if reflect.DeepEqual(topology.Edges, expectedEdges) == false {
+		t.Fatalf("Edges were incorrect, got: %v, want: %v.", topology.Edges, expectedEdges)
+	}
+
+	if route := router.GetRouteToNode("A", "C"); route != nil {
+		t.Fatalf("Expected no route, got: %v", route)
+	}
+}
+
+func TestUpdateTopologyExpiresNodes(t *testing.T) {
+	now := time.Now()
+
+	router := NewMeshRouter(time.Minute)
+	router.now = func() time.Time { return now }
+
+	router.UpdateTopology([]Edge{{"A", "B", 1}, {"B", "C", 1}}, []string{"A", "B", "C"})
+
+	now = now.Add(30 * time.Second)
+	router.UpdateTopology([]Edge{{"A", "B", 1}}, []string{"A", "B"})
+
+	topology := router.GetTopology()
+	if len(topology.Nodes) != 3 {
+		t.Fatalf("Node C should not have expired yet, got: %v", topology.Nodes)
+	}
+
+	now = now.Add(45 * time.Second)
+	router.UpdateTopology([]Edge{{"A", "B", 1}}, []string{"A", "B"})
+
+	topology = router.GetTopology()
+	expectedNodes := []Node{{ID: "A", LastSeen: now}, {ID: "B", LastSeen: now}}
+	if reflect.DeepEqual(topology.Nodes, expectedNodes) == false {
+		t.Fatalf("Nodes were incorrect, got: %v, want: %v.", topology.Nodes, expectedNodes)
+	}
+}
+
+func TestUpdateNodeCapabilities(t *testing.T) {
+	router := NewMeshRouter(0)
+
+	router.UpdateTopology([]Edge{{"A", "B", 1}}, []string{"A", "B"})
+
+	capabilities := map[string]interface{}{"max_work_threads": 12}
+	router.UpdateNodeCapabilities("B", capabilities)
+	router.UpdateNodeCapabilities("B", capabilities)
+
+	topology := router.GetTopology()
+	if topology.Version != 2 {
+		t.Fatalf("Version was incorrect, got: %d, want: %d.", topology.Version, 2)
+	}
+
+	if topology.Nodes[0].Capabilities != nil {
+		t.Fatalf("Node A should not have capabilities, got: %v", topology.Nodes[0].Capabilities)
+	}
+
+	if reflect.DeepEqual(topology.Nodes[1].Capabilities, capabilities) == false {
+		t.Fatalf("Capabilities were incorrect, got: %v, want: %v.", topology.Nodes[1].Capabilities, capabilities)
+	}
+}
+
+func TestTopologyGetPathToNode(t *testing.T) {
+	topology := Topology{
+		Edges: []Edge{{"A", "B", 4}, {"A", "C", 10}, {"B", "C", 1}},
+	}
+
+	path, found := topology.GetPathToNode("A", "C")
+	if found == false {
+		t.Fatalf("Expected to find a path")
+	}
+
+	expected := Path{Cost: 5, Nodes: []string{"A", "B", "C"}}
+	if reflect.DeepEqual(path, expected) == false {
+		t.Fatalf("Path was incorrect, got: %v, want: %v.", path, expected)
+	}
+
+	if _, found := topology.GetPathToNode("A", "Z"); found {
+		t.Fatalf("Expected not to find a path")
+	}
+}
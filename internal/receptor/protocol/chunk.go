@@ -0,0 +1,252 @@
+package protocol
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	errInvalidChunk          = errors.New("invalid chunk")
+	errDuplicateChunk        = errors.New("duplicate chunk")
+	errTransferTooLarge      = errors.New("transfer exceeds the maximum transfer size")
+	errTransferSizeMismatch  = errors.New("transfer size does not match the size of the chunks")
+	errTransferChecksumError = errors.New("transfer checksum mismatch")
+	errTransferExpired       = errors.New("transfer expired")
+	errInvalidTransfer       = errors.New("transfer payload is not valid json")
+)
+
+// Chunk identifies a payload message as one piece of a larger payload.  The
+// raw payload of each chunk is a base64 encoded slice of the json encoded
+// payload.  Every chunk of a transfer carries the size and the SHA-256 of the
+// complete payload so that the receiver can verify the reassembled payload.
+type Chunk struct {
+	TransferID string `json:"transfer_id"`
+	Index      int    `json:"index"`
+	Count      int    `json:"count"`
+	Size       int    `json:"size"`
+	SHA256     string `json:"sha256"`
+}
+
+// SplitPayloadMessage splits a payload message whose json encoded payload is
+// larger than chunkSize into ordered chunks that share a transfer id.  The
+// message is returned as is if it does not need to be split or if chunkSize
+// is not positive.
+func SplitPayloadMessage(payloadMessage *PayloadMessage, chunkSize int) ([]*PayloadMessage, error) {
+	if chunkSize <= 0 {
+		return []*PayloadMessage{payloadMessage}, nil
+	}
+
+	payload, err := json.Marshal(payloadMessage.Data.RawPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) <= chunkSize {
+		return []*PayloadMessage{payloadMessage}, nil
+	}
+
+	transferID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := sha256.Sum256(payload)
+
+	count := (len(payload) + chunkSize - 1) / chunkSize
+	chunks := make([]*PayloadMessage, 0, count)
+
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		data := payloadMessage.Data
+		data.RawPayload = payload[i*chunkSize : end]
+		data.Chunk = &Chunk{
+			TransferID: transferID.String(),
+			Index:      i,
+			Count:      count,
+			Size:       len(payload),
+			SHA256:     hex.EncodeToString(checksum[:]),
+		}
+
+		chunks = append(chunks, &PayloadMessage{RoutingInfo: payloadMessage.RoutingInfo, Data: data})
+	}
+
+	metrics.payloadChunksSent.Add(float64(count))
+
+	return chunks, nil
+}
+
+type transfer struct {
+	first    *PayloadMessage
+	chunks   map[int][]byte
+	received int
+	started  time.Time
+}
+
+// ChunkAssembler reassembles the chunked payload messages received over a
+// connection.  Transfers that are not completed within the timeout are
+// discarded.
+type ChunkAssembler struct {
+	maxTransferSize int
+	timeout         time.Duration
+	now             func() time.Time
+
+	transfers map[string]*transfer
+	sync.Mutex
+}
+
+func NewChunkAssembler(maxTransferSize int, timeout time.Duration) *ChunkAssembler {
+	return &ChunkAssembler{
+		maxTransferSize: maxTransferSize,
+		timeout:         timeout,
+		now:             time.Now,
+		transfers:       make(map[string]*transfer),
+	}
+}
+
+// Add adds a payload message to its transfer.  The reassembled message is
+// returned once every chunk of the transfer has been received.  Messages
+// that are not chunks are returned as is.  A transfer that fails its
+// integrity checks is discarded and an error is returned.
+func (a *ChunkAssembler) Add(payloadMessage *PayloadMessage) (*PayloadMessage, bool, error) {
+	chunk := payloadMessage.Data.Chunk
+	if chunk == nil {
+		return payloadMessage, true, nil
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	a.expireTransfers()
+
+	data, err := a.validateChunk(payloadMessage)
+	if err != nil {
+		delete(a.transfers, chunk.TransferID)
+		return nil, false, a.failed(err)
+	}
+
+	t, exists := a.transfers[chunk.TransferID]
+	if !exists {
+		t = &transfer{first: payloadMessage, chunks: make(map[int][]byte), started: a.now()}
+		a.transfers[chunk.TransferID] = t
+	}
+
+	if _, duplicate := t.chunks[chunk.Index]; duplicate {
+		delete(a.transfers, chunk.TransferID)
+		return nil, false, a.failed(errDuplicateChunk)
+	}
+
+	t.chunks[chunk.Index] = data
+	t.received += len(data)
+
+	if t.received > chunk.Size {
+		delete(a.transfers, chunk.TransferID)
+		return nil, false, a.failed(errTransferSizeMismatch)
+	}
+
+	if len(t.chunks) < chunk.Count {
+		return nil, false, nil
+	}
+
+	delete(a.transfers, chunk.TransferID)
+
+	assembled, err := t.assemble()
+	if err != nil {
+		return nil, false, a.failed(err)
+	}
+
+	metrics.payloadTransfersAssembled.Inc()
+
+	return assembled, true, nil
+}
+
+func (a *ChunkAssembler) validateChunk(payloadMessage *PayloadMessage) ([]byte, error) {
+	chunk := payloadMessage.Data.Chunk
+
+	// Every chunk carries at least one byte of the payload
+	if chunk.TransferID == "" || chunk.Count <= 0 || chunk.Count > chunk.Size ||
+		chunk.Index < 0 || chunk.Index >= chunk.Count {
+		return nil, errInvalidChunk
+	}
+
+	if a.maxTransferSize > 0 && chunk.Size > a.maxTransferSize {
+		return nil, errTransferTooLarge
+	}
+
+	if t, exists := a.transfers[chunk.TransferID]; exists {
+		first := t.first.Data.Chunk
+		if first.Count != chunk.Count || first.Size != chunk.Size || first.SHA256 != chunk.SHA256 {
+			return nil, errInvalidChunk
+		}
+	}
+
+	encoded, ok := payloadMessage.Data.RawPayload.(string)
+	if !ok {
+		return nil, errInvalidChunk
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errInvalidChunk
+	}
+
+	return data, nil
+}
+
+func (a *ChunkAssembler) expireTransfers() {
+	if a.timeout <= 0 {
+		return
+	}
+
+	for transferID, t := range a.transfers {
+		if a.now().Sub(t.started) > a.timeout {
+			delete(a.transfers, transferID)
+			a.failed(errTransferExpired)
+		}
+	}
+}
+
+func (a *ChunkAssembler) failed(err error) error {
+	metrics.payloadTransferFailures.With(prometheus.Labels{"reason": err.Error()}).Inc()
+	return err
+}
+
+func (t *transfer) assemble() (*PayloadMessage, error) {
+	chunk := t.first.Data.Chunk
+
+	payload := make([]byte, 0, chunk.Size)
+	for i := 0; i < chunk.Count; i++ {
+		payload = append(payload, t.chunks[i]...)
+	}
+
+	if len(payload) != chunk.Size {
+		return nil, errTransferSizeMismatch
+	}
+
+	checksum := sha256.Sum256(payload)
+	if hex.EncodeToString(checksum[:]) != chunk.SHA256 {
+		return nil, errTransferChecksumError
+	}
+
+	var rawPayload interface{}
+	if err := json.Unmarshal(payload, &rawPayload); err != nil {
+		return nil, errInvalidTransfer
+	}
+
+	data := t.first.Data
+	data.RawPayload = rawPayload
+	data.Chunk = nil
+
+	return &PayloadMessage{RoutingInfo: t.first.RoutingInfo, Data: data}, nil
+}
@@ -0,0 +1,182 @@
+package protocol
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func buildLargePayloadMessage(t *testing.T, payloadSize int) *PayloadMessage {
+	messageID, _ := uuid.NewRandom()
+	message, err := BuildPayloadMessage(messageID, "node-a", "node-b", []string{"node-b"},
+		"response", "worker:action", map[string]interface{}{"data": strings.Repeat("x", payloadSize)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return message.(*PayloadMessage)
+}
+
+// sendChunks passes the chunks through the wire format so that the raw
+// payloads look like they do when they are read off of the websocket
+func sendChunks(t *testing.T, chunks []*PayloadMessage) []*PayloadMessage {
+	received := make([]*PayloadMessage, 0, len(chunks))
+	for _, chunk := range chunks {
+		w := new(bytes.Buffer)
+		if err := WriteMessage(w, chunk); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		message, err := ReadMessage(w)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		received = append(received, message.(*PayloadMessage))
+	}
+	return received
+}
+
+func TestSplitPayloadMessageSmallPayload(t *testing.T) {
+	payloadMessage := buildLargePayloadMessage(t, 10)
+
+	chunks, err := SplitPayloadMessage(payloadMessage, 1024)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(chunks) != 1 || chunks[0] != payloadMessage {
+		t.Fatalf("expected the message to be returned as is, got: %v", chunks)
+	}
+}
+
+func TestSplitAndAssemblePayloadMessage(t *testing.T) {
+	payloadMessage := buildLargePayloadMessage(t, 10000)
+
+	chunks, err := SplitPayloadMessage(payloadMessage, 1024)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(chunks) != 10 {
+		t.Fatalf("expected 10 chunks, got: %d", len(chunks))
+	}
+
+	received := sendChunks(t, chunks)
+
+	// Deliver the chunks out of order
+	received[0], received[9] = received[9], received[0]
+
+	assembler := NewChunkAssembler(1024*1024, time.Minute)
+
+	for i, chunk := range received {
+		assembled, complete, err := assembler.Add(chunk)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if i < len(received)-1 {
+			if complete {
+				t.Fatalf("transfer completed early after %d chunks", i+1)
+			}
+			continue
+		}
+
+		if !complete {
+			t.Fatalf("expected the transfer to be complete")
+		}
+
+		if assembled.Data.Chunk != nil {
+			t.Fatalf("expected the assembled message to not be a chunk, got: %v", assembled.Data.Chunk)
+		}
+
+		if assembled.Data.MessageID != payloadMessage.Data.MessageID {
+			t.Fatalf("message id was incorrect, got: %s, want: %s", assembled.Data.MessageID, payloadMessage.Data.MessageID)
+		}
+
+		if !reflect.DeepEqual(assembled.Data.RawPayload, payloadMessage.Data.RawPayload) {
+			t.Fatalf("reassembled payload does not match the original payload")
+		}
+	}
+
+	if len(assembler.transfers) != 0 {
+		t.Fatalf("expected the transfer to be removed, got: %v", assembler.transfers)
+	}
+}
+
+func TestChunkAssemblerErrors(t *testing.T) {
+	subTests := map[string]struct {
+		maxTransferSize int
+		corrupt         func([]*PayloadMessage) []*PayloadMessage
+		expectedError   error
+	}{
+		"checksum_mismatch": {1024 * 1024, func(chunks []*PayloadMessage) []*PayloadMessage {
+			for _, chunk := range chunks {
+				chunk.Data.Chunk.SHA256 = strings.Repeat("0", 64)
+			}
+			return chunks
+		}, errTransferChecksumError},
+		"duplicate_chunk": {1024 * 1024, func(chunks []*PayloadMessage) []*PayloadMessage {
+			return append([]*PayloadMessage{chunks[0]}, chunks...)
+		}, errDuplicateChunk},
+		"inconsistent_chunk": {1024 * 1024, func(chunks []*PayloadMessage) []*PayloadMessage {
+			chunks[1].Data.Chunk.Count = 3
+			return chunks
+		}, errInvalidChunk},
+		"invalid_index": {1024 * 1024, func(chunks []*PayloadMessage) []*PayloadMessage {
+			chunks[0].Data.Chunk.Index = chunks[0].Data.Chunk.Count
+			return chunks
+		}, errInvalidChunk},
+		"too_large": {1024, nil, errTransferTooLarge},
+	}
+
+	for name, test := range subTests {
+		t.Run(name, func(t *testing.T) {
+			chunks, _ := SplitPayloadMessage(buildLargePayloadMessage(t, 2000), 1024)
+			chunks = sendChunks(t, chunks)
+			if test.corrupt != nil {
+				chunks = test.corrupt(chunks)
+			}
+
+			assembler := NewChunkAssembler(test.maxTransferSize, time.Minute)
+
+			var err error
+			for _, chunk := range chunks {
+				if _, _, err = assembler.Add(chunk); err != nil {
+					break
+				}
+			}
+
+			if err != test.expectedError {
+				t.Fatalf("expected error %v, got: %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestChunkAssemblerExpiresTransfers(t *testing.T) {
+	chunks, _ := SplitPayloadMessage(buildLargePayloadMessage(t, 2000), 1024)
+	chunks = sendChunks(t, chunks)
+
+	now := time.Now()
+	assembler := NewChunkAssembler(1024*1024, time.Minute)
+	assembler.now = func() time.Time { return now }
+
+	if _, complete, err := assembler.Add(chunks[0]); complete || err != nil {
+		t.Fatalf("unexpected result, complete: %v, err: %v", complete, err)
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	// The first chunk has expired so the transfer can never complete
+	if _, complete, err := assembler.Add(chunks[1]); complete || err != nil {
+		t.Fatalf("unexpected result, complete: %v, err: %v", complete, err)
+	}
+
+	if len(assembler.transfers) != 1 || len(assembler.transfers[chunks[1].Data.Chunk.TransferID].chunks) != 1 {
+		t.Fatalf("expected the expired chunk to be discarded, got: %v", assembler.transfers)
+	}
+}
@@ -0,0 +1,150 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Codec reads and writes messages in one of the receptor wire formats.  The
+// codec of a connection is picked from the websocket subprotocol or, if the
+// peer did not ask for a subprotocol, by sniffing the first frame that the
+// peer sends.
+type Codec interface {
+	// Name is the websocket subprotocol that selects the codec
+	Name() string
+
+	// Sniff reports whether the first bytes of a frame are in the codec's
+	// wire format
+	Sniff(prefix []byte) bool
+
+	// ReadMessage reads a message.  Only payload frames that were
+	// compressed with the negotiated compression are decompressed.
+	ReadMessage(r io.Reader, compression Compression) (Message, error)
+	WriteMessage(w io.Writer, message Message, compression Compression) error
+}
+
+// SessionCodec is implemented by codecs that keep state for a connection.
+// The codec that is picked for a connection is a new session of the
+// registered codec.
+type SessionCodec interface {
+	Codec
+	NewSession() Codec
+}
+
+// newSession returns the codec to use for a new connection
+func newSession(codec Codec) Codec {
+	if sessionCodec, ok := codec.(SessionCodec); ok {
+		return sessionCodec.NewSession()
+	}
+	return codec
+}
+
+// SniffLength is the number of bytes of the first frame that are passed to
+// the codecs' Sniff methods
+const SniffLength = FrameHeaderLength
+
+const LegacyCodecName = "receptor-legacy"
+
+var _ Codec = LegacyCodec{}
+
+// LegacyCodec speaks the framing of the python receptor: a FrameHeader
+// followed by the frame data with HI and ROUTE json commands and payload
+// messages sent as a header frame followed by a payload frame.
+type LegacyCodec struct{}
+
+func (LegacyCodec) Name() string {
+	return LegacyCodecName
+}
+
+func (LegacyCodec) Sniff(prefix []byte) bool {
+	if len(prefix) < 1 {
+		return false
+	}
+
+	f := FrameHeader{Type: frameType(prefix[0])}
+	return f.isValidType()
+}
+
+func (LegacyCodec) ReadMessage(r io.Reader, compression Compression) (Message, error) {
+	return ReadCompressedMessage(r, compression)
+}
+
+func (LegacyCodec) WriteMessage(w io.Writer, message Message, compression Compression) error {
+	return WriteCompressedMessage(w, message, compression)
+}
+
+var (
+	// codecs are the codecs that were registered in addition to the
+	// legacy codec.  The native receptor (netceptor) codec is always
+	// registered.
+	codecs     = []Codec{NewNetceptorCodec()}
+	codecsLock sync.RWMutex
+)
+
+// RegisterCodec adds a codec for another receptor wire format.  The codecs
+// are sniffed in the order that they were registered before falling back to
+// the legacy codec.
+func RegisterCodec(codec Codec) error {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+
+	for _, c := range allCodecs() {
+		if c.Name() == codec.Name() {
+			return fmt.Errorf("codec (%s) is already registered", codec.Name())
+		}
+	}
+
+	codecs = append(codecs, codec)
+
+	return nil
+}
+
+// allCodecs returns the registered codecs followed by the legacy codec.  The
+// caller must hold codecsLock.
+func allCodecs() []Codec {
+	all := make([]Codec, 0, len(codecs)+1)
+	all = append(all, codecs...)
+	return append(all, LegacyCodec{})
+}
+
+// Subprotocols lists the websocket subprotocols of the registered codecs
+func Subprotocols() []string {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+
+	names := make([]string, 0, len(codecs)+1)
+	for _, c := range allCodecs() {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+// CodecForSubprotocol returns the codec that was selected by the websocket
+// subprotocol
+func CodecForSubprotocol(subprotocol string) (Codec, bool) {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+
+	for _, c := range allCodecs() {
+		if c.Name() == subprotocol {
+			return newSession(c), true
+		}
+	}
+	return nil, false
+}
+
+// SniffCodec returns the first registered codec that recognizes the first
+// bytes of a frame.  The legacy codec is returned if none of them do so that
+// the legacy framing's errors are reported.
+func SniffCodec(prefix []byte) Codec {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+
+	for _, c := range codecs {
+		if c.Sniff(prefix) {
+			return newSession(c)
+		}
+	}
+	return LegacyCodec{}
+}
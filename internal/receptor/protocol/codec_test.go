@@ -0,0 +1,104 @@
+package protocol
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type testCodec struct{}
+
+func (testCodec) Name() string {
+	return "test-codec"
+}
+
+func (testCodec) Sniff(prefix []byte) bool {
+	return bytes.HasPrefix(prefix, []byte("TEST"))
+}
+
+func (testCodec) ReadMessage(r io.Reader, compression Compression) (Message, error) {
+	return nil, nil
+}
+
+func (testCodec) WriteMessage(w io.Writer, message Message, compression Compression) error {
+	return nil
+}
+
+func registerTestCodec(t *testing.T) {
+	codecsLock.RLock()
+	registered := codecs
+	codecsLock.RUnlock()
+
+	if err := RegisterCodec(testCodec{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Cleanup(func() {
+		codecsLock.Lock()
+		defer codecsLock.Unlock()
+		codecs = registered
+	})
+}
+
+func TestLegacyCodec(t *testing.T) {
+	var codec Codec = LegacyCodec{}
+
+	hiMessage := &HiMessage{Command: "HI", ID: "node-a"}
+
+	w := new(bytes.Buffer)
+	if err := codec.WriteMessage(w, hiMessage, CompressionNone); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !codec.Sniff(w.Bytes()[:SniffLength]) {
+		t.Fatalf("expected the legacy codec to recognize its own frame")
+	}
+
+	message, err := codec.ReadMessage(w, CompressionNone)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if message.(*HiMessage).ID != "node-a" {
+		t.Fatalf("unexpected message, got: %v", message)
+	}
+}
+
+func TestSniffCodec(t *testing.T) {
+	registerTestCodec(t)
+
+	if codec := SniffCodec([]byte("TEST frame")); codec.Name() != "test-codec" {
+		t.Fatalf("expected the test codec, got: %s", codec.Name())
+	}
+
+	legacyFrame := new(bytes.Buffer)
+	WriteMessage(legacyFrame, &HiMessage{Command: "HI", ID: "node-a"})
+
+	if codec := SniffCodec(legacyFrame.Bytes()[:SniffLength]); codec.Name() != LegacyCodecName {
+		t.Fatalf("expected the legacy codec, got: %s", codec.Name())
+	}
+
+	if codec := SniffCodec(nil); codec.Name() != LegacyCodecName {
+		t.Fatalf("expected the legacy codec as the fallback, got: %s", codec.Name())
+	}
+}
+
+func TestCodecForSubprotocol(t *testing.T) {
+	registerTestCodec(t)
+
+	if err := RegisterCodec(testCodec{}); err == nil {
+		t.Fatalf("expected an error registering a duplicate codec")
+	}
+
+	if subprotocols := Subprotocols(); len(subprotocols) != 3 || subprotocols[0] != NetceptorCodecName || subprotocols[1] != "test-codec" || subprotocols[2] != LegacyCodecName {
+		t.Fatalf("unexpected subprotocols, got: %v", subprotocols)
+	}
+
+	if codec, ok := CodecForSubprotocol(LegacyCodecName); !ok || codec.Name() != LegacyCodecName {
+		t.Fatalf("expected the legacy codec, got: %v", codec)
+	}
+
+	if _, ok := CodecForSubprotocol("unknown"); ok {
+		t.Fatalf("expected no codec for an unknown subprotocol")
+	}
+}
@@ -0,0 +1,131 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Compression is the algorithm used to compress the payload frames of a
+// connection.  The algorithm is negotiated during the handshake.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+var (
+	errFrameTooLarge           = errors.New("decompressed frame is too large")
+	errUnnegotiatedCompression = errors.New("frame is compressed with an algorithm that was not negotiated")
+
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	zstdEncoder, _ = zstd.NewWriter(nil)
+)
+
+// zstdMaxWindowSize is the largest window that a zstd frame may ask the
+// decoder to allocate.  It is the window size that the zstd format
+// recommends decoders to support.
+const zstdMaxWindowSize = 8 * 1024 * 1024
+
+func ParseCompression(compression string) (Compression, error) {
+	switch Compression(compression) {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return Compression(compression), nil
+	}
+
+	return CompressionNone, fmt.Errorf("invalid compression (%s)", compression)
+}
+
+func compress(compression Compression, data []byte) ([]byte, error) {
+	switch compression {
+	case CompressionGzip:
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	}
+
+	return data, nil
+}
+
+// decompress detects compressed frame data by its magic number.  Only the
+// compression that was negotiated for the connection is decompressed and the
+// decompressed data is limited to the maximum frame length so that a small
+// frame cannot expand into an unbounded amount of memory.  The json encoded
+// frames of peers that do not compress are returned as is.
+func decompress(data []byte, negotiated Compression) ([]byte, Compression, error) {
+	var compression Compression
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		compression = CompressionGzip
+	case bytes.HasPrefix(data, zstdMagic):
+		compression = CompressionZstd
+	default:
+		return data, CompressionNone, nil
+	}
+
+	if compression != negotiated {
+		return nil, compression, fmt.Errorf("%w: %s", errUnnegotiatedCompression, compression)
+	}
+
+	limit := atomic.LoadInt64(&maxFrameLength)
+
+	var r io.Reader
+	switch compression {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, compression, err
+		}
+		r = gr
+	case CompressionZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data),
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderLowmem(true),
+			zstd.WithDecoderMaxWindow(zstdMaxWindowSize))
+		if err != nil {
+			return nil, compression, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	decompressed, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, compression, err
+	}
+
+	if int64(len(decompressed)) > limit {
+		return nil, compression, errFrameTooLarge
+	}
+
+	return decompressed, compression, nil
+}
+
+func observeCompression(compression Compression, direction string, uncompressedSize, compressedSize int) {
+	if compression == CompressionNone || compressedSize == 0 || compressedSize >= uncompressedSize {
+		return
+	}
+
+	labels := prometheus.Labels{"compression": string(compression), "direction": direction}
+	metrics.payloadCompressionRatio.With(labels).Observe(float64(uncompressedSize) / float64(compressedSize))
+	metrics.payloadCompressionBytesSaved.With(labels).Add(float64(uncompressedSize - compressedSize))
+}
@@ -0,0 +1,119 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWriteCompressedMessage(t *testing.T) {
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(string(compression)+"_compression", func(t *testing.T) {
+			payloadMessage := buildLargePayloadMessage(t, 10000)
+
+			w := new(bytes.Buffer)
+			if err := WriteCompressedMessage(w, payloadMessage, compression); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			uncompressed := new(bytes.Buffer)
+			WriteMessage(uncompressed, payloadMessage)
+
+			if compression != CompressionNone && w.Len() >= uncompressed.Len() {
+				t.Fatalf("expected the message to be compressed, got: %d bytes, uncompressed: %d bytes", w.Len(), uncompressed.Len())
+			}
+
+			message, err := ReadCompressedMessage(w, compression)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			received := message.(*PayloadMessage)
+			if !reflect.DeepEqual(received.Data.RawPayload, payloadMessage.Data.RawPayload) {
+				t.Fatalf("payload does not match the original payload")
+			}
+		})
+	}
+}
+
+func TestWriteCompressedMessageSkipsSmallPayloads(t *testing.T) {
+	payloadMessage := buildLargePayloadMessage(t, 0)
+
+	compressed := new(bytes.Buffer)
+	WriteCompressedMessage(compressed, payloadMessage, CompressionGzip)
+
+	uncompressed := new(bytes.Buffer)
+	WriteMessage(uncompressed, payloadMessage)
+
+	if compressed.Len() > uncompressed.Len() {
+		t.Fatalf("expected the payload to be sent uncompressed, got: %d bytes, want: %d bytes", compressed.Len(), uncompressed.Len())
+	}
+}
+
+func TestDecompressLimitsFrameSize(t *testing.T) {
+	SetMaxFrameLength(1024)
+	t.Cleanup(func() { SetMaxFrameLength(1 * 1024 * 1024) })
+
+	for _, compression := range []Compression{CompressionGzip, CompressionZstd} {
+		t.Run(string(compression)+"_compression", func(t *testing.T) {
+			compressed, err := compress(compression, make([]byte, 1025))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if _, _, err := decompress(compressed, compression); err != errFrameTooLarge {
+				t.Fatalf("expected errFrameTooLarge, got: %v", err)
+			}
+
+			compressed, _ = compress(compression, make([]byte, 1024))
+			if _, _, err := decompress(compressed, compression); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestReadMessageRejectsUnnegotiatedCompression(t *testing.T) {
+	payloadMessage := buildLargePayloadMessage(t, 10000)
+
+	for _, tc := range []struct {
+		written    Compression
+		negotiated Compression
+	}{
+		{CompressionGzip, CompressionNone},
+		{CompressionZstd, CompressionNone},
+		{CompressionGzip, CompressionZstd},
+		{CompressionZstd, CompressionGzip},
+	} {
+		t.Run(string(tc.written)+"_"+string(tc.negotiated), func(t *testing.T) {
+			w := new(bytes.Buffer)
+			WriteCompressedMessage(w, payloadMessage, tc.written)
+
+			if _, err := ReadCompressedMessage(w, tc.negotiated); !errors.Is(err, errUnnegotiatedCompression) {
+				t.Fatalf("expected errUnnegotiatedCompression, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestReadCompressedMessageAcceptsUncompressedFrames(t *testing.T) {
+	payloadMessage := buildLargePayloadMessage(t, 10000)
+
+	w := new(bytes.Buffer)
+	WriteMessage(w, payloadMessage)
+
+	if _, err := ReadCompressedMessage(w, CompressionZstd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	if _, err := ParseCompression("lz4"); err == nil {
+		t.Fatalf("expected an error for an unsupported compression")
+	}
+
+	if compression, err := ParseCompression("zstd"); err != nil || compression != CompressionZstd {
+		t.Fatalf("unexpected result, compression: %s, err: %v", compression, err)
+	}
+}
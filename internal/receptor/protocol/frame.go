@@ -7,14 +7,31 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"sync/atomic"
+
+	"github.com/google/uuid"
 )
 
 var (
 	errInvalidFrameType  = errors.New("invalid frame type")
 	errFrameTooShort     = errors.New("frame too short")
 	errFrameDataTooShort = errors.New("frame data too short")
+	errMismatchedFrames  = errors.New("header frame and payload frame belong to different messages")
+	errFrameTooLong      = errors.New("frame length exceeds the maximum message size")
 )
 
+// maxFrameLength caps the length of the frame data that is read so that the
+// length in a frame header cannot make the reader allocate an unbounded
+// amount of memory.  It defaults to the default websocket message size limit.
+var maxFrameLength int64 = 1 * 1024 * 1024
+
+// SetMaxFrameLength sets the maximum length of the frame data that is read.
+// A frame cannot be larger than the websocket message that carries it so
+// this is normally the websocket message size limit.
+func SetMaxFrameLength(length int64) {
+	atomic.StoreInt64(&maxFrameLength, length)
+}
+
 type frameType int8
 
 const (
@@ -35,6 +52,27 @@ func (mid messageID) String() string {
 	)
 }
 
+func newMessageID() (messageID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return messageID{}, err
+	}
+	return messageID(id), nil
+}
+
+// lastFrameID is the id of the last frame that was written.  Every frame
+// gets its own id.  The frames of a message share the message's MsgID.
+var lastFrameID uint32
+
+func nextFrameID() uint32 {
+	id := atomic.AddUint32(&lastFrameID, 1)
+	if id == 0 {
+		// Zero is skipped when the counter wraps around
+		id = atomic.AddUint32(&lastFrameID, 1)
+	}
+	return id
+}
+
 const FrameHeaderLength int = 26
 
 type FrameHeader struct {
@@ -106,6 +144,11 @@ func readFrame(r io.Reader) (*FrameHeader, error) {
 }
 
 func readFrameData(r io.Reader, dataLength uint32) ([]byte, error) {
+	if int64(dataLength) > atomic.LoadInt64(&maxFrameLength) {
+		log.Printf("Frame data length (%d) exceeds the maximum frame length (%d)", dataLength, atomic.LoadInt64(&maxFrameLength))
+		return nil, errFrameTooLong
+	}
+
 	buf := make([]byte, dataLength)
 	_, err := io.ReadFull(r, buf)
 	if err != nil {
@@ -116,7 +159,7 @@ func readFrameData(r io.Reader, dataLength uint32) ([]byte, error) {
 	return buf, nil
 }
 
-func parseFrameData(r io.Reader, t frameType, dataLength uint32) (Message, error) {
+func parseFrameData(r io.Reader, t frameType, dataLength uint32, negotiated Compression) (Message, error) {
 
 	buf, err := readFrameData(r, dataLength)
 	if err != nil {
@@ -124,6 +167,17 @@ func parseFrameData(r io.Reader, t frameType, dataLength uint32) (Message, error
 		return nil, err
 	}
 
+	if t == PayloadFrameType {
+		var compression Compression
+		compressedLength := len(buf)
+		buf, compression, err = decompress(buf, negotiated)
+		if err != nil {
+			log.Println("Unable to decompress the payload frame: ", err)
+			return nil, err
+		}
+		observeCompression(compression, "received", len(buf), compressedLength)
+	}
+
 	var m Message
 	switch t {
 	case HeaderFrameType:
@@ -149,9 +203,9 @@ func parseFrameData(r io.Reader, t frameType, dataLength uint32) (Message, error
 	return m, nil
 }
 
-func writeFrame(w io.Writer, ftype frameType, frameData []byte) error {
+func writeFrame(w io.Writer, ftype frameType, msgID messageID, frameData []byte) error {
 
-	frameHeader := FrameHeader{Version: 1, ID: 1} // FIXME: pass this in
+	frameHeader := FrameHeader{Version: 1, ID: nextFrameID(), MsgID: msgID}
 	frameHeader.Type = ftype
 	frameHeader.Length = uint32(len(frameData))
 
@@ -0,0 +1,96 @@
+//go:build go1.18
+// +build go1.18
+
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The seed corpus for the fuzz targets lives in testdata/fuzz.  It holds
+// frames in the format that the python receptor writes them.  New crashers
+// that are found by go test -fuzz are written to the same directory and
+// should be checked in along with the fix.
+
+func addSeedFrames(f *testing.F) {
+	hi, _ := (&HiMessage{Command: "HI", ID: "node-a", ExpireTimestamp: 1571507551.7103958}).marshal()
+	f.Add(generateFrameByteArray(CommandFrameType, 1, hi))
+
+	var w bytes.Buffer
+	WriteMessage(&w, &RouteTableMessage{Command: "ROUTE",
+		ID:    "node-a",
+		Edges: [][]interface{}{{"node-a", "node-b", 1}},
+		Seen:  []string{"node-a", "node-b"}})
+	f.Add(w.Bytes())
+
+	// The compressed payloads are rejected since the fuzz targets read
+	// without a negotiated compression
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		var w bytes.Buffer
+		payloadMessage, _ := BuildPayloadMessage([16]byte{}, "node-a", "node-b", []string{"node-b"},
+			"response", "worker:action", map[string]interface{}{"data": "abc"})
+		WriteCompressedMessage(&w, payloadMessage, compression)
+		f.Add(w.Bytes())
+	}
+}
+
+func FuzzReadMessage(f *testing.F) {
+	addSeedFrames(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		message, err := ReadMessage(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		// Every message that can be read can be written and read back
+		var w bytes.Buffer
+		if err := WriteMessage(&w, message); err != nil {
+			t.Fatalf("unable to write message (%+v): %v", message, err)
+		}
+
+		readMessage, err := ReadMessage(&w)
+		if err != nil {
+			t.Fatalf("unable to read written message (%+v): %v", message, err)
+		}
+
+		if readMessage.Type() != message.Type() {
+			t.Fatalf("incorrect message type, got: %d, want: %d", readMessage.Type(), message.Type())
+		}
+	})
+}
+
+func FuzzFrameHeaderUnmarshal(f *testing.F) {
+	addSeedFrames(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var frameHeader FrameHeader
+		if err := frameHeader.unmarshal(data); err != nil {
+			return
+		}
+
+		b, err := frameHeader.marshal()
+		if err != nil {
+			t.Fatalf("unable to marshal frame header (%+v): %v", frameHeader, err)
+		}
+
+		if !bytes.Equal(b, data[:FrameHeaderLength]) {
+			t.Fatalf("frame header did not round trip, got: %x, want: %x", b, data[:FrameHeaderLength])
+		}
+	})
+}
+
+func FuzzParseFrameData(f *testing.F) {
+	hi, _ := (&HiMessage{Command: "HI", ID: "node-a"}).marshal()
+	f.Add(byte(CommandFrameType), uint32(len(hi)), hi)
+	f.Add(byte(HeaderFrameType), uint32(2), []byte("{}"))
+	f.Add(byte(PayloadFrameType), uint32(0xffffffff), []byte("{}"))
+
+	f.Fuzz(func(t *testing.T, ftype byte, length uint32, data []byte) {
+		message, err := parseFrameData(bytes.NewReader(data), frameType(ftype), length, CompressionNone)
+		if err == nil && message == nil {
+			t.Fatalf("expected a message or an error")
+		}
+	})
+}
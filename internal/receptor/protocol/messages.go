@@ -11,12 +11,25 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
 	errInvalidMessage = errors.New("invalid message")
+	errInvalidEdge    = errors.New("invalid edge")
 )
 
+// UnknownCommandError is returned when a command frame's cmd field does not
+// match any of the known commands.  The frame has been consumed so the
+// caller can skip the command and keep reading.
+type UnknownCommandError struct {
+	Command string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return fmt.Sprintf("unrecognized receptor-network command: %q", e.Command)
+}
+
 type NetworkMessageType int
 
 const (
@@ -35,14 +48,21 @@ type Message interface {
 }
 
 func ReadMessage(r io.Reader) (Message, error) {
+	return ReadCompressedMessage(r, CompressionNone)
+}
+
+// ReadCompressedMessage reads a message whose payload frame may have been
+// compressed with the compression that was negotiated for the connection.
+// Payload frames that were compressed with any other algorithm are rejected.
+func ReadCompressedMessage(r io.Reader, compression Compression) (Message, error) {
 
 	f, err := readFrame(r)
 	if err != nil {
 		return nil, err
 	}
 
-	message, err := parseFrameData(r, f.Type, f.Length)
-	if f.Type != HeaderFrameType {
+	message, err := parseFrameData(r, f.Type, f.Length, compression)
+	if f.Type != HeaderFrameType || err != nil {
 		return message, err
 	}
 
@@ -60,12 +80,21 @@ func ReadMessage(r io.Reader) (Message, error) {
 			log.Printf("read invalid frame type...expected payload frame '%d' received frame type '%d'",
 				PayloadFrameType,
 				payloadFrame.Type)
+			metrics.mismatchedFramesCounter.With(prometheus.Labels{"reason": "frame_type"}).Inc()
 			return nil, errInvalidMessage
 		}
 
+		if payloadFrame.MsgID != f.MsgID {
+			log.Printf("read mismatched frames...header frame %d belongs to message %s, payload frame %d belongs to message %s",
+				f.ID, f.MsgID, payloadFrame.ID, payloadFrame.MsgID)
+			metrics.mismatchedFramesCounter.With(prometheus.Labels{"reason": "message_id"}).Inc()
+			return nil, fmt.Errorf("%w: header frame message id %s, payload frame message id %s",
+				errMismatchedFrames, f.MsgID, payloadFrame.MsgID)
+		}
+
 		metrics.payloadMessageSize.Observe(float64(payloadFrame.Length))
 
-		pm, err := parseFrameData(r, payloadFrame.Type, payloadFrame.Length)
+		pm, err := parseFrameData(r, payloadFrame.Type, payloadFrame.Length, compression)
 		if err != nil {
 			return nil, err
 		}
@@ -79,9 +108,16 @@ func ReadMessage(r io.Reader) (Message, error) {
 }
 
 func WriteMessage(w io.Writer, message Message) error {
+	return WriteCompressedMessage(w, message, CompressionNone)
+}
+
+// WriteCompressedMessage writes the message and compresses the payload frame
+// of a payload message.  The payload frame is written uncompressed if
+// compressing it does not make it smaller.
+func WriteCompressedMessage(w io.Writer, message Message, compression Compression) error {
 
 	if message.Type() == PayloadMessageType {
-		return writePayloadMessage(w, message)
+		return writePayloadMessage(w, message, compression)
 	}
 
 	messageBuffer, err := message.marshal()
@@ -91,7 +127,12 @@ func WriteMessage(w io.Writer, message Message) error {
 		return err
 	}
 
-	err = writeFrame(w, CommandFrameType, messageBuffer)
+	msgID, err := newMessageID()
+	if err != nil {
+		return err
+	}
+
+	err = writeFrame(w, CommandFrameType, msgID, messageBuffer)
 	if err != nil {
 		return err
 	}
@@ -99,14 +140,21 @@ func WriteMessage(w io.Writer, message Message) error {
 	return nil
 }
 
-func writePayloadMessage(w io.Writer, message Message) error {
+func writePayloadMessage(w io.Writer, message Message, compression Compression) error {
 	payloadMessage := message.(*PayloadMessage)
 	routingMessageBuffer, err := payloadMessage.RoutingInfo.marshal()
 	if err != nil {
 		return err
 	}
 
-	err = writeFrame(w, HeaderFrameType, routingMessageBuffer)
+	// The header frame and the payload frame share a message id so that the
+	// reader can pair them up
+	msgID, err := newMessageID()
+	if err != nil {
+		return err
+	}
+
+	err = writeFrame(w, HeaderFrameType, msgID, routingMessageBuffer)
 	if err != nil {
 		return err
 	}
@@ -116,7 +164,12 @@ func writePayloadMessage(w io.Writer, message Message) error {
 		return err
 	}
 
-	err = writeFrame(w, PayloadFrameType, payloadDataBuffer)
+	payloadDataBuffer, err = compressPayload(compression, payloadDataBuffer)
+	if err != nil {
+		return err
+	}
+
+	err = writeFrame(w, PayloadFrameType, msgID, payloadDataBuffer)
 	if err != nil {
 		return err
 	}
@@ -124,22 +177,52 @@ func writePayloadMessage(w io.Writer, message Message) error {
 	return nil
 }
 
+// compressPayload compresses the payload with the negotiated compression.
+// The payload is returned uncompressed if compressing it does not make it
+// smaller.
+func compressPayload(compression Compression, payload []byte) ([]byte, error) {
+	if compression == CompressionNone {
+		return payload, nil
+	}
+
+	compressed, err := compress(compression, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(compressed) >= len(payload) {
+		return payload, nil
+	}
+
+	observeCompression(compression, "sent", len(payload), len(compressed))
+
+	return compressed, nil
+}
+
+// commandTypes maps the cmd field of a command frame to the type of the
+// command.  New commands are added here.
+var commandTypes = map[string]func() Message{
+	"HI":    func() Message { return new(HiMessage) },
+	"ROUTE": func() Message { return new(RouteTableMessage) },
+}
+
 func buildCommandMessage(buff []byte) (Message, error) {
-	msgString := string(buff)
+	var command struct {
+		Command string `json:"cmd"`
+	}
 
-	var m Message
+	if err := json.Unmarshal(buff, &command); err != nil {
+		log.Println("unable to read the cmd field of the command, err:", err)
+		return nil, err
+	}
 
-	// FIXME: look into dynamically unmarshalling json
-	if strings.Contains(msgString, "HI") {
-		m = new(HiMessage)
-	} else if strings.Contains(msgString, "ROUTE") {
-		m = new(RouteTableMessage)
-	} else {
-		log.Printf("FIXME: unrecognized receptor-network message: %s", msgString)
-		return nil, fmt.Errorf("unrecognized receptor-network message: %s", msgString)
+	newCommand, ok := commandTypes[command.Command]
+	if !ok {
+		metrics.unknownCommandCounter.Inc()
+		return nil, &UnknownCommandError{Command: command.Command}
 	}
 
-	return m, nil
+	return newCommand(), nil
 }
 
 var _ Message = &HiMessage{}
@@ -262,6 +345,42 @@ func (m *RouteTableMessage) marshal() ([]byte, error) {
 	return b, nil
 }
 
+// GetEdges converts the loosely typed edge list (["node-a", "node-b", 1])
+// into a list of Edges
+func (m *RouteTableMessage) GetEdges() ([]Edge, error) {
+	edges := make([]Edge, 0, len(m.Edges))
+
+	for _, e := range m.Edges {
+		if len(e) != 3 {
+			return nil, errInvalidEdge
+		}
+
+		left, ok := e[0].(string)
+		if !ok {
+			return nil, errInvalidEdge
+		}
+
+		right, ok := e[1].(string)
+		if !ok {
+			return nil, errInvalidEdge
+		}
+
+		var cost int
+		switch c := e[2].(type) {
+		case float64:
+			cost = int(c)
+		case int:
+			cost = c
+		default:
+			return nil, errInvalidEdge
+		}
+
+		edges = append(edges, Edge{Left: left, Right: right, Cost: cost})
+	}
+
+	return edges, nil
+}
+
 var _ Message = &PayloadMessage{}
 
 type PayloadMessage struct {
@@ -305,6 +424,7 @@ type InnerEnvelope struct {
 	InResponseTo string      `json:"in_response_to"`
 	Code         int         `json:"code"`
 	Serial       int         `json:"serial"`
+	Chunk        *Chunk      `json:"chunk,omitempty"`
 }
 
 type Time struct {
@@ -6,7 +6,14 @@ import (
 )
 
 type Metrics struct {
-	payloadMessageSize prometheus.Histogram
+	payloadMessageSize           prometheus.Histogram
+	payloadCompressionRatio      *prometheus.HistogramVec
+	payloadCompressionBytesSaved *prometheus.CounterVec
+	payloadChunksSent            prometheus.Counter
+	payloadTransfersAssembled    prometheus.Counter
+	payloadTransferFailures      *prometheus.CounterVec
+	unknownCommandCounter        prometheus.Counter
+	mismatchedFramesCounter      *prometheus.CounterVec
 }
 
 func NewMetrics() *Metrics {
@@ -22,6 +29,42 @@ func NewMetrics() *Metrics {
 			1024 * 100,
 		}})
 
+	metrics.payloadCompressionRatio = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "receptor_controller_payload_compression_ratio",
+		Help:    "Ratio of the uncompressed size to the compressed size of the compressed payloads",
+		Buckets: []float64{1, 1.5, 2, 3, 5, 10, 20},
+	}, []string{"compression", "direction"})
+
+	metrics.payloadCompressionBytesSaved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "receptor_controller_payload_compression_bytes_saved",
+		Help: "The number of bytes saved by compressing payloads",
+	}, []string{"compression", "direction"})
+
+	metrics.payloadChunksSent = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "receptor_controller_payload_chunks_sent_count",
+		Help: "The number of chunks that large payloads were split into",
+	})
+
+	metrics.payloadTransfersAssembled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "receptor_controller_payload_transfers_assembled_count",
+		Help: "The number of chunked payloads that were reassembled",
+	})
+
+	metrics.payloadTransferFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "receptor_controller_payload_transfer_failure_count",
+		Help: "The number of chunked payloads that could not be reassembled",
+	}, []string{"reason"})
+
+	metrics.unknownCommandCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "receptor_controller_unknown_command_count",
+		Help: "The number of command frames with an unrecognized cmd that were skipped",
+	})
+
+	metrics.mismatchedFramesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "receptor_controller_mismatched_frame_count",
+		Help: "The number of header frames that were not followed by a matching payload frame",
+	}, []string{"reason"})
+
 	return metrics
 }
 
@@ -0,0 +1,367 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const NetceptorCodecName = "receptor-netceptor"
+
+// The message types of the netceptor wire format.  The type is the first
+// byte of every message.
+const (
+	netceptorMsgTypeData                 byte = 0
+	netceptorMsgTypeRoute                byte = 1
+	netceptorMsgTypeServiceAdvertisement byte = 2
+	netceptorMsgTypeReject               byte = 3
+)
+
+// netceptorDataHeaderLength is the length of the header of a data message:
+// the type, the hops to live, two reserved bytes and the hashed node name and
+// service name of the sender and of the recipient
+const netceptorDataHeaderLength = 36
+
+// netceptorMaxHops is the number of hops that a data message may travel
+// through the mesh.  It matches the default of the go receptor.
+const netceptorMaxHops = 30
+
+// NetceptorPayloadService is the netceptor service that carries the payload
+// messages between the controller and the receptor nodes.  Service names are
+// limited to the 8 bytes that the header of a data message has for them.
+const NetceptorPayloadService = "rcjob"
+
+var (
+	// ErrMessageSkipped is returned for messages that were read but do not
+	// produce a Message for the controller.  The caller can keep reading.
+	ErrMessageSkipped = errors.New("message skipped")
+
+	errNetceptorRejected    = errors.New("connection rejected by the netceptor peer")
+	errUnknownNodeHash      = errors.New("unknown node hash")
+	errUnsupportedNetceptor = errors.New("message cannot be written in the netceptor wire format")
+)
+
+// netceptorRoutingUpdate is the json body of a netceptor route message.  Each
+// node floods an update that lists its own connections through the mesh.
+type netceptorRoutingUpdate struct {
+	NodeID             string
+	UpdateID           string
+	UpdateEpoch        uint64
+	UpdateSequence     uint64
+	Connections        map[string]float64
+	ForwardingNode     string
+	SuspectedDuplicate uint64
+}
+
+var _ Codec = &NetceptorCodec{}
+var _ SessionCodec = &NetceptorCodec{}
+
+// NetceptorCodec speaks the wire format of the go receptor (netceptor): each
+// websocket message carries one netceptor message.  Route messages are json
+// routing updates.  Data messages carry a binary header followed by the
+// data, and address nodes by the FNV-1a hash of their names.
+//
+// The first routing update of the peer is read as its HI.  The routing
+// updates that follow are read as ROUTE commands that list every connection
+// that has been advertised so far.  The payload messages are carried as data
+// messages of the NetceptorPayloadService.
+//
+// A NetceptorCodec keeps the state of one connection.  The codec that is
+// registered is only used to start a session for each connection.
+type NetceptorCodec struct {
+	// names maps the hash of each node name that has been seen to the name
+	names map[uint64]string
+
+	// connections holds the latest routing update of each node
+	connections map[string]netceptorRoutingUpdate
+
+	peerNodeID  string
+	localNodeID string
+
+	updateEpoch    uint64
+	updateSequence uint64
+
+	sync.Mutex
+}
+
+func NewNetceptorCodec() *NetceptorCodec {
+	return &NetceptorCodec{
+		names:       make(map[uint64]string),
+		connections: make(map[string]netceptorRoutingUpdate),
+		updateEpoch: uint64(time.Now().Unix()),
+	}
+}
+
+func (c *NetceptorCodec) Name() string {
+	return NetceptorCodecName
+}
+
+func (c *NetceptorCodec) NewSession() Codec {
+	return NewNetceptorCodec()
+}
+
+// Sniff recognizes the routing update that a netceptor peer sends as soon as
+// it connects
+func (c *NetceptorCodec) Sniff(prefix []byte) bool {
+	return len(prefix) >= 2 && prefix[0] == netceptorMsgTypeRoute && prefix[1] == '{'
+}
+
+func (c *NetceptorCodec) ReadMessage(r io.Reader, compression Compression) (Message, error) {
+	limit := atomic.LoadInt64(&maxFrameLength)
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > limit {
+		log.Printf("Netceptor message length exceeds the maximum frame length (%d)", limit)
+		return nil, errFrameTooLong
+	}
+
+	if len(data) < 1 {
+		return nil, errFrameTooShort
+	}
+
+	switch data[0] {
+	case netceptorMsgTypeRoute:
+		return c.readRoutingUpdate(data[1:])
+	case netceptorMsgTypeData:
+		return c.readData(data, compression)
+	case netceptorMsgTypeServiceAdvertisement:
+		return nil, fmt.Errorf("%w: service advertisement", ErrMessageSkipped)
+	case netceptorMsgTypeReject:
+		return nil, errNetceptorRejected
+	}
+
+	metrics.unknownCommandCounter.Inc()
+	return nil, &UnknownCommandError{Command: fmt.Sprintf("netceptor message type %d", data[0])}
+}
+
+func (c *NetceptorCodec) readRoutingUpdate(data []byte) (Message, error) {
+	var update netceptorRoutingUpdate
+	if err := json.Unmarshal(data, &update); err != nil {
+		log.Println("unmarshal of netceptor routing update failed, err:", err)
+		return nil, err
+	}
+
+	if update.NodeID == "" {
+		return nil, errInvalidMessage
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.addName(update.NodeID)
+	c.addName(update.ForwardingNode)
+	for node := range update.Connections {
+		c.addName(node)
+	}
+
+	previous, exists := c.connections[update.NodeID]
+	if exists == false || update.UpdateEpoch > previous.UpdateEpoch ||
+		(update.UpdateEpoch == previous.UpdateEpoch && update.UpdateSequence > previous.UpdateSequence) {
+		c.connections[update.NodeID] = update
+	}
+
+	// A netceptor peer introduces itself with its own routing update
+	if c.peerNodeID == "" {
+		c.peerNodeID = update.NodeID
+		return &HiMessage{Command: "HI", ID: update.NodeID}, nil
+	}
+
+	return c.buildRouteTableMessage(update.NodeID), nil
+}
+
+// buildRouteTableMessage lists the connections of every node that has sent a
+// routing update.  The caller must hold the lock.
+func (c *NetceptorCodec) buildRouteTableMessage(nodeID string) *RouteTableMessage {
+	nodes := make([]string, 0, len(c.connections))
+	for node := range c.connections {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	edges := make([][]interface{}, 0)
+	for _, node := range nodes {
+		peers := make([]string, 0, len(c.connections[node].Connections))
+		for peer := range c.connections[node].Connections {
+			peers = append(peers, peer)
+		}
+		sort.Strings(peers)
+
+		for _, peer := range peers {
+			// Netceptor costs are fractional.  They are rounded up so that
+			// every hop keeps a cost.
+			cost := math.Ceil(c.connections[node].Connections[peer])
+			edges = append(edges, []interface{}{node, peer, cost})
+		}
+	}
+
+	return &RouteTableMessage{Command: "ROUTE", ID: nodeID, Edges: edges, Seen: nodes}
+}
+
+func (c *NetceptorCodec) readData(data []byte, compression Compression) (Message, error) {
+	if len(data) < netceptorDataHeaderLength {
+		return nil, errFrameDataTooShort
+	}
+
+	toService := trimService(data[28:36])
+	if toService != NetceptorPayloadService {
+		return nil, fmt.Errorf("%w: data for service %q", ErrMessageSkipped, toService)
+	}
+
+	c.Lock()
+	fromNode, fromExists := c.names[binary.BigEndian.Uint64(data[4:12])]
+	toNode, toExists := c.names[binary.BigEndian.Uint64(data[20:28])]
+	c.Unlock()
+
+	if fromExists == false || toExists == false {
+		return nil, fmt.Errorf("%w: %s", ErrMessageSkipped, errUnknownNodeHash)
+	}
+
+	buf := data[netceptorDataHeaderLength:]
+
+	metrics.payloadMessageSize.Observe(float64(len(buf)))
+
+	compressedLength := len(buf)
+	buf, usedCompression, err := decompress(buf, compression)
+	if err != nil {
+		log.Println("Unable to decompress the netceptor data: ", err)
+		return nil, err
+	}
+	observeCompression(usedCompression, "received", len(buf), compressedLength)
+
+	payloadMessage := &PayloadMessage{
+		RoutingInfo: &RoutingMessage{Sender: fromNode, Recipient: toNode, RouteList: []string{}},
+	}
+
+	if err := payloadMessage.unmarshal(buf); err != nil {
+		return nil, err
+	}
+
+	return payloadMessage, nil
+}
+
+func (c *NetceptorCodec) WriteMessage(w io.Writer, message Message, compression Compression) error {
+	var data []byte
+	var err error
+
+	switch m := message.(type) {
+	case *HiMessage:
+		data, err = c.buildRoutingUpdate(m.ID)
+	case *PayloadMessage:
+		data, err = c.buildData(m, compression)
+	default:
+		return fmt.Errorf("%w: message type %d", errUnsupportedNetceptor, message.Type())
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// buildRoutingUpdate builds the routing update that introduces the
+// controller to the peer.  The controller is only connected to the peer.
+func (c *NetceptorCodec) buildRoutingUpdate(nodeID string) ([]byte, error) {
+	updateID := make([]byte, 4)
+	if _, err := rand.Read(updateID); err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	c.localNodeID = nodeID
+	c.addName(nodeID)
+	c.updateSequence++
+
+	update := netceptorRoutingUpdate{
+		NodeID:         nodeID,
+		UpdateID:       hex.EncodeToString(updateID),
+		UpdateEpoch:    c.updateEpoch,
+		UpdateSequence: c.updateSequence,
+		Connections:    map[string]float64{},
+		ForwardingNode: nodeID,
+	}
+
+	if c.peerNodeID != "" {
+		update.Connections[c.peerNodeID] = 1.0
+	}
+	c.Unlock()
+
+	b, err := json.Marshal(update)
+	if err != nil {
+		log.Println("marshal of netceptor routing update failed, err:", err)
+		return nil, err
+	}
+
+	return append([]byte{netceptorMsgTypeRoute}, b...), nil
+}
+
+func (c *NetceptorCodec) buildData(payloadMessage *PayloadMessage, compression Compression) ([]byte, error) {
+	buf, err := payloadMessage.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err = compressPayload(compression, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	fromNode := c.addName(payloadMessage.RoutingInfo.Sender)
+	toNode := c.addName(payloadMessage.RoutingInfo.Recipient)
+	c.Unlock()
+
+	data := make([]byte, netceptorDataHeaderLength+len(buf))
+	data[0] = netceptorMsgTypeData
+	data[1] = netceptorMaxHops
+	binary.BigEndian.PutUint64(data[4:12], fromNode)
+	copy(data[12:20], NetceptorPayloadService)
+	binary.BigEndian.PutUint64(data[20:28], toNode)
+	copy(data[28:36], NetceptorPayloadService)
+	copy(data[netceptorDataHeaderLength:], buf)
+
+	return data, nil
+}
+
+// addName records the hash of a node name.  The caller must hold the lock.
+func (c *NetceptorCodec) addName(name string) uint64 {
+	hash := netceptorNameHash(name)
+	if name != "" {
+		c.names[hash] = name
+	}
+	return hash
+}
+
+// netceptorNameHash is the hash that netceptor uses to address a node in the
+// header of a data message
+func netceptorNameHash(name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return h.Sum64()
+}
+
+func trimService(service []byte) string {
+	for i, b := range service {
+		if b == 0 {
+			return string(service[:i])
+		}
+	}
+	return string(service)
+}
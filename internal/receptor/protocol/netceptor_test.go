@@ -0,0 +1,239 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// The frames below are laid out the way the go receptor writes them to the
+// websocket.  Nodes are addressed by the FNV-1a hash of their names.
+const (
+	nodeAHash     = "e6971cc22078cb53"
+	nodeCloudHash = "e11901f15d24bb11"
+)
+
+var (
+	netceptorNodeARoute = append([]byte{0x01},
+		`{"NodeID":"node-a","UpdateID":"5ba6ebc8","UpdateEpoch":1700000000,"UpdateSequence":1,`+
+			`"Connections":{"node-b":1,"node-cloud":1},"ForwardingNode":"node-a","SuspectedDuplicate":0}`...)
+
+	netceptorNodeBRoute = append([]byte{0x01},
+		`{"NodeID":"node-b","UpdateID":"0c2e9a71","UpdateEpoch":1700000005,"UpdateSequence":3,`+
+			`"Connections":{"node-a":1,"node-c":2.5},"ForwardingNode":"node-a","SuspectedDuplicate":0}`...)
+)
+
+// buildNetceptorDataFrame lays out a data message: the type, the hops to
+// live, two reserved bytes, the sender's node hash and service, the
+// recipient's node hash and service and then the data
+func buildNetceptorDataFrame(t *testing.T, fromHash string, toHash string, service string, data []byte) []byte {
+	from, err := hex.DecodeString(fromHash)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	to, err := hex.DecodeString(toHash)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	serviceName := make([]byte, 8)
+	copy(serviceName, service)
+
+	frame := []byte{0x00, 0x1e, 0x00, 0x00}
+	frame = append(frame, from...)
+	frame = append(frame, serviceName...)
+	frame = append(frame, to...)
+	frame = append(frame, serviceName...)
+	return append(frame, data...)
+}
+
+func readNetceptorFrame(t *testing.T, codec Codec, frame []byte) Message {
+	message, err := codec.ReadMessage(bytes.NewReader(frame), CompressionNone)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return message
+}
+
+func newNetceptorSession(t *testing.T) Codec {
+	codec := SniffCodec(netceptorNodeARoute)
+	if codec.Name() != NetceptorCodecName {
+		t.Fatalf("expected the netceptor codec, got: %s", codec.Name())
+	}
+	return codec
+}
+
+func TestNetceptorCodecSniff(t *testing.T) {
+	first := newNetceptorSession(t)
+	second := newNetceptorSession(t)
+
+	if first == second {
+		t.Fatalf("expected a new session for each connection")
+	}
+
+	legacyFrame := new(bytes.Buffer)
+	WriteMessage(legacyFrame, &HiMessage{Command: "HI", ID: "node-a"})
+
+	if codec := SniffCodec(legacyFrame.Bytes()[:SniffLength]); codec.Name() != LegacyCodecName {
+		t.Fatalf("expected the legacy codec, got: %s", codec.Name())
+	}
+
+	if codec, ok := CodecForSubprotocol(NetceptorCodecName); !ok || codec.Name() != NetceptorCodecName {
+		t.Fatalf("expected the netceptor codec, got: %v", codec)
+	}
+}
+
+func TestNetceptorCodecReadsRoutingUpdates(t *testing.T) {
+	codec := newNetceptorSession(t)
+
+	hiMessage, ok := readNetceptorFrame(t, codec, netceptorNodeARoute).(*HiMessage)
+	if !ok || hiMessage.ID != "node-a" {
+		t.Fatalf("expected the first routing update to be read as the peer's HI, got: %+v", hiMessage)
+	}
+
+	routeTableMessage, ok := readNetceptorFrame(t, codec, netceptorNodeBRoute).(*RouteTableMessage)
+	if !ok {
+		t.Fatalf("expected a ROUTE command")
+	}
+
+	if routeTableMessage.ID != "node-b" || reflect.DeepEqual(routeTableMessage.Seen, []string{"node-a", "node-b"}) == false {
+		t.Fatalf("unexpected route table message, got: %+v", routeTableMessage)
+	}
+
+	edges, err := routeTableMessage.GetEdges()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedEdges := []Edge{
+		{Left: "node-a", Right: "node-b", Cost: 1},
+		{Left: "node-a", Right: "node-cloud", Cost: 1},
+		{Left: "node-b", Right: "node-a", Cost: 1},
+		{Left: "node-b", Right: "node-c", Cost: 3},
+	}
+
+	if reflect.DeepEqual(edges, expectedEdges) == false {
+		t.Fatalf("unexpected edges, got: %v, want: %v", edges, expectedEdges)
+	}
+}
+
+func TestNetceptorCodecReadsData(t *testing.T) {
+	codec := newNetceptorSession(t)
+	readNetceptorFrame(t, codec, netceptorNodeARoute)
+
+	frame := buildNetceptorDataFrame(t, nodeAHash, nodeCloudHash, NetceptorPayloadService,
+		[]byte(`{"message_id":"a9b8c7d6","sender":"node-a","recipient":"node-cloud","message_type":"response",`+
+			`"timestamp":"2021-01-12T15:04:05.123456","raw_payload":"pong","in_response_to":"0f1e2d3c","serial":1}`))
+
+	payloadMessage, ok := readNetceptorFrame(t, codec, frame).(*PayloadMessage)
+	if !ok {
+		t.Fatalf("expected a payload message")
+	}
+
+	if payloadMessage.RoutingInfo.Sender != "node-a" || payloadMessage.RoutingInfo.Recipient != "node-cloud" {
+		t.Fatalf("unexpected routing info, got: %+v", payloadMessage.RoutingInfo)
+	}
+
+	if payloadMessage.Data.InResponseTo != "0f1e2d3c" || payloadMessage.Data.RawPayload != "pong" || payloadMessage.Data.Serial != 1 {
+		t.Fatalf("unexpected payload, got: %+v", payloadMessage.Data)
+	}
+}
+
+func TestNetceptorCodecSkipsMessages(t *testing.T) {
+	codec := newNetceptorSession(t)
+	readNetceptorFrame(t, codec, netceptorNodeARoute)
+
+	skipped := [][]byte{
+		append([]byte{0x02}, `{"NodeID":"node-a","Service":"control","Time":"2021-01-12T15:04:05Z"}`...),
+		buildNetceptorDataFrame(t, nodeAHash, nodeCloudHash, "control", []byte("data")),
+		buildNetceptorDataFrame(t, "0000000000000001", nodeCloudHash, NetceptorPayloadService, []byte("{}")),
+	}
+
+	for _, frame := range skipped {
+		_, err := codec.ReadMessage(bytes.NewReader(frame), CompressionNone)
+		if errors.Is(err, ErrMessageSkipped) == false {
+			t.Fatalf("expected the message to be skipped, got: %v", err)
+		}
+	}
+
+	var unknownCommandErr *UnknownCommandError
+	if _, err := codec.ReadMessage(bytes.NewReader([]byte{0x09}), CompressionNone); errors.As(err, &unknownCommandErr) == false {
+		t.Fatalf("expected an unknown command error, got: %v", err)
+	}
+
+	if _, err := codec.ReadMessage(bytes.NewReader([]byte{0x03}), CompressionNone); err != errNetceptorRejected {
+		t.Fatalf("expected the connection to be rejected, got: %v", err)
+	}
+}
+
+func TestNetceptorCodecWritesHandshake(t *testing.T) {
+	codec := newNetceptorSession(t)
+	readNetceptorFrame(t, codec, netceptorNodeARoute)
+
+	w := new(bytes.Buffer)
+	if err := codec.WriteMessage(w, &HiMessage{Command: "HI", ID: "node-cloud"}, CompressionNone); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	frame := w.Bytes()
+	if frame[0] != 0x01 {
+		t.Fatalf("expected a route message, got type: %d", frame[0])
+	}
+
+	var update netceptorRoutingUpdate
+	if err := json.Unmarshal(frame[1:], &update); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if update.NodeID != "node-cloud" || update.ForwardingNode != "node-cloud" || update.UpdateSequence != 1 ||
+		reflect.DeepEqual(update.Connections, map[string]float64{"node-a": 1}) == false {
+		t.Fatalf("unexpected routing update, got: %+v", update)
+	}
+}
+
+func TestNetceptorCodecDataRoundTrip(t *testing.T) {
+	for _, compression := range []Compression{CompressionNone, CompressionGzip} {
+		codec := newNetceptorSession(t)
+		readNetceptorFrame(t, codec, netceptorNodeARoute)
+
+		payload := bytes.Repeat([]byte("payload "), 100)
+		message, _ := BuildPayloadMessage([16]byte{1}, "node-cloud", "node-a", []string{"node-a"},
+			"job", "worker:action", string(payload))
+
+		w := new(bytes.Buffer)
+		if err := codec.WriteMessage(w, message, compression); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expectedHeader := buildNetceptorDataFrame(t, nodeCloudHash, nodeAHash, NetceptorPayloadService, nil)
+		if bytes.Equal(w.Bytes()[:len(expectedHeader)], expectedHeader) == false {
+			t.Fatalf("unexpected data header, got: %x, want: %x", w.Bytes()[:len(expectedHeader)], expectedHeader)
+		}
+
+		readMessage, err := codec.ReadMessage(w, compression)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		payloadMessage := readMessage.(*PayloadMessage)
+		if payloadMessage.RoutingInfo.Sender != "node-cloud" || payloadMessage.RoutingInfo.Recipient != "node-a" ||
+			payloadMessage.Data.Directive != "worker:action" || payloadMessage.Data.RawPayload != string(payload) {
+			t.Fatalf("unexpected payload message, got: %+v", payloadMessage)
+		}
+	}
+}
+
+func TestNetceptorCodecRejectsLargeMessages(t *testing.T) {
+	SetMaxFrameLength(64)
+	defer SetMaxFrameLength(1 * 1024 * 1024)
+
+	codec := newNetceptorSession(t)
+
+	if _, err := codec.ReadMessage(bytes.NewReader(netceptorNodeARoute), CompressionNone); err != errFrameTooLong {
+		t.Fatalf("expected the message to be rejected, got: %v", err)
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -531,3 +534,227 @@ func TestInnerEnvelopeMarshalling(t *testing.T) {
 			unmarshalledInnerEnvelope)
 	}
 }
+
+func TestRouteTableMessageGetEdges(t *testing.T) {
+	commandMessage := []byte("{\"cmd\": \"ROUTE\", \"id\": \"node_01\", \"edges\": [[\"node-a\", \"node-b\", 1], [\"node-b\", \"node-c\", 3]], \"seen\": [\"node-a\", \"node-b\"]}")
+
+	b := generateFrameByteArray(CommandFrameType, 123, commandMessage)
+
+	message, err := ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("unexpected error reading message: %s", err)
+	}
+
+	edges, err := message.(*RouteTableMessage).GetEdges()
+	if err != nil {
+		t.Fatalf("unexpected error getting edges: %s", err)
+	}
+
+	expected := []Edge{{"node-a", "node-b", 1}, {"node-b", "node-c", 3}}
+	if len(edges) != len(expected) {
+		t.Fatalf("incorrect number of edges, expected: %d, got: %d", len(expected), len(edges))
+	}
+
+	for i := range expected {
+		if expected[i] != edges[i] {
+			t.Fatalf("incorrect edge, expected: %+v, got: %+v", expected[i], edges[i])
+		}
+	}
+}
+
+func TestRouteTableMessageGetEdgesInvalidEdges(t *testing.T) {
+	subTests := map[string][][]interface{}{
+		"short_edge":     {{"node-a", "node-b"}},
+		"invalid_left":   {{1, "node-b", 1}},
+		"invalid_right":  {{"node-a", nil, 1}},
+		"invalid_weight": {{"node-a", "node-b", "1"}},
+	}
+
+	for testName, edges := range subTests {
+		t.Run(testName, func(t *testing.T) {
+			routeTableMessage := RouteTableMessage{Command: "ROUTE", Edges: edges}
+			_, err := routeTableMessage.GetEdges()
+			if err != errInvalidEdge {
+				t.Fatalf("[%s] expected an invalid edge error, got: %v", testName, err)
+			}
+		})
+	}
+}
+
+func TestCommandRoundTrip(t *testing.T) {
+	// Every registered command type needs a round trip test case
+	subTests := map[string]Message{
+		"HI": &HiMessage{Command: "HI",
+			ID:              "node-a",
+			ExpireTimestamp: 1571507551.7103958,
+			Metadata:        map[string]interface{}{"compression": []interface{}{"zstd"}}},
+		"ROUTE": &RouteTableMessage{Command: "ROUTE",
+			ID:           "node-a",
+			Capabilities: map[string]interface{}{"max_work_threads": float64(4)},
+			Groups:       []interface{}{"group-a"},
+			Edges:        [][]interface{}{{"node-a", "node-b", float64(1)}},
+			Seen:         []string{"node-a", "node-b"}},
+	}
+
+	for command := range commandTypes {
+		if _, ok := subTests[command]; !ok {
+			t.Fatalf("missing a round trip test for the %s command", command)
+		}
+	}
+
+	for command, message := range subTests {
+		t.Run(command, func(t *testing.T) {
+			var w bytes.Buffer
+
+			if err := WriteMessage(&w, message); err != nil {
+				t.Fatalf("unexpected error writing message: %v", err)
+			}
+
+			readMessage, err := ReadMessage(&w)
+			if err != nil {
+				t.Fatalf("unexpected error reading message: %v", err)
+			}
+
+			if readMessage.Type() != message.Type() {
+				t.Fatalf("incorrect message type, got: %d, want: %d", readMessage.Type(), message.Type())
+			}
+
+			if !reflect.DeepEqual(readMessage, message) {
+				t.Fatalf("messages are unequal, got: %+v, want: %+v", readMessage, message)
+			}
+		})
+	}
+}
+
+func TestReadCommandMessageUsesTheCmdField(t *testing.T) {
+	// The node id contains the name of another command
+	commandMessage := []byte("{\"cmd\": \"ROUTE\", \"id\": \"HI-node\", \"edges\": [], \"seen\": [\"HI-node\"]}")
+
+	b := generateFrameByteArray(CommandFrameType, 123, commandMessage)
+
+	message, err := ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if message.Type() != RouteTableMessageType {
+		t.Fatalf("incorrect message type, got: %d, want: %d", message.Type(), RouteTableMessageType)
+	}
+}
+
+func TestReadCommandMessageUnknownCommand(t *testing.T) {
+	var w bytes.Buffer
+
+	w.Write(generateFrameByteArray(CommandFrameType, 123, []byte("{\"cmd\": \"HI-THERE\", \"id\": \"node_01\"}")))
+	WriteMessage(&w, &HiMessage{Command: "HI", ID: "node_01"})
+
+	_, err := ReadMessage(&w)
+
+	unknownCommandErr, ok := err.(*UnknownCommandError)
+	if !ok || unknownCommandErr.Command != "HI-THERE" {
+		t.Fatalf("expected an UnknownCommandError, got: %v", err)
+	}
+
+	// The unknown command was consumed so the next message can be read
+	message, err := ReadMessage(&w)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if message.Type() != HiMessageType {
+		t.Fatalf("incorrect message type, got: %d, want: %d", message.Type(), HiMessageType)
+	}
+}
+
+func readFrames(t *testing.T, r io.Reader) []*FrameHeader {
+	var frames []*FrameHeader
+	for {
+		f, err := readFrame(r)
+		if err == errFrameTooShort {
+			return frames
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := readFrameData(r, f.Length); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		frames = append(frames, f)
+	}
+}
+
+func TestWriteMessageAssignsFrameAndMessageIDs(t *testing.T) {
+	var w bytes.Buffer
+
+	payloadMessage := buildLargePayloadMessage(t, 10)
+
+	if err := WriteMessage(&w, payloadMessage); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := WriteMessage(&w, &HiMessage{Command: "HI", ID: "node-a"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	frames := readFrames(t, &w)
+	if len(frames) != 3 {
+		t.Fatalf("expected 3 frames, got: %d", len(frames))
+	}
+
+	header, payload, command := frames[0], frames[1], frames[2]
+
+	if header.ID == 0 || payload.ID != header.ID+1 || command.ID != payload.ID+1 {
+		t.Fatalf("expected increasing frame ids, got: %d, %d, %d", header.ID, payload.ID, command.ID)
+	}
+
+	if header.MsgID == (messageID{}) || header.MsgID != payload.MsgID {
+		t.Fatalf("expected the header and payload frames to share a message id, got: %s, %s", header.MsgID, payload.MsgID)
+	}
+
+	if command.MsgID == (messageID{}) || command.MsgID == header.MsgID {
+		t.Fatalf("expected the command to have its own message id, got: %s", command.MsgID)
+	}
+}
+
+func TestReadMessageMismatchedFrames(t *testing.T) {
+	var w bytes.Buffer
+
+	if err := WriteMessage(&w, buildLargePayloadMessage(t, 10)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b := w.Bytes()
+
+	// Overwrite the message id of the payload frame
+	headerFrameLength := FrameHeaderLength + int(binary.BigEndian.Uint32(b[6:10]))
+	copy(b[headerFrameLength+10:headerFrameLength+FrameHeaderLength], bytes.Repeat([]byte{0xff}, 16))
+
+	_, err := ReadMessage(bytes.NewReader(b))
+	if !errors.Is(err, errMismatchedFrames) {
+		t.Fatalf("expected a mismatched frames error, got: %v", err)
+	}
+}
+
+func TestReadMessageFrameTooLong(t *testing.T) {
+	b := generateFrameByteArray(CommandFrameType, 123, []byte("{\"cmd\": \"HI\"}"))
+
+	// Claim that the frame data is 4 GiB
+	binary.BigEndian.PutUint32(b[6:10], 0xffffffff)
+
+	_, err := ReadMessage(bytes.NewReader(b))
+	if err != errFrameTooLong {
+		t.Fatalf("expected error %v, got: %v", errFrameTooLong, err)
+	}
+}
+
+func TestReadMessageInvalidHeaderFrame(t *testing.T) {
+	b := generateFrameByteArray(HeaderFrameType, 123, []byte("{\"sender\": "))
+	b = append(b, generateFrameByteArray(PayloadFrameType, 124, []byte("{}"))...)
+
+	message, err := ReadMessage(bytes.NewReader(b))
+	if message != nil || err == nil {
+		t.Fatalf("expected an error, got: %v", message)
+	}
+}